@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"sql_module/internal/repository"
+	"strings"
 )
 
 type BlockMiddleware struct {
@@ -56,7 +57,9 @@ func isPublicEndpoint(path string) bool {
 			return true
 		}
 	}
-	return false
+
+	// Проверка сертификата по коду доступна без входа
+	return strings.HasPrefix(path, "/api/certificates/verify/")
 }
 
 func respondBlocked(w http.ResponseWriter) {
@@ -58,7 +58,7 @@ func VerifyToken(tokenString string) (*Claims, error) {
 
 func JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/health" || r.URL.Path == "/api/login" || r.URL.Path == "/api/register" {
+		if isPublicEndpoint(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
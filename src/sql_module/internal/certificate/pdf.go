@@ -0,0 +1,153 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"sql_module/internal/models"
+	"strings"
+)
+
+// Ширины символов ' '..'~' стандартных шрифтов PDF в тысячных долях кегля (AFM)
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// A4 в альбомной ориентации, пункты
+const (
+	pageWidth  = 842
+	pageHeight = 595
+	textWidth  = 720 // строки шире обрезаются
+)
+
+// Алфавит кода проверки без похожих символов (0/O, 1/I)
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewVerificationCode возвращает случайный код вида XXXX-XXXX-XXXX
+func NewVerificationCode() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, v := range buf {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(codeAlphabet[int(v)%len(codeAlphabet)])
+	}
+	return b.String(), nil
+}
+
+// line - строка сертификата, выровненная по центру страницы
+type line struct {
+	text string
+	bold bool
+	size float64
+	y    float64
+}
+
+// Render формирует одностраничный PDF сертификата. Используются только
+// встроенные шрифты Helvetica, поэтому текст транслитерируется.
+func Render(c *models.Certificate) []byte {
+	lines := []line{
+		{"CERTIFICATE OF COMPLETION", true, 32, 470},
+		{"This is to certify that", false, 14, 415},
+		{c.StudentName, true, 26, 375},
+		{"has successfully passed the test", false, 14, 335},
+		{c.TestTitle, true, 20, 300},
+		{"Course: " + c.CourseName, false, 14, 268},
+		{fmt.Sprintf("Score: %g of %g (%.2f%%), passing threshold %g%%",
+			c.Score, c.MaxScore, c.Percentage, c.PassingPercent), false, 14, 225},
+		{"Issued on " + c.IssuedAt.Format("2006-01-02"), false, 12, 150},
+		{"Verification code: " + c.VerificationCode, true, 12, 128},
+		{"Verify at /api/certificates/verify/" + c.VerificationCode, false, 10, 110},
+	}
+
+	var content bytes.Buffer
+	// Двойная рамка
+	content.WriteString("q 0.16 0.27 0.47 RG 3 w 30 30 782 535 re S 1 w 40 40 762 515 re S Q\n")
+	for _, l := range lines {
+		text := fitWidth(Transliterate(l.text), l.bold, l.size)
+		font := "F1"
+		if l.bold {
+			font = "F2"
+		}
+		x := (pageWidth - textWidthOf(text, l.bold, l.size)) / 2
+		fmt.Fprintf(&content, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, l.size, x, l.y, escapeText(text))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>", pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Producer (sql_module) >>", escapeText("Certificate "+c.VerificationCode)),
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, len(objects), xref)
+
+	return out.Bytes()
+}
+
+// textWidthOf - ширина ASCII-строки в пунктах
+func textWidthOf(text string, bold bool, size float64) float64 {
+	widths := &helveticaWidths
+	if bold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for i := 0; i < len(text); i++ {
+		total += widths[text[i]-' ']
+	}
+	return float64(total) * size / 1000
+}
+
+// fitWidth обрезает строку с многоточием, если она не помещается в строку страницы
+func fitWidth(text string, bold bool, size float64) string {
+	if textWidthOf(text, bold, size) <= textWidth {
+		return text
+	}
+	for len(text) > 0 && textWidthOf(text+"...", bold, size) > textWidth {
+		text = text[:len(text)-1]
+	}
+	return strings.TrimRight(text, " ") + "..."
+}
+
+func escapeText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(text)
+}
@@ -0,0 +1,64 @@
+package certificate
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Латиница для кириллицы по ICAO Doc 9303 (как в загранпаспортах)
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+}
+
+// Типографские знаки, которых нет в ASCII
+var punctuation = map[rune]string{
+	'«': "\"", '»': "\"", '„': "\"", '“': "\"", '”': "\"",
+	'‘': "'", '’': "'", '—': "-", '–': "-", '№': "No.", '…': "...",
+	'\u00a0': " ",
+}
+
+// Transliterate переводит строку в печатный ASCII: кириллица - латиницей,
+// остальные символы вне ASCII заменяются на '?'.
+// Стандартные шрифты PDF не содержат кириллицы, поэтому сертификат пишется латиницей.
+func Transliterate(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if r >= ' ' && r <= '~' {
+			b.WriteRune(r)
+			continue
+		}
+
+		if latin, ok := punctuation[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+
+		lower := unicode.ToLower(r)
+		latin, ok := cyrillicToLatin[lower]
+		if !ok {
+			if unicode.IsSpace(r) {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte('?')
+			}
+			continue
+		}
+
+		if lower != r && latin != "" {
+			// ЖУК -> ZHUK, но Жук -> Zhuk
+			nextUpper := i+1 < len(runes) && unicode.IsUpper(runes[i+1])
+			if nextUpper || (i > 0 && unicode.IsUpper(runes[i-1]) && i+1 == len(runes)) {
+				latin = strings.ToUpper(latin)
+			} else {
+				latin = strings.ToUpper(latin[:1]) + latin[1:]
+			}
+		}
+		b.WriteString(latin)
+	}
+	return b.String()
+}
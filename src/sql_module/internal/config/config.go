@@ -1,11 +1,18 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 type Config struct {
 	DatabaseURL string
 	PortServer  string
 	JWTSecret   string
+
+	// Сети прокси (nginx), которым доверяем X-Real-IP и X-Forwarded-For.
+	// По умолчанию - localhost и сети docker.
+	TrustedProxies []string
 }
 
 var jwtSecret = []byte("your-secret-key-change-in-production")
@@ -15,6 +22,9 @@ func Load() *Config {
 		DatabaseURL: getenv("DATABASE_URL", "host=postgres user=postgres password=123456 dbname=poll_system sslmode=disable"),
 		PortServer:  getenv("SERVER_PORT", ":8080"),
 		JWTSecret:   getenv("JWT_SECRET", "your-secret-key-change-in-production"),
+
+		TrustedProxies: strings.Split(getenv("TRUSTED_PROXIES",
+			"127.0.0.0/8,::1/128,172.16.0.0/12"), ","),
 	}
 }
 
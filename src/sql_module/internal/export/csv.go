@@ -0,0 +1,64 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// BOM в начале файла, без него Excel читает UTF-8 как ANSI и портит кириллицу
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// csvWriter пишет через буфер csv.Writer: данные уходят в поток по мере заполнения буфера
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, delimiter rune) (*csvWriter, error) {
+	if _, err := w.Write(utf8BOM); err != nil {
+		return nil, err
+	}
+
+	cw := csv.NewWriter(w)
+	if delimiter != 0 {
+		cw.Comma = delimiter
+	}
+	// Excel ожидает CRLF
+	cw.UseCRLF = true
+	return &csvWriter{w: cw}, nil
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = escapeFormula(column)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		text, _, isNumber, _ := cellValue(v)
+		if !isNumber {
+			text = escapeFormula(text)
+		}
+		record[i] = text
+	}
+	return c.w.Write(record)
+}
+
+// escapeFormula не дает Excel выполнить текст ячейки как формулу: значения
+// (например, ФИО, которое вводит сам студент), начинающиеся с =, +, -, @,
+// табуляции или перевода строки, предваряются апострофом
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Форматы выгрузки
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// TimeLayout - формат дат в выгрузках
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Writer построчно пишет таблицу в выходной поток, не накапливая ее в памяти.
+// Значения ячеек: string, int, float64, bool, time.Time, указатели на них и nil
+// (пустая ячейка).
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	// Close дописывает хвост файла; сам поток не закрывает
+	Close() error
+}
+
+// NewWriter создает Writer нужного формата. sheet - имя листа XLSX,
+// delimiter - разделитель полей CSV
+func NewWriter(format string, w io.Writer, sheet string, delimiter rune) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, delimiter)
+	case FormatXLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, fmt.Errorf("unknown export format: %s", format)
+}
+
+// IsValidFormat проверяет формат выгрузки
+func IsValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatXLSX
+}
+
+// ContentType возвращает MIME-тип файла выгрузки
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// cellValue приводит значение ячейки к тексту или числу.
+// ok = false - пустая ячейка
+func cellValue(v interface{}) (text string, number float64, isNumber, ok bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", 0, false, false
+	case string:
+		return v, 0, false, true
+	case *string:
+		if v == nil {
+			return "", 0, false, false
+		}
+		return *v, 0, false, true
+	case int:
+		return strconv.Itoa(v), float64(v), true, true
+	case *int:
+		if v == nil {
+			return "", 0, false, false
+		}
+		return strconv.Itoa(*v), float64(*v), true, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), v, true, true
+	case *float64:
+		if v == nil {
+			return "", 0, false, false
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64), *v, true, true
+	case bool:
+		return strconv.FormatBool(v), 0, false, true
+	case *bool:
+		if v == nil {
+			return "", 0, false, false
+		}
+		return strconv.FormatBool(*v), 0, false, true
+	case time.Time:
+		return v.Format(TimeLayout), 0, false, true
+	case *time.Time:
+		if v == nil {
+			return "", 0, false, false
+		}
+		return v.Format(TimeLayout), 0, false, true
+	}
+	return fmt.Sprint(v), 0, false, true
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Accommodation - особые условия студента: больше времени на попытку и дополнительные попытки.
+// Задаются на курс (для всех его тестов) или на отдельный тест; условия теста важнее условий курса.
+type Accommodation struct {
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	CourseID       *int      `json:"course_id,omitempty"` // условия на все тесты курса
+	TestID         *int      `json:"test_id,omitempty"`   // условия на один тест
+	TimeMultiplier float64   `json:"time_multiplier"`     // 1.5 - полуторное время на попытку
+	ExtraAttempts  int       `json:"extra_attempts"`      // сверх max_attempts теста
+	Note           string    `json:"note,omitempty"`
+	CreatedBy      int       `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AttemptAccommodation - особые условия, примененные при старте попытки.
+// Сохраняется вместе с попыткой и не меняется, если условия потом изменят или удалят.
+type AttemptAccommodation struct {
+	AttemptID       int     `json:"attempt_id"`
+	UserID          int     `json:"user_id"`
+	AccommodationID *int    `json:"accommodation_id"` // nil - условия уже удалены
+	TimeMultiplier  float64 `json:"time_multiplier"`
+	ExtraMinutes    int     `json:"extra_minutes"` // добавлено к длительности теста
+	ExtraAttempt    bool    `json:"extra_attempt"` // попытка сверх обычного лимита
+}
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// Состояние ответа в истории изменений
+const (
+	AnswerStateCorrect  = "correct"
+	AnswerStateWrong    = "wrong"
+	AnswerStateOmitted  = "omitted"  // ответ стерт
+	AnswerStateUngraded = "ungraded" // развернутый ответ, правильность решает преподаватель
+)
+
+// Признаки вопросов в отчете по времени
+const (
+	TimingFlagSlow         = "slow"           // на вопрос уходит намного больше времени, чем на остальные
+	TimingFlagRightToWrong = "right_to_wrong" // верный ответ часто меняют на неверный
+)
+
+// AnswerChange - запись истории ответа: первый ответ или изменение
+type AnswerChange struct {
+	AnsweredAt time.Time `json:"answered_at"`
+	Answer     string    `json:"answer"`
+	State      string    `json:"state"` // correct, wrong, omitted, ungraded - по текущему ключу вопроса
+}
+
+// QuestionTiming - время и история ответа на вопрос в одной попытке
+type QuestionTiming struct {
+	QuestionID       int            `json:"question_id"`
+	QuestionVersion  int            `json:"question_version"`
+	Title            string         `json:"title"`
+	FirstAnsweredAt  time.Time      `json:"first_answered_at"`
+	LastAnsweredAt   time.Time      `json:"last_answered_at"`
+	TimeSpentSeconds float64        `json:"time_spent_seconds"`
+	Changes          int            `json:"changes"` // изменения после первого ответа
+	RightToWrong     int            `json:"right_to_wrong"`
+	WrongToRight     int            `json:"wrong_to_right"`
+	FinalState       string         `json:"final_state"`
+	History          []AnswerChange `json:"history"`
+}
+
+// AttemptTiming - время по вопросам попытки. Время вопроса - промежутки от
+// предыдущего сохранения любого ответа (или начала попытки) до сохранения ответа
+// на этот вопрос; ответы, сохраненные одновременно, делят промежуток поровну
+type AttemptTiming struct {
+	AttemptID           int              `json:"attempt_id"`
+	TestID              int              `json:"test_id"`
+	UserID              int              `json:"user_id"`
+	StartedAt           time.Time        `json:"started_at"`
+	CompletedAt         *time.Time       `json:"completed_at"`
+	DurationSeconds     *float64         `json:"duration_seconds"`     // nil - попытка еще идет
+	UnattributedSeconds *float64         `json:"unattributed_seconds"` // от последнего ответа до завершения
+	Changes             int              `json:"changes"`
+	RightToWrong        int              `json:"right_to_wrong"`
+	WrongToRight        int              `json:"wrong_to_right"`
+	Questions           []QuestionTiming `json:"questions"`
+}
+
+// TestTimingReport - время и изменения ответов по вопросам завершенных попыток теста
+type TestTimingReport struct {
+	TestID        int                   `json:"test_id"`
+	Attempts      int                   `json:"attempts"`
+	MedianSeconds float64               `json:"median_seconds"` // медиана медиан времени по вопросам
+	Questions     []QuestionTimingStats `json:"questions"`
+}
+
+type QuestionTimingStats struct {
+	QuestionID      int      `json:"question_id"`
+	QuestionVersion int      `json:"question_version"`
+	Title           string   `json:"title"`
+	Attempts        int      `json:"attempts"` // попытки, в которых на вопрос отвечали
+	MeanSeconds     float64  `json:"mean_seconds"`
+	MedianSeconds   float64  `json:"median_seconds"`
+	MaxSeconds      float64  `json:"max_seconds"`
+	ChangedAttempts int      `json:"changed_attempts"` // попытки, в которых ответ меняли
+	Changes         int      `json:"changes"`
+	RightToWrong    int      `json:"right_to_wrong"` // попытки, где верный ответ сменили на неверный
+	WrongToRight    int      `json:"wrong_to_right"`
+	Flags           []string `json:"flags"`
+}
@@ -8,17 +8,142 @@ type Attempt struct {
 	ID          int        `json:"id"`
 	TestID      int        `json:"test_id"`
 	UserID      int        `json:"user_id"`
-	Status      string     `json:"status"` // могут быть : in_progress, completed, cancelled
+	Status      string     `json:"status"` // могут быть : in_progress, awaiting_review, completed, cancelled
 	Score       *float64   `json:"score"`  // nil = еще не прошел
 	StartedAt   time.Time  `json:"started_at"`
 	CompletedAt *time.Time `json:"completed_at"` // nil - еще не прошел
+	Deadline    *time.Time `json:"deadline"`     // nil - тест без ограничения по времени
+	MaxScore    float64    `json:"max_score"`    // сумма баллов вопросов, зафиксированных при старте
+
+	ScoreBreakdown *ScoreBreakdown `json:"score_breakdown,omitempty"` // как получен итог, заполняется при завершении
+
+	// Процент от максимума и оценка по шкале курса, nil - попытка не оценена или шкала не задана
+	Percentage *float64 `json:"percentage,omitempty"`
+	Grade      *string  `json:"grade,omitempty"`
+
+	Accommodation *AttemptAccommodation `json:"accommodation,omitempty"` // nil - попытка в обычных условиях
 }
 
-type Answer struct {
-	ID              int   `json:"id"`
+// ScoreBreakdown - расшифровка итогового балла попытки
+type ScoreBreakdown struct {
+	Questions     []QuestionScore `json:"questions"`
+	RawScore      float64         `json:"raw_score"`       // сумма баллов и штрафов по вопросам
+	Penalty       float64         `json:"penalty"`         // сумма штрафов за неверные ответы
+	ClampedToZero bool            `json:"clamped_to_zero"` // итог поднят до нуля
+	Score         float64         `json:"score"`
+	MaxScore      float64         `json:"max_score"`
+	Pending       int             `json:"pending"` // ответы, ожидающие ручной проверки
+}
+
+// Статусы вопроса в расшифровке балла
+const (
+	QuestionScoreCorrect    = "correct"
+	QuestionScorePartial    = "partial"
+	QuestionScoreWrong      = "wrong"
+	QuestionScoreUnanswered = "unanswered"
+	QuestionScorePending    = "pending"
+)
+
+// QuestionScore - вклад одного вопроса в итог попытки
+type QuestionScore struct {
+	QuestionID      int      `json:"question_id"`
+	QuestionVersion int      `json:"question_version"`
+	Weight          float64  `json:"weight"` // вес вопроса в тесте (переопределение или questions.points)
+	Points          *float64 `json:"points"` // начисленные баллы со штрафом, nil - ждет проверки
+	Penalty         float64  `json:"penalty,omitempty"`
+	Status          string   `json:"status"` // correct, partial, wrong, unanswered, pending
+}
+
+// AttemptQuestion - вопрос в наборе попытки: версия и порядок показа
+// фиксируются при старте попытки
+type AttemptQuestion struct {
 	AttemptID       int   `json:"attempt_id"`
 	QuestionID      int   `json:"question_id"`
 	QuestionVersion int   `json:"question_version"`
-	SelectedOption  int   `json:"selected_option"`
-	IsCorrect       *bool `json:"is_correct"` // nil - не проверено
+	Position        int   `json:"position"`
+	OptionOrder     []int `json:"option_order,omitempty"` // OptionOrder[i] - исходный индекс варианта, показанного i-м
+}
+
+type Answer struct {
+	ID              int      `json:"id"`
+	AttemptID       int      `json:"attempt_id"`
+	QuestionID      int      `json:"question_id"`
+	QuestionVersion int      `json:"question_version"`
+	SelectedOption  int      `json:"selected_option"`
+	SelectedOptions []int    `json:"selected_options,omitempty"` // для вопросов с несколькими вариантами
+	TextAnswer      *string  `json:"text_answer,omitempty"`      // для текстовых вопросов
+	NumericAnswer   *float64 `json:"numeric_answer,omitempty"`   // для числовых вопросов
+	IsCorrect       *bool    `json:"is_correct"`                 // nil - не проверено
+	PointsAwarded   *float64 `json:"points_awarded"`             // nil - попытка еще не завершена или ответ ждет проверки
+	ClientSeq       *int64   `json:"client_seq,omitempty"`       // порядковый номер сохранения на клиенте, защищает от устаревших автосохранений
+
+	// Ручная проверка (для развернутых ответов)
+	ReviewComment *string    `json:"review_comment,omitempty"`
+	ReviewedBy    *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// Статусы элемента пакетного сохранения ответов
+const (
+	AnswerResultSaved    = "saved"
+	AnswerResultStale    = "stale" // на сервере уже сохранен ответ с большим client_seq
+	AnswerResultRejected = "rejected"
+)
+
+// AnswerResult - результат сохранения одного ответа из пакета. Сам ответ не
+// возвращается: проверка ответа видна студенту только в разборе попытки
+type AnswerResult struct {
+	QuestionID int    `json:"question_id"`
+	ClientSeq  *int64 `json:"client_seq,omitempty"`
+	Status     string `json:"status"` // saved, stale, rejected
+	Error      string `json:"error,omitempty"`
+}
+
+// AnswerReview - вопрос попытки с ответом студента для разбора. Индексы вариантов
+// даны в порядке показа в попытке. Поля ключа и пояснений заполняются
+// только если их разрешает политика просмотра теста.
+type AnswerReview struct {
+	QuestionID      int      `json:"question_id"`
+	QuestionVersion int      `json:"question_version"`
+	Position        int      `json:"position"`
+	Title           string   `json:"title"`
+	Text            string   `json:"text"`
+	QuestionType    string   `json:"question_type"`
+	Options         []string `json:"options"`
+	Answered        bool     `json:"answered"`
+	SelectedOption  int      `json:"selected_option"`
+	SelectedOptions []int    `json:"selected_options,omitempty"`
+	TextAnswer      *string  `json:"text_answer,omitempty"`
+	NumericAnswer   *float64 `json:"numeric_answer,omitempty"`
+
+	// Проверка и ключ ответа (correct_answers и full)
+	IsCorrect       *bool    `json:"is_correct,omitempty"`
+	PointsAwarded   *float64 `json:"points_awarded,omitempty"`
+	ReviewComment   *string  `json:"review_comment,omitempty"`
+	CorrectOption   *int     `json:"correct_option,omitempty"`
+	CorrectOptions  []int    `json:"correct_options,omitempty"`
+	AcceptedAnswers []string `json:"accepted_answers,omitempty"`
+	CorrectNumeric  *float64 `json:"correct_numeric_answer,omitempty"`
+	Tolerance       float64  `json:"tolerance,omitempty"`
+	ToleranceType   string   `json:"tolerance_type,omitempty"`
+
+	// Пояснения (full)
+	Explanation        string   `json:"explanation,omitempty"`
+	OptionExplanations []string `json:"option_explanations,omitempty"`
+}
+
+// ReviewItem - ответ в очереди на ручную проверку
+type ReviewItem struct {
+	AnswerID        int       `json:"answer_id"`
+	AttemptID       int       `json:"attempt_id"`
+	TestID          int       `json:"test_id"`
+	TestTitle       string    `json:"test_title"`
+	UserID          int       `json:"user_id"`
+	StudentName     string    `json:"student_name"`
+	QuestionID      int       `json:"question_id"`
+	QuestionVersion int       `json:"question_version"`
+	QuestionText    string    `json:"question_text"`
+	MaxPoints       float64   `json:"max_points"`
+	TextAnswer      string    `json:"text_answer"`
+	AnsweredAt      time.Time `json:"answered_at"`
 }
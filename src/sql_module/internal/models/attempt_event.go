@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Типы событий прокторинга, которые клиент сообщает во время попытки
+const (
+	AttemptEventFocusLost      = "focus_lost"      // окно теста потеряло фокус
+	AttemptEventTabHidden      = "tab_hidden"      // вкладка скрыта (переключение вкладок, сворачивание)
+	AttemptEventFullscreenExit = "fullscreen_exit" // выход из полноэкранного режима
+	AttemptEventCopy           = "copy"
+	AttemptEventPaste          = "paste"
+	AttemptEventReconnect      = "reconnect" // клиент восстановил соединение
+)
+
+type AttemptEvent struct {
+	ID         int       `json:"id"`
+	AttemptID  int       `json:"attempt_id"`
+	EventType  string    `json:"event_type"`
+	OccurredAt time.Time `json:"occurred_at"` // время на клиенте, если передано, иначе время получения
+	RecordedAt time.Time `json:"recorded_at"` // время получения сервером
+	Details    *string   `json:"details,omitempty"`
+}
+
+// ProctoringSummary - сводка событий прокторинга по попытке
+type ProctoringSummary struct {
+	AttemptID  int            `json:"attempt_id"`
+	UserID     int            `json:"user_id"`
+	Counts     map[string]int `json:"counts"`     // число событий по типам
+	Suspicious int            `json:"suspicious"` // все события, кроме reconnect
+}
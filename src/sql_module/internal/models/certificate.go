@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Certificate - сертификат о прохождении теста. Имя студента, названия теста
+// и курса сохраняются на момент выдачи, чтобы проверка кода не зависела от переименований.
+type Certificate struct {
+	ID               int        `json:"id"`
+	TestID           int        `json:"test_id"`
+	UserID           int        `json:"user_id"`
+	AttemptID        int        `json:"attempt_id"` // попытка, после которой порог был пройден
+	VerificationCode string     `json:"verification_code"`
+	StudentName      string     `json:"student_name"`
+	TestTitle        string     `json:"test_title"`
+	CourseName       string     `json:"course_name"`
+	Score            float64    `json:"score"`
+	MaxScore         float64    `json:"max_score"`
+	Percentage       float64    `json:"percentage"`
+	PassingPercent   float64    `json:"passing_percent"` // порог теста на момент выдачи
+	IssuedAt         time.Time  `json:"issued_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"` // итог после пересчета больше не проходит порог
+}
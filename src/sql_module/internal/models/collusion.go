@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Признаки подозрительной пары попыток
+const (
+	CollusionFlagSharedErrors        = "improbable_shared_errors" // совпавших неверных ответов больше, чем объяснимо случаем
+	CollusionFlagHighErrorSimilarity = "high_error_similarity"    // совпавших ошибок не меньше, чем расхождений
+	CollusionFlagSynchronizedTiming  = "synchronized_timing"      // попытки шли одновременно и ответы давались синхронно
+)
+
+// CollusionReport - пары завершенных попыток теста с неслучайно совпадающими ошибками
+type CollusionReport struct {
+	TestID          int             `json:"test_id"`
+	Attempts        int             `json:"attempts"`       // завершенных попыток в сравнении
+	PairsCompared   int             `json:"pairs_compared"` // пар попыток разных студентов
+	MinSharedErrors int             `json:"min_shared_errors"`
+	MaxProbability  float64         `json:"max_probability"`
+	Pairs           []CollusionPair `json:"pairs"` // от самых маловероятных совпадений
+}
+
+// CollusionPair - пара попыток разных студентов. Для пары студентов
+// оставляется одна, самая подозрительная пара их попыток
+type CollusionPair struct {
+	AttemptA int `json:"attempt_a"`
+	UserA    int `json:"user_a"`
+	AttemptB int `json:"attempt_b"`
+	UserB    int `json:"user_b"`
+
+	CommonAnswered int `json:"common_answered"` // вопросы, на которые ответили оба
+	BothWrong      int `json:"both_wrong"`
+	IdenticalWrong int `json:"identical_wrong"` // одинаковые неверные ответы (EEIC)
+	Differences    int `json:"differences"`     // вопросы, где ответы различаются (D)
+
+	ErrorSimilarity        float64 `json:"error_similarity"`         // EEIC / D, при D = 0 делим на 1
+	ExpectedIdenticalWrong float64 `json:"expected_identical_wrong"` // ожидаемое число совпадений при независимых ответах
+	Probability            float64 `json:"probability"`              // вероятность случайно совпасть не меньше чем в IdenticalWrong
+
+	// Вторичный признак - время ответов (answered_at)
+	OverlappingAttempts bool     `json:"overlapping_attempts"` // попытки шли одновременно
+	TimingCorrelation   *float64 `json:"timing_correlation"`   // корреляция времени ответа от начала попытки, nil - мало общих вопросов
+	CloseInTime         int      `json:"close_in_time"`        // одинаковые ошибки, сделанные с разницей не больше минуты
+
+	Flags    []string            `json:"flags"`
+	Evidence []CollusionEvidence `json:"evidence"`
+}
+
+// CollusionEvidence - одинаковый неверный ответ пары
+type CollusionEvidence struct {
+	QuestionID      int       `json:"question_id"`
+	QuestionVersion int       `json:"question_version"`
+	Title           string    `json:"title"`
+	Answer          string    `json:"answer"`
+	AnswerRate      float64   `json:"answer_rate"` // доля этого ответа среди всех неверных ответов на вопрос
+	AnsweredAtA     time.Time `json:"answered_at_a"`
+	AnsweredAtB     time.Time `json:"answered_at_b"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ExportQuestion - столбец выгрузки с баллами за вопрос
+type ExportQuestion struct {
+	QuestionID int    `json:"question_id"`
+	Title      string `json:"title"` // по последней из встречавшихся в ответах версий
+}
+
+// ResultExportRow - строка выгрузки результатов теста: завершенная попытка студента
+type ResultExportRow struct {
+	AttemptID   int
+	UserID      int
+	FullName    string
+	Email       string
+	StartedAt   time.Time
+	CompletedAt *time.Time
+	Score       *float64
+	MaxScore    float64
+	Points      []*float64 // баллы по вопросам в порядке столбцов, nil - нет ответа или не оценен
+}
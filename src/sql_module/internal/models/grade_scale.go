@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// GradeScale - шкала оценок курса. Оценка - уровень с наибольшим порогом,
+// не превышающим процент набранных баллов
+type GradeScale struct {
+	CourseID  int          `json:"course_id"`
+	Name      string       `json:"name"`
+	Levels    []GradeLevel `json:"levels"` // по убыванию min_percent, нижний порог всегда 0
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type GradeLevel struct {
+	Grade      string  `json:"grade"`       // "5", "зачтено", "A"
+	MinPercent float64 `json:"min_percent"` // от 0 до 100
+}
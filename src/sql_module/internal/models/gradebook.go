@@ -0,0 +1,69 @@
+package models
+
+// Состояние студента по тесту в журнале оценок
+const (
+	GradebookNotStarted     = "not_started"
+	GradebookInProgress     = "in_progress"
+	GradebookAwaitingReview = "awaiting_review"
+	GradebookCompleted      = "completed"
+)
+
+// GradeCategory - категория оценок курса. Вес задает долю категории в итоговой
+// оценке; веса не обязаны давать в сумме 100, они нормируются
+type GradeCategory struct {
+	ID       int     `json:"id"`
+	CourseID int     `json:"course_id"`
+	Name     string  `json:"name"`
+	Weight   float64 `json:"weight"`
+	TestIDs  []int   `json:"test_ids"`
+}
+
+// Gradebook - журнал оценок курса: студенты по строкам, тесты по столбцам
+type Gradebook struct {
+	CourseID   int             `json:"course_id"`
+	Tests      []GradebookTest `json:"tests"`
+	Categories []GradeCategory `json:"categories"`
+	GradeScale *GradeScale     `json:"grade_scale"`
+	Students   []GradebookRow  `json:"students"`
+}
+
+type GradebookTest struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	IsActive   bool   `json:"is_active"`
+	CategoryID *int   `json:"category_id"` // nil - тест не входит ни в одну категорию
+}
+
+// GradebookRow - строка журнала. Ячейки идут в порядке Gradebook.Tests
+type GradebookRow struct {
+	UserID        int                     `json:"user_id"`
+	FullName      string                  `json:"full_name"`
+	Email         string                  `json:"email"`
+	Cells         []GradebookCell         `json:"cells"`
+	TotalScore    float64                 `json:"total_score"`     // сумма засчитанных баллов
+	TotalMaxScore float64                 `json:"total_max_score"` // сумма максимумов оцененных тестов
+	Percentage    *float64                `json:"percentage"`
+	Categories    []GradebookCategoryCell `json:"categories"`
+
+	// Итог по весам категорий (или по сумме баллов, если категорий нет)
+	FinalPercentage *float64 `json:"final_percentage"`
+	FinalGrade      *string  `json:"final_grade"`
+}
+
+// GradebookCell - засчитанный результат студента по тесту (test_results)
+type GradebookCell struct {
+	TestID        int      `json:"test_id"`
+	UserID        int      `json:"-"`
+	Status        string   `json:"status"` // not_started, in_progress, awaiting_review, completed
+	Score         *float64 `json:"score"`  // nil - засчитанного результата еще нет
+	MaxScore      *float64 `json:"max_score"`
+	Percentage    *float64 `json:"percentage"`
+	AttemptsCount int      `json:"attempts_count"` // попытки без отмененных
+}
+
+type GradebookCategoryCell struct {
+	CategoryID int      `json:"category_id"`
+	Score      float64  `json:"score"`
+	MaxScore   float64  `json:"max_score"`
+	Percentage *float64 `json:"percentage"` // nil - в категории нет оцененных тестов
+}
@@ -0,0 +1,47 @@
+package models
+
+// Признаки вопросов, которые стоит проверить
+const (
+	ItemFlagTooHard                = "too_hard"                // почти никто не отвечает верно
+	ItemFlagTooEasy                = "too_easy"                // почти все отвечают верно
+	ItemFlagLowDiscrimination      = "low_discrimination"      // верный ответ слабо связан с итогом
+	ItemFlagNegativeDiscrimination = "negative_discrimination" // сильные студенты ошибаются чаще слабых - возможно, ошибка в ключе
+	ItemFlagDistractorPreferred    = "distractor_preferred"    // неверный вариант выбирают чаще верного
+	ItemFlagHighOmitRate           = "high_omit_rate"
+)
+
+// ItemAnalysisReport - анализ вопросов по завершенным попыткам одного или нескольких тестов
+type ItemAnalysisReport struct {
+	TestIDs  []int          `json:"test_ids"`
+	Attempts int            `json:"attempts"` // число завершенных попыток в выборке
+	Items    []ItemAnalysis `json:"items"`
+}
+
+// ItemAnalysis - статистика одной версии вопроса
+type ItemAnalysis struct {
+	QuestionID      int    `json:"question_id"`
+	QuestionVersion int    `json:"question_version"`
+	Title           string `json:"title"`
+	QuestionType    string `json:"question_type"`
+	TestIDs         []int  `json:"test_ids"`  // тесты, в попытках которых был вопрос
+	Presented       int    `json:"presented"` // сколько раз вопрос попадал в попытку
+	Answered        int    `json:"answered"`
+	Correct         int    `json:"correct"`
+
+	Difficulty     *float64 `json:"difficulty"`     // p-value: доля верных ответов от показов, nil - нет показов
+	Discrimination *float64 `json:"discrimination"` // точечно-бисериальная корреляция с итогом попытки, nil - нет разброса
+	OmitRate       float64  `json:"omit_rate"`      // доля показов без ответа
+
+	Options []OptionAnalysis `json:"options,omitempty"` // только для single и multiple
+	Flags   []string         `json:"flags"`
+}
+
+// OptionAnalysis - как часто выбирали вариант ответа (анализ дистракторов)
+type OptionAnalysis struct {
+	Index     int      `json:"index"` // исходный индекс варианта в вопросе
+	Text      string   `json:"text"`
+	IsCorrect bool     `json:"is_correct"`
+	Count     int      `json:"count"`
+	Rate      float64  `json:"rate"`       // доля показов вопроса, в которых вариант выбран
+	MeanTotal *float64 `json:"mean_total"` // средний итог (в процентах) выбравших вариант
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Состояние освоения результата обучения
+const (
+	MasteryNotAssessed = "not_assessed" // вопросов по результату в завершенных попытках не было
+	MasteryNotMastered = "not_mastered"
+	MasteryMastered    = "mastered"
+)
+
+// LearningOutcome - результат обучения курса (навык, тема). Вопросы привязываются
+// к нему по id и проверяют его во всех своих версиях
+type LearningOutcome struct {
+	ID               int       `json:"id"`
+	CourseID         int       `json:"course_id"`
+	Code             string    `json:"code"` // короткое обозначение, уникально в курсе: "LO1", "derivatives"
+	Title            string    `json:"title"`
+	Description      string    `json:"description"`
+	MasteryThreshold float64   `json:"mastery_threshold"` // процент, с которого результат освоен
+	QuestionIDs      []int     `json:"question_ids"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// OutcomeMastery - освоение результата студентом по всем его завершенным
+// попыткам тестов курса: доля баллов за вопросы результата от их веса
+type OutcomeMastery struct {
+	OutcomeID int      `json:"outcome_id"`
+	Code      string   `json:"code"`
+	Title     string   `json:"title"`
+	Score     float64  `json:"score"`     // баллы за вопросы результата, без штрафов
+	MaxScore  float64  `json:"max_score"` // сумма весов этих вопросов
+	Mastery   *float64 `json:"mastery"`   // процент, nil - не оценивался
+	Status    string   `json:"status"`    // not_assessed, not_mastered, mastered
+	Evidence  int      `json:"evidence"`  // оцененные ответы на вопросы результата
+	Attempts  int      `json:"attempts"`  // попытки, в которых были такие вопросы
+}
+
+// StudentMastery - освоение результатов обучения курса одним студентом
+type StudentMastery struct {
+	CourseID int              `json:"course_id"`
+	UserID   int              `json:"user_id"`
+	FullName string           `json:"full_name"`
+	Email    string           `json:"email"`
+	Outcomes []OutcomeMastery `json:"outcomes"`
+}
+
+// CourseMasteryReport - освоение результатов обучения по всем студентам курса
+type CourseMasteryReport struct {
+	CourseID int              `json:"course_id"`
+	Outcomes []OutcomeSummary `json:"outcomes"`
+	Students []StudentMastery `json:"students"`
+}
+
+type OutcomeSummary struct {
+	OutcomeID        int      `json:"outcome_id"`
+	Code             string   `json:"code"`
+	Title            string   `json:"title"`
+	MasteryThreshold float64  `json:"mastery_threshold"`
+	Assessed         int      `json:"assessed"` // студенты, у которых результат оценивался
+	Mastered         int      `json:"mastered"`
+	NotMastered      int      `json:"not_mastered"`
+	MeanMastery      *float64 `json:"mean_mastery"` // по оцененным студентам
+}
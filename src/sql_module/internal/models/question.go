@@ -2,15 +2,48 @@ package models
 
 import "time"
 
+// Типы вопросов
+const (
+	QuestionTypeSingle   = "single"   // один правильный вариант
+	QuestionTypeMultiple = "multiple" // несколько правильных вариантов ("выберите все подходящие")
+	QuestionTypeText     = "text"     // короткий текстовый ответ, сверяется со списком допустимых
+	QuestionTypeNumeric  = "numeric"  // числовой ответ с допуском
+	QuestionTypeEssay    = "essay"    // развернутый ответ, оценивается преподавателем вручную
+)
+
+// Типы допуска для числовых ответов
+const (
+	ToleranceAbsolute = "absolute" // |ответ - эталон| <= tolerance
+	ToleranceRelative = "relative" // |ответ - эталон| <= |эталон| * tolerance
+)
+
 type Question struct {
-	ID            int       `json:"id"`
-	Title         string    `json:"title"`
-	Text          string    `json:"text"`
-	Options       []string  `json:"options"`        // ["Вариант 1", "Вариант 2"]
-	CorrectOption int       `json:"correct_option"` // 0 или 1
-	Points        int       `json:"points"`
-	AuthorID      int       `json:"author_id"`
-	Version       int       `json:"version"`
-	IsDeleted     bool      `json:"is_deleted"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID             int       `json:"id"`
+	Title          string    `json:"title"`
+	Text           string    `json:"text"`
+	QuestionType   string    `json:"question_type"`             // single, multiple, text, numeric, essay
+	Options        []string  `json:"options"`                   // ["Вариант 1", "Вариант 2"]
+	CorrectOption  int       `json:"correct_option"`            // 0 или 1
+	CorrectOptions []int     `json:"correct_options,omitempty"` // только для multiple
+	Points         int       `json:"points"`
+	AuthorID       int       `json:"author_id"`
+	Version        int       `json:"version"`
+	IsDeleted      bool      `json:"is_deleted"`
+	CreatedAt      time.Time `json:"created_at"`
+	Tags           []string  `json:"tags"` // теги для случайных наборов вопросов (пулов)
+
+	// Правила проверки текстовых ответов
+	AcceptedAnswers []string `json:"accepted_answers,omitempty"` // допустимые варианты ответа (или регулярки)
+	CaseSensitive   bool     `json:"case_sensitive,omitempty"`
+	NormalizeSpaces bool     `json:"normalize_spaces,omitempty"` // обрезать края и схлопывать повторяющиеся пробелы
+	UseRegex        bool     `json:"use_regex,omitempty"`        // accepted_answers - регулярные выражения
+
+	// Правила проверки числовых ответов
+	NumericAnswer *float64 `json:"numeric_answer,omitempty"`
+	Tolerance     float64  `json:"tolerance,omitempty"`
+	ToleranceType string   `json:"tolerance_type,omitempty"` // absolute или relative
+
+	// Пояснения, которые студент видит при разборе попытки
+	Explanation        string   `json:"explanation,omitempty"`
+	OptionExplanations []string `json:"option_explanations,omitempty"` // OptionExplanations[i] - почему вариант Options[i] верен или неверен
 }
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Regrade - запись журнала пересчета попыток после исправления ключа ответа
+type Regrade struct {
+	ID              int             `json:"id"`
+	TestID          *int            `json:"test_id,omitempty"`          // пересчет всего теста или вопроса только в этом тесте
+	QuestionID      *int            `json:"question_id,omitempty"`      // пересчет одного вопроса
+	QuestionVersion *int            `json:"question_version,omitempty"` // только ответы на эту версию вопроса
+	Reason          string          `json:"reason,omitempty"`
+	RegradedBy      int             `json:"regraded_by"`
+	CreatedAt       time.Time       `json:"created_at"`
+	Changes         []RegradeChange `json:"changes"`
+}
+
+// RegradeChange - балл попытки до и после пересчета
+type RegradeChange struct {
+	AttemptID   int      `json:"attempt_id"`
+	TestID      int      `json:"test_id"`
+	UserID      int      `json:"user_id"`
+	OldScore    *float64 `json:"old_score"` // nil - попытка еще не была оценена
+	NewScore    *float64 `json:"new_score"`
+	OldMaxScore float64  `json:"old_max_score"`
+	NewMaxScore float64  `json:"new_max_score"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// ResultsSummary - сводная статистика по завершенным попыткам теста
+type ResultsSummary struct {
+	Attempts       AttemptCounts  `json:"attempts"`
+	CompletionRate *float64       `json:"completion_rate"` // доля завершенных среди начатых, nil - попыток нет
+	Score          *ScoreStats    `json:"score"`           // по баллам, nil - нет завершенных попыток
+	Percentage     *ScoreStats    `json:"percentage"`      // по процентам от максимума попытки
+	Histogram      []HistogramBin `json:"histogram"`       // распределение процентов
+
+	AverageDurationSeconds *float64 `json:"average_duration_seconds"` // от started_at до completed_at
+
+	// Надежность теста по вопросам, которые были во всех завершенных попытках
+	CronbachAlpha *float64 `json:"cronbach_alpha"` // nil - меньше двух общих вопросов или попыток
+	AlphaItems    int      `json:"alpha_items"`
+}
+
+// AttemptCounts - число попыток теста по статусам
+type AttemptCounts struct {
+	Total          int `json:"total"`
+	InProgress     int `json:"in_progress"`
+	AwaitingReview int `json:"awaiting_review"`
+	Completed      int `json:"completed"`
+	Cancelled      int `json:"cancelled"`
+}
+
+type ScoreStats struct {
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	StdDev float64 `json:"std_dev"` // выборочное стандартное отклонение
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// HistogramBin - интервал процентов [From, To), последний интервал включает 100
+type HistogramBin struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
@@ -5,16 +5,44 @@ import (
 )
 
 type Test struct {
-	ID             int       `json:"id"`
-	Title          string    `json:"title"`
-	Description    string    `json:"description"`
-	CourseID       int       `json:"course_id"`
-	TeacherID      int       `json:"teacher_id"`
-	IsActive       bool      `json:"is_active"`
-	IsDeleted      bool      `json:"is_deleted"`
-	CreatedAt      time.Time `json:"created_at"`
-	QuestionIDs    []int     `json:"question_ids,omitempty"`    // Массив ID вопросов в порядке
-	QuestionsCount int       `json:"questions_count,omitempty"` // Количество вопросов (число)
+	ID               int       `json:"id"`
+	Title            string    `json:"title"`
+	Description      string    `json:"description"`
+	CourseID         int       `json:"course_id"`
+	TeacherID        int       `json:"teacher_id"`
+	IsActive         bool      `json:"is_active"`
+	IsDeleted        bool      `json:"is_deleted"`
+	CreatedAt        time.Time `json:"created_at"`
+	DurationMinutes  *int      `json:"duration_minutes"`          // лимит времени на попытку, nil - без ограничения
+	ScoringMode      string    `json:"scoring_mode"`              // all_or_nothing, proportional, proportional_penalty
+	MaxAttempts      *int      `json:"max_attempts"`              // nil - без ограничения числа попыток
+	CooldownMinutes  *int      `json:"cooldown_minutes"`          // пауза между попытками, nil - без паузы
+	ScorePolicy      string    `json:"score_policy"`              // best, last, first, average
+	ShuffleQuestions bool      `json:"shuffle_questions"`         // свой порядок вопросов в каждой попытке
+	ShuffleOptions   bool      `json:"shuffle_options"`           // свой порядок вариантов ответа в каждой попытке
+	QuestionIDs      []int     `json:"question_ids,omitempty"`    // Массив ID вопросов в порядке
+	QuestionsCount   int       `json:"questions_count,omitempty"` // Количество вопросов (число)
+
+	// Расписание: в opens_at тест активируется, в closes_at деактивируется автоматически
+	OpensAt  *time.Time `json:"opens_at"`
+	ClosesAt *time.Time `json:"closes_at"`
+
+	// Штрафы за неверные ответы
+	WrongAnswerPenalty float64 `json:"wrong_answer_penalty"` // доля веса вопроса, снимаемая за неверный ответ
+	ClampAtZero        bool    `json:"clamp_at_zero"`        // итог попытки не опускается ниже нуля
+
+	// Что студент видит после завершения попытки и когда
+	ReviewContent      string `json:"review_content"`      // score_only, correct_answers, full
+	ReviewAvailability string `json:"review_availability"` // immediate, after_close
+
+	// Порог прохождения в процентах от максимума, nil - без порога и сертификатов
+	PassingPercent *float64 `json:"passing_percent"`
+}
+
+// TestQuestionWeight - вес вопроса в конкретном тесте вместо questions.points
+type TestQuestionWeight struct {
+	QuestionID int     `json:"question_id"`
+	Weight     float64 `json:"weight"`
 }
 
 type TestQuestion struct {
@@ -23,3 +51,26 @@ type TestQuestion struct {
 	QuestionID int `json:"question_id"`
 	OrderIndex int `json:"order_index"`
 }
+
+// TestPoolRule - правило пула: сколько вопросов вытянуть с данным тегом
+type TestPoolRule struct {
+	ID             int    `json:"id"`
+	TestID         int    `json:"test_id"`
+	Tag            string `json:"tag"`
+	QuestionCount  int    `json:"question_count"`
+	WeightByPoints bool   `json:"weight_by_points"` // вероятность выбора пропорциональна баллам вопроса
+}
+
+// TestResult - итог студента по тесту с учетом политики повторных попыток (test_results)
+type TestResult struct {
+	TestID        int        `json:"test_id"`
+	UserID        int        `json:"user_id"`
+	Score         float64    `json:"score"`
+	MaxScore      float64    `json:"max_score"`
+	AttemptsCount int        `json:"attempts_count"`
+	CompletedAt   *time.Time `json:"completed_at"`
+	Percentage    *float64   `json:"percentage,omitempty"`
+	Grade         *string    `json:"grade,omitempty"`
+
+	Passed *bool `json:"passed,omitempty"` // nil - у теста нет порога прохождения
+}
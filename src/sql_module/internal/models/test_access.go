@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// TestAccess - ограничения на старт попыток экзамена с прокторингом.
+// Код доступа видит только преподаватель, поэтому он хранится отдельно от Test.
+type TestAccess struct {
+	TestID          int        `json:"test_id"`
+	AccessCode      *string    `json:"access_code"`      // nil - код не нужен
+	CodeRotatedAt   *time.Time `json:"code_rotated_at"`  // когда код последний раз меняли
+	AllowedNetworks []string   `json:"allowed_networks"` // CIDR, пусто - старт из любой сети
+}
+
+// Причины отказа в старте попытки
+const (
+	StartDenialNetwork     = "network_not_allowed" // IP клиента вне разрешенных сетей
+	StartDenialMissingCode = "missing_code"
+	StartDenialInvalidCode = "invalid_code"
+	StartDenialLockedOut   = "too_many_failures" // слишком много неверных кодов подряд
+)
+
+// StartDenial - запись журнала отказов в старте попытки
+type StartDenial struct {
+	ID        int       `json:"id"`
+	TestID    int       `json:"test_id"`
+	UserID    int       `json:"user_id"`
+	ClientIP  string    `json:"client_ip"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
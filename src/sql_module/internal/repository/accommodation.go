@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"database/sql"
+	"sql_module/internal/models"
+)
+
+// Допустимый множитель времени: от обычного до пятикратного
+const (
+	MinTimeMultiplier = 1.0
+	MaxTimeMultiplier = 5.0
+)
+
+const accommodationColumns = `id, user_id, course_id, test_id, time_multiplier, extra_attempts,
+                              COALESCE(note, ''), created_by, created_at, updated_at`
+
+func scanAccommodation(row rowScanner, a *models.Accommodation) error {
+	var courseID, testID sql.NullInt64
+	err := row.Scan(&a.ID, &a.UserID, &courseID, &testID, &a.TimeMultiplier, &a.ExtraAttempts,
+		&a.Note, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if courseID.Valid {
+		id := int(courseID.Int64)
+		a.CourseID = &id
+	}
+	if testID.Valid {
+		id := int(testID.Int64)
+		a.TestID = &id
+	}
+	return nil
+}
+
+// findAccommodation возвращает условия студента для теста: сначала заданные на тест,
+// затем на курс теста. nil - особых условий нет.
+func findAccommodation(q queryer, testID, userID int) (*models.Accommodation, error) {
+	query := `SELECT ` + accommodationColumns + `
+              FROM student_accommodations
+              WHERE user_id = $2
+                AND (test_id = $1 OR course_id = (SELECT course_id FROM tests WHERE id = $1))
+              ORDER BY test_id IS NULL
+              LIMIT 1`
+
+	var accommodation models.Accommodation
+	err := scanAccommodation(q.QueryRow(query, testID, userID), &accommodation)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &accommodation, nil
+}
+
+// GetAccommodations возвращает особые условия на курс и на его тесты
+func (r *CourseRepository) GetAccommodations(courseID int) ([]models.Accommodation, error) {
+	query := `SELECT ` + accommodationColumns + `
+              FROM student_accommodations
+              WHERE course_id = $1
+                 OR test_id IN (SELECT id FROM tests WHERE course_id = $1)
+              ORDER BY user_id, test_id NULLS FIRST`
+
+	rows, err := r.db.Query(query, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accommodations []models.Accommodation
+	for rows.Next() {
+		var accommodation models.Accommodation
+		if err := scanAccommodation(rows, &accommodation); err != nil {
+			return nil, err
+		}
+		accommodations = append(accommodations, accommodation)
+	}
+
+	return accommodations, rows.Err()
+}
+
+// GetAccommodation возвращает особые условия по ID или nil
+func (r *CourseRepository) GetAccommodation(id int) (*models.Accommodation, error) {
+	query := `SELECT ` + accommodationColumns + ` FROM student_accommodations WHERE id = $1`
+
+	var accommodation models.Accommodation
+	err := scanAccommodation(r.db.QueryRow(query, id), &accommodation)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &accommodation, nil
+}
+
+// SetAccommodation создает условия студента на курс или тест либо заменяет уже заданные.
+// Должен быть заполнен ровно один из CourseID и TestID.
+func (r *CourseRepository) SetAccommodation(a *models.Accommodation) error {
+	target := "(user_id, course_id) WHERE course_id IS NOT NULL"
+	if a.TestID != nil {
+		target = "(user_id, test_id) WHERE test_id IS NOT NULL"
+	}
+
+	query := `INSERT INTO student_accommodations
+                  (user_id, course_id, test_id, time_multiplier, extra_attempts, note, created_by)
+              VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+              ON CONFLICT ` + target + ` DO UPDATE
+              SET time_multiplier = EXCLUDED.time_multiplier,
+                  extra_attempts = EXCLUDED.extra_attempts,
+                  note = EXCLUDED.note,
+                  updated_at = CURRENT_TIMESTAMP
+              RETURNING ` + accommodationColumns
+
+	row := r.db.QueryRow(query, a.UserID, a.CourseID, a.TestID, a.TimeMultiplier,
+		a.ExtraAttempts, a.Note, a.CreatedBy)
+	return scanAccommodation(row, a)
+}
+
+// DeleteAccommodation удаляет особые условия. Попытки, в которых они уже
+// применились, сохраняют примененные значения.
+func (r *CourseRepository) DeleteAccommodation(id int) error {
+	result, err := r.db.Exec(`DELETE FROM student_accommodations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAccommodationUses возвращает все попытки теста, в которых применились особые условия,
+// включая незавершенные и отмененные
+func (r *AttemptRepository) GetAccommodationUses(testID int) ([]models.AttemptAccommodation, error) {
+	query := `SELECT id, user_id, accommodation_id, time_multiplier, extra_minutes, extra_attempt
+              FROM attempts
+              WHERE test_id = $1 AND (extra_minutes > 0 OR extra_attempt)
+              ORDER BY started_at, id`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uses []models.AttemptAccommodation
+	for rows.Next() {
+		var use models.AttemptAccommodation
+		var accommodationID sql.NullInt64
+		err := rows.Scan(&use.AttemptID, &use.UserID, &accommodationID,
+			&use.TimeMultiplier, &use.ExtraMinutes, &use.ExtraAttempt)
+		if err != nil {
+			return nil, err
+		}
+		if accommodationID.Valid {
+			id := int(accommodationID.Int64)
+			use.AccommodationID = &id
+		}
+		uses = append(uses, use)
+	}
+
+	return uses, rows.Err()
+}
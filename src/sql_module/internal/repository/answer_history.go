@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"database/sql"
+	"sort"
+	"sql_module/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Пороги признаков в отчете по времени
+const (
+	timingMinAttemptsToFlag = 5   // на меньшей выборке признаки не выставляем
+	timingSlowFactor        = 2   // медиана вопроса во столько раз больше медианы по тесту
+	timingRightToWrongRate  = 0.1 // доля попыток, где верный ответ сменили на неверный
+)
+
+// scanPreviousAnswer читает сохраненный ответ на вопрос, чтобы отличить
+// изменение ответа от повторного сохранения того же
+func scanPreviousAnswer(row rowScanner, id *int, clientSeq *sql.NullInt64) (*models.Answer, error) {
+	answer := &models.Answer{}
+	var selectedOption sql.NullInt64
+	var selectedOptions pq.Int64Array
+	var textAnswer sql.NullString
+	var numericAnswer sql.NullFloat64
+	err := row.Scan(id, clientSeq, &answer.QuestionVersion, &selectedOption, &selectedOptions,
+		&textAnswer, &numericAnswer)
+	if err != nil {
+		return nil, err
+	}
+
+	answer.SelectedOption = -1
+	if selectedOption.Valid {
+		answer.SelectedOption = int(selectedOption.Int64)
+	}
+	for _, option := range selectedOptions {
+		answer.SelectedOptions = append(answer.SelectedOptions, int(option))
+	}
+	if textAnswer.Valid {
+		answer.TextAnswer = &textAnswer.String
+	}
+	if numericAnswer.Valid {
+		answer.NumericAnswer = &numericAnswer.Float64
+	}
+	return answer, nil
+}
+
+func sameAnswerContent(a, b *models.Answer) bool {
+	if a.QuestionVersion != b.QuestionVersion || a.SelectedOption != b.SelectedOption {
+		return false
+	}
+	if len(a.SelectedOptions) != len(b.SelectedOptions) || !sameOptionSet(a.SelectedOptions, b.SelectedOptions) {
+		return false
+	}
+	if (a.TextAnswer == nil) != (b.TextAnswer == nil) || (a.TextAnswer != nil && *a.TextAnswer != *b.TextAnswer) {
+		return false
+	}
+	if (a.NumericAnswer == nil) != (b.NumericAnswer == nil) || (a.NumericAnswer != nil && *a.NumericAnswer != *b.NumericAnswer) {
+		return false
+	}
+	return true
+}
+
+// answerState - правильность ответа по текущему ключу вопроса
+func answerState(question *models.Question, answer *models.Answer) string {
+	switch {
+	case isAnswerOmitted(question, answer):
+		return models.AnswerStateOmitted
+	case needsManualGrading(question):
+		return models.AnswerStateUngraded
+	case isAnswerCorrect(question, answer):
+		return models.AnswerStateCorrect
+	}
+	return models.AnswerStateWrong
+}
+
+type answerHistoryEntry struct {
+	attemptID  int
+	key        questionKey
+	answer     *models.Answer
+	answeredAt time.Time
+}
+
+// loadAnswerHistory возвращает историю ответов попыток, выбранных attemptsQuery,
+// по порядку: попытка, время сохранения. Для ответов, сохраненных до появления
+// истории, берется только последний ответ из attempt_answers.
+func (r *AttemptRepository) loadAnswerHistory(attemptsQuery string, args ...interface{}) ([]answerHistoryEntry, map[questionKey]*models.Question, error) {
+	keysQuery := `SELECT question_id, question_version FROM attempt_answer_history
+                  WHERE attempt_id IN (` + attemptsQuery + `)
+                  UNION
+                  SELECT question_id, question_version FROM attempt_answers
+                  WHERE attempt_id IN (` + attemptsQuery + `)`
+	questions, err := loadQuestionVersions(r.db, keysQuery, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `SELECT attempt_id, question_id, question_version, selected_option, selected_options,
+                     text_answer, numeric_answer, answered_at, id
+              FROM attempt_answer_history
+              WHERE attempt_id IN (` + attemptsQuery + `)
+              UNION ALL
+              SELECT aa.attempt_id, aa.question_id, aa.question_version, aa.selected_option, aa.selected_options,
+                     aa.text_answer, aa.numeric_answer, aa.answered_at, 0
+              FROM attempt_answers aa
+              WHERE aa.attempt_id IN (` + attemptsQuery + `)
+                AND NOT EXISTS (SELECT 1 FROM attempt_answer_history h
+                                WHERE h.attempt_id = aa.attempt_id AND h.question_id = aa.question_id)
+              ORDER BY 1, 8, 9`
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var entries []answerHistoryEntry
+	for rows.Next() {
+		var entry answerHistoryEntry
+		var selectedOption sql.NullInt64
+		var selectedOptions pq.Int64Array
+		var textAnswer sql.NullString
+		var numericAnswer sql.NullFloat64
+		var id int
+		err := rows.Scan(&entry.attemptID, &entry.key.ID, &entry.key.Version, &selectedOption,
+			&selectedOptions, &textAnswer, &numericAnswer, &entry.answeredAt, &id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entry.answer = &models.Answer{SelectedOption: -1}
+		if selectedOption.Valid {
+			entry.answer.SelectedOption = int(selectedOption.Int64)
+		}
+		for _, option := range selectedOptions {
+			entry.answer.SelectedOptions = append(entry.answer.SelectedOptions, int(option))
+		}
+		if textAnswer.Valid {
+			entry.answer.TextAnswer = &textAnswer.String
+		}
+		if numericAnswer.Valid {
+			entry.answer.NumericAnswer = &numericAnswer.Float64
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, questions, rows.Err()
+}
+
+// GetAttemptTiming возвращает время и историю ответов по вопросам попытки
+func (r *AttemptRepository) GetAttemptTiming(attemptID int) (*models.AttemptTiming, error) {
+	timing := &models.AttemptTiming{AttemptID: attemptID}
+	var completedAt sql.NullTime
+	query := `SELECT test_id, user_id, started_at, completed_at FROM attempts WHERE id = $1`
+	err := r.db.QueryRow(query, attemptID).Scan(&timing.TestID, &timing.UserID, &timing.StartedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		timing.CompletedAt = &completedAt.Time
+	}
+
+	entries, questions, err := r.loadAnswerHistory(`SELECT $1::int`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	buildAttemptTiming(timing, entries, questions)
+	return timing, nil
+}
+
+// GetTestTiming сводит время и изменения ответов по вопросам завершенных попыток теста
+func (r *AttemptRepository) GetTestTiming(testID int) (*models.TestTimingReport, error) {
+	report := &models.TestTimingReport{TestID: testID, Questions: []models.QuestionTimingStats{}}
+
+	const attemptsQuery = `SELECT id FROM attempts WHERE test_id = $1 AND status = 'completed'`
+	query := `SELECT id, user_id, started_at, completed_at FROM attempts
+              WHERE test_id = $1 AND status = 'completed'
+              ORDER BY id`
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []*models.AttemptTiming
+	for rows.Next() {
+		timing := &models.AttemptTiming{TestID: testID}
+		var completedAt sql.NullTime
+		if err := rows.Scan(&timing.AttemptID, &timing.UserID, &timing.StartedAt, &completedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if completedAt.Valid {
+			timing.CompletedAt = &completedAt.Time
+		}
+		attempts = append(attempts, timing)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Attempts = len(attempts)
+	if len(attempts) == 0 {
+		return report, nil
+	}
+
+	entries, questions, err := r.loadAnswerHistory(attemptsQuery, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	type questionAccumulator struct {
+		stats models.QuestionTimingStats
+		times []float64
+	}
+	accumulators := make(map[questionKey]*questionAccumulator)
+
+	// Записи идут по попыткам, как и attempts
+	next := 0
+	for _, timing := range attempts {
+		start := next
+		for next < len(entries) && entries[next].attemptID == timing.AttemptID {
+			next++
+		}
+		buildAttemptTiming(timing, entries[start:next], questions)
+
+		for _, question := range timing.Questions {
+			key := questionKey{question.QuestionID, question.QuestionVersion}
+			acc, ok := accumulators[key]
+			if !ok {
+				acc = &questionAccumulator{stats: models.QuestionTimingStats{
+					QuestionID:      question.QuestionID,
+					QuestionVersion: question.QuestionVersion,
+					Title:           question.Title,
+					Flags:           []string{},
+				}}
+				accumulators[key] = acc
+			}
+
+			acc.times = append(acc.times, question.TimeSpentSeconds)
+			acc.stats.Changes += question.Changes
+			if question.Changes > 0 {
+				acc.stats.ChangedAttempts++
+			}
+			if question.RightToWrong > 0 {
+				acc.stats.RightToWrong++
+			}
+			if question.WrongToRight > 0 {
+				acc.stats.WrongToRight++
+			}
+		}
+	}
+
+	var medians []float64
+	for _, acc := range accumulators {
+		acc.stats.Attempts = len(acc.times)
+		acc.stats.MeanSeconds = round2(mean(acc.times))
+		acc.stats.MedianSeconds = round2(median(acc.times))
+		for _, t := range acc.times {
+			if t > acc.stats.MaxSeconds {
+				acc.stats.MaxSeconds = t
+			}
+		}
+		medians = append(medians, acc.stats.MedianSeconds)
+	}
+	report.MedianSeconds = round2(median(medians))
+
+	for _, acc := range accumulators {
+		stats := acc.stats
+		if stats.Attempts >= timingMinAttemptsToFlag {
+			if report.MedianSeconds > 0 && stats.MedianSeconds >= timingSlowFactor*report.MedianSeconds {
+				stats.Flags = append(stats.Flags, models.TimingFlagSlow)
+			}
+			if float64(stats.RightToWrong)/float64(stats.Attempts) >= timingRightToWrongRate {
+				stats.Flags = append(stats.Flags, models.TimingFlagRightToWrong)
+			}
+		}
+		report.Questions = append(report.Questions, stats)
+	}
+
+	sort.Slice(report.Questions, func(i, j int) bool {
+		a, b := report.Questions[i], report.Questions[j]
+		if a.QuestionID != b.QuestionID {
+			return a.QuestionID < b.QuestionID
+		}
+		return a.QuestionVersion < b.QuestionVersion
+	})
+
+	return report, nil
+}
+
+// buildAttemptTiming раскладывает время попытки по вопросам и собирает
+// историю ответов. entries - записи одной попытки по порядку сохранения
+func buildAttemptTiming(timing *models.AttemptTiming, entries []answerHistoryEntry, questions map[questionKey]*models.Question) {
+	timing.Questions = []models.QuestionTiming{}
+	index := make(map[questionKey]int)
+	lastGraded := make(map[questionKey]string)
+
+	previous := timing.StartedAt
+	for start := 0; start < len(entries); {
+		// Ответы, сохраненные одновременно (одним пакетом), делят промежуток поровну
+		end := start
+		group := make(map[questionKey]bool)
+		for end < len(entries) && entries[end].answeredAt.Equal(entries[start].answeredAt) {
+			group[entries[end].key] = true
+			end++
+		}
+
+		gap := entries[start].answeredAt.Sub(previous).Seconds()
+		if gap < 0 {
+			gap = 0
+		}
+		share := gap / float64(len(group))
+		previous = entries[start].answeredAt
+
+		for _, entry := range entries[start:end] {
+			question, ok := questions[entry.key]
+			if !ok {
+				continue
+			}
+
+			i, ok := index[entry.key]
+			if !ok {
+				i = len(timing.Questions)
+				index[entry.key] = i
+				timing.Questions = append(timing.Questions, models.QuestionTiming{
+					QuestionID:      entry.key.ID,
+					QuestionVersion: entry.key.Version,
+					Title:           question.Title,
+					FirstAnsweredAt: entry.answeredAt,
+					History:         []models.AnswerChange{},
+				})
+			} else {
+				timing.Questions[i].Changes++
+				timing.Changes++
+			}
+
+			questionTiming := &timing.Questions[i]
+			if group[entry.key] {
+				questionTiming.TimeSpentSeconds += share
+				group[entry.key] = false
+			}
+			questionTiming.LastAnsweredAt = entry.answeredAt
+
+			state := answerState(question, entry.answer)
+			change := models.AnswerChange{AnsweredAt: entry.answeredAt, State: state}
+			if state != models.AnswerStateOmitted {
+				change.Answer = displayResponse(question, entry.answer)
+			}
+			questionTiming.History = append(questionTiming.History, change)
+			questionTiming.FinalState = state
+
+			// Переходы считаем между проверяемыми ответами; стертый ответ их не прерывает
+			if state == models.AnswerStateCorrect || state == models.AnswerStateWrong {
+				switch lastGraded[entry.key] + "->" + state {
+				case models.AnswerStateCorrect + "->" + models.AnswerStateWrong:
+					questionTiming.RightToWrong++
+					timing.RightToWrong++
+				case models.AnswerStateWrong + "->" + models.AnswerStateCorrect:
+					questionTiming.WrongToRight++
+					timing.WrongToRight++
+				}
+				lastGraded[entry.key] = state
+			}
+		}
+
+		start = end
+	}
+
+	for i := range timing.Questions {
+		timing.Questions[i].TimeSpentSeconds = round2(timing.Questions[i].TimeSpentSeconds)
+	}
+
+	if timing.CompletedAt != nil {
+		duration := round2(timing.CompletedAt.Sub(timing.StartedAt).Seconds())
+		unattributed := round2(timing.CompletedAt.Sub(previous).Seconds())
+		if unattributed < 0 {
+			unattributed = 0
+		}
+		timing.DurationSeconds = &duration
+		timing.UnattributedSeconds = &unattributed
+	}
+}
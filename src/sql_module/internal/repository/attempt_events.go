@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"sql_module/internal/models"
+	"time"
+)
+
+func IsValidAttemptEvent(eventType string) bool {
+	switch eventType {
+	case models.AttemptEventFocusLost, models.AttemptEventTabHidden, models.AttemptEventFullscreenExit,
+		models.AttemptEventCopy, models.AttemptEventPaste, models.AttemptEventReconnect:
+		return true
+	}
+	return false
+}
+
+// isSuspiciousEvent - событие, которое может говорить о списывании.
+// Переподключение - сетевая проблема, его только показываем в хронологии.
+func isSuspiciousEvent(eventType string) bool {
+	return eventType != models.AttemptEventReconnect
+}
+
+// RecordAttemptEvents сохраняет события прокторинга попытки. События принимаются,
+// пока попытка идет; время на клиенте (OccurredAt) необязательно.
+func (r *AttemptRepository) RecordAttemptEvents(attemptID int, events []models.AttemptEvent) ([]models.AttemptEvent, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow(`SELECT status FROM attempts WHERE id = $1 FOR SHARE`, attemptID).Scan(&status)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != "in_progress" {
+		return nil, &AttemptError{Message: "Attempt is not in progress"}
+	}
+
+	insertQuery := `INSERT INTO attempt_events (attempt_id, event_type, occurred_at, details)
+                    VALUES ($1, $2, COALESCE($3, CURRENT_TIMESTAMP), $4)
+                    RETURNING id, occurred_at, recorded_at`
+	for i := range events {
+		events[i].AttemptID = attemptID
+
+		var occurredAt *time.Time
+		if !events[i].OccurredAt.IsZero() {
+			occurredAt = &events[i].OccurredAt
+		}
+
+		err := tx.QueryRow(insertQuery, attemptID, events[i].EventType, occurredAt, events[i].Details).
+			Scan(&events[i].ID, &events[i].OccurredAt, &events[i].RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetAttemptEvents возвращает хронологию событий попытки
+func (r *AttemptRepository) GetAttemptEvents(attemptID int) ([]models.AttemptEvent, error) {
+	query := `SELECT id, attempt_id, event_type, occurred_at, recorded_at, details
+              FROM attempt_events
+              WHERE attempt_id = $1
+              ORDER BY occurred_at, id`
+
+	rows, err := r.db.Query(query, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AttemptEvent
+	for rows.Next() {
+		var event models.AttemptEvent
+		var details sql.NullString
+		err := rows.Scan(&event.ID, &event.AttemptID, &event.EventType,
+			&event.OccurredAt, &event.RecordedAt, &details)
+		if err != nil {
+			return nil, err
+		}
+		if details.Valid {
+			event.Details = &details.String
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// GetProctoringSummary считает события прокторинга по попыткам теста.
+// Попытки без событий в сводку не попадают.
+func (r *AttemptRepository) GetProctoringSummary(testID int) ([]models.ProctoringSummary, error) {
+	query := `SELECT a.id, a.user_id, e.event_type, COUNT(*)
+              FROM attempt_events e
+              JOIN attempts a ON a.id = e.attempt_id
+              WHERE a.test_id = $1
+              GROUP BY a.id, a.user_id, e.event_type
+              ORDER BY a.id, e.event_type`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []models.ProctoringSummary
+	for rows.Next() {
+		var attemptID, userID, count int
+		var eventType string
+		if err := rows.Scan(&attemptID, &userID, &eventType, &count); err != nil {
+			return nil, err
+		}
+
+		if len(summaries) == 0 || summaries[len(summaries)-1].AttemptID != attemptID {
+			summaries = append(summaries, models.ProctoringSummary{
+				AttemptID: attemptID,
+				UserID:    userID,
+				Counts:    make(map[string]int),
+			})
+		}
+
+		summary := &summaries[len(summaries)-1]
+		summary.Counts[eventType] = count
+		if isSuspiciousEvent(eventType) {
+			summary.Suspicious += count
+		}
+	}
+
+	return summaries, rows.Err()
+}
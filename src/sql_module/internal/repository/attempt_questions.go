@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sql_module/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// snapshotItem - вопрос-кандидат в набор попытки
+type snapshotItem struct {
+	question     models.AttemptQuestion
+	questionType string
+	optionsCount int
+	points       int
+}
+
+// snapshotAttemptQuestions фиксирует набор вопросов попытки: текущие версии вопросов
+// теста (или вытянутые по правилам пула), порядок их показа и порядок вариантов ответа
+func snapshotAttemptQuestions(tx *sql.Tx, attemptID, testID int, shuffleQuestions, shuffleOptions bool) error {
+	rules, err := loadPoolRules(tx, testID)
+	if err != nil {
+		return err
+	}
+
+	var items []snapshotItem
+	if len(rules) > 0 {
+		items, err = drawPoolQuestions(tx, testID, rules)
+	} else {
+		items, err = loadSnapshotItems(tx, `SELECT q.id, q.version, q.question_type,
+                                                   COALESCE(array_length(q.options, 1), 0), q.points
+                                            FROM test_questions tq
+                                            JOIN questions q ON q.id = tq.question_id
+                                            WHERE tq.test_id = $1 AND q.is_deleted = false
+                                              AND q.version = (SELECT MAX(version) FROM questions WHERE id = tq.question_id)
+                                            ORDER BY tq.order_index`, testID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if shuffleQuestions {
+		rand.Shuffle(len(items), func(i, j int) {
+			items[i], items[j] = items[j], items[i]
+		})
+	}
+
+	insertQuery := `INSERT INTO attempt_questions (attempt_id, question_id, question_version, position, option_order)
+                    VALUES ($1, $2, $3, $4, $5)`
+	for i, item := range items {
+		var optionOrder []int
+		if shuffleOptions && hasOptions(item.questionType) && item.optionsCount > 1 {
+			optionOrder = rand.Perm(item.optionsCount)
+		}
+
+		_, err := tx.Exec(insertQuery, attemptID, item.question.QuestionID,
+			item.question.QuestionVersion, i, pq.Array(optionOrder))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadSnapshotItems(tx *sql.Tx, query string, args ...interface{}) ([]snapshotItem, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []snapshotItem
+	for rows.Next() {
+		var item snapshotItem
+		err := rows.Scan(&item.question.QuestionID, &item.question.QuestionVersion,
+			&item.questionType, &item.optionsCount, &item.points)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// drawPoolQuestions тянет вопросы по правилам пула. Кандидаты - актуальные версии
+// вопросов преподавателя теста с нужным тегом; один вопрос не попадает в набор дважды.
+func drawPoolQuestions(tx *sql.Tx, testID int, rules []models.TestPoolRule) ([]snapshotItem, error) {
+	candidatesQuery := `SELECT q.id, q.version, q.question_type,
+                               COALESCE(array_length(q.options, 1), 0), q.points
+                        FROM questions q
+                        JOIN tests t ON t.id = $1
+                        WHERE q.author_id = t.teacher_id AND q.is_deleted = false
+                          AND $2 = ANY(q.tags)
+                          AND q.version = (SELECT MAX(version) FROM questions WHERE id = q.id)
+                        ORDER BY q.id`
+
+	drawn := make(map[int]bool)
+	var result []snapshotItem
+	for _, rule := range rules {
+		candidates, err := loadSnapshotItems(tx, candidatesQuery, testID, rule.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		available := candidates[:0]
+		for _, candidate := range candidates {
+			if !drawn[candidate.question.QuestionID] {
+				available = append(available, candidate)
+			}
+		}
+
+		if len(available) < rule.QuestionCount {
+			return nil, &AttemptError{Message: fmt.Sprintf("Not enough questions with tag %q: need %d, available %d",
+				rule.Tag, rule.QuestionCount, len(available))}
+		}
+
+		for _, item := range sampleItems(available, rule.QuestionCount, rule.WeightByPoints) {
+			drawn[item.question.QuestionID] = true
+			result = append(result, item)
+		}
+	}
+
+	return result, nil
+}
+
+// sampleItems выбирает n элементов без повторов. С весами используется схема
+// Efraimidis-Spirakis: ключ u^(1/w), берутся n наибольших ключей.
+func sampleItems(items []snapshotItem, n int, weightByPoints bool) []snapshotItem {
+	keys := make([]float64, len(items))
+	for i, item := range items {
+		weight := 1.0
+		if weightByPoints && item.points > 0 {
+			weight = float64(item.points)
+		}
+		keys[i] = math.Pow(rand.Float64(), 1/weight)
+	}
+
+	indexes := make([]int, len(items))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		return keys[indexes[a]] > keys[indexes[b]]
+	})
+
+	result := make([]snapshotItem, n)
+	for i := 0; i < n; i++ {
+		result[i] = items[indexes[i]]
+	}
+	return result
+}
+
+// hasOptions - вопрос с выбором из вариантов
+func hasOptions(questionType string) bool {
+	return questionType == models.QuestionTypeSingle || questionType == models.QuestionTypeMultiple
+}
+
+// attemptSnapshotEntry возвращает вопрос из набора попытки, nil - вопроса в наборе нет
+func attemptSnapshotEntry(q queryer, attemptID, questionID int) (*models.AttemptQuestion, error) {
+	var entry models.AttemptQuestion
+	var order pq.Int64Array
+	query := `SELECT attempt_id, question_id, question_version, position, option_order
+              FROM attempt_questions WHERE attempt_id = $1 AND question_id = $2`
+	err := q.QueryRow(query, attemptID, questionID).Scan(&entry.AttemptID, &entry.QuestionID,
+		&entry.QuestionVersion, &entry.Position, &order)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	entry.OptionOrder = intsFromArray(order)
+	return &entry, nil
+}
+
+// mapDisplayedOptions переводит индексы вариантов из порядка показа в исходные
+func mapDisplayedOptions(answer *models.Answer, order []int) {
+	if len(order) == 0 {
+		return
+	}
+
+	if answer.SelectedOption >= 0 && answer.SelectedOption < len(order) {
+		answer.SelectedOption = order[answer.SelectedOption]
+	}
+
+	if len(answer.SelectedOptions) > 0 {
+		selected := make([]int, len(answer.SelectedOptions))
+		for i, option := range answer.SelectedOptions {
+			selected[i] = order[option]
+		}
+		answer.SelectedOptions = normalizeOptions(selected)
+	}
+}
+
+// applyOptionOrder переставляет варианты вопроса в порядок показа
+// и пересчитывает под него индексы правильных вариантов
+func applyOptionOrder(question *models.Question, order []int) {
+	if len(order) != len(question.Options) {
+		return
+	}
+
+	displayed := make([]int, len(order))
+	options := make([]string, len(order))
+	for i, canonical := range order {
+		options[i] = question.Options[canonical]
+		displayed[canonical] = i
+	}
+	question.Options = options
+
+	if len(question.OptionExplanations) == len(order) {
+		explanations := make([]string, len(order))
+		for i, canonical := range order {
+			explanations[i] = question.OptionExplanations[canonical]
+		}
+		question.OptionExplanations = explanations
+	}
+
+	if question.CorrectOption >= 0 && question.CorrectOption < len(displayed) {
+		question.CorrectOption = displayed[question.CorrectOption]
+	}
+
+	if len(question.CorrectOptions) > 0 {
+		correct := make([]int, 0, len(question.CorrectOptions))
+		for _, option := range question.CorrectOptions {
+			if option >= 0 && option < len(displayed) {
+				correct = append(correct, displayed[option])
+			}
+		}
+		sort.Ints(correct)
+		question.CorrectOptions = correct
+	}
+}
+
+// GetAttemptQuestionSet возвращает зафиксированный набор вопросов попытки в порядке показа
+func (r *AttemptRepository) GetAttemptQuestionSet(attemptID int) ([]models.AttemptQuestion, error) {
+	return loadAttemptQuestionSet(r.db, attemptID)
+}
+
+func loadAttemptQuestionSet(q queryer, attemptID int) ([]models.AttemptQuestion, error) {
+	query := `SELECT attempt_id, question_id, question_version, position, option_order
+              FROM attempt_questions
+              WHERE attempt_id = $1
+              ORDER BY position`
+
+	rows, err := q.Query(query, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var set []models.AttemptQuestion
+	for rows.Next() {
+		var item models.AttemptQuestion
+		var order pq.Int64Array
+		err := rows.Scan(&item.AttemptID, &item.QuestionID, &item.QuestionVersion, &item.Position, &order)
+		if err != nil {
+			return nil, err
+		}
+		item.OptionOrder = intsFromArray(order)
+		set = append(set, item)
+	}
+
+	return set, rows.Err()
+}
+
+// loadAttemptQuestions возвращает вопросы попытки в том виде, в каком их видит студент:
+// в порядке попытки и с переставленными вариантами ответа
+func loadAttemptQuestions(q queryer, attemptID int) ([]models.Question, error) {
+	set, err := loadAttemptQuestionSet(q, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := loadQuestionVersions(q, `SELECT question_id, question_version
+                                              FROM attempt_questions WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Question, 0, len(set))
+	for _, item := range set {
+		question, ok := questions[questionKey{item.QuestionID, item.QuestionVersion}]
+		if !ok {
+			continue
+		}
+		displayed := *question
+		applyOptionOrder(&displayed, item.OptionOrder)
+		result = append(result, displayed)
+	}
+
+	return result, nil
+}
@@ -2,8 +2,13 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
 	"sql_module/internal/models"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type AttemptRepository struct {
@@ -34,35 +39,147 @@ func (r *AttemptRepository) StartAttempt(testID, userID int) (*models.Attempt, e
 		return nil, err
 	}
 
-	query := `INSERT INTO attempts (test_id, user_id, status, started_at) 
-              VALUES ($1, $2, 'in_progress', CURRENT_TIMESTAMP) 
-              RETURNING id, started_at`
+	var duration, maxAttempts, cooldown sql.NullInt64
+	var notOpenYet, closed bool
+	settingsQuery := `SELECT duration_minutes, max_attempts, cooldown_minutes,
+                             COALESCE(opens_at > CURRENT_TIMESTAMP, false),
+                             COALESCE(closes_at <= CURRENT_TIMESTAMP, false)
+                      FROM tests WHERE id = $1`
+	err = r.db.QueryRow(settingsQuery, testID).Scan(&duration, &maxAttempts, &cooldown, &notOpenYet, &closed)
+	if err != nil {
+		return nil, err
+	}
+
+	if notOpenYet {
+		return nil, &AttemptError{Message: "Test is not open yet"}
+	}
+
+	if closed {
+		return nil, &AttemptError{Message: "Test is closed"}
+	}
+
+	// Отмененные попытки не расходуют лимит
+	var used int
+	var nextAllowed sql.NullTime
+	var coolingDown bool
+	limitQuery := `SELECT COUNT(*),
+                          MAX(completed_at) + $3::int * INTERVAL '1 minute',
+                          COALESCE(MAX(completed_at) + $3::int * INTERVAL '1 minute' > CURRENT_TIMESTAMP, false)
+                   FROM attempts
+                   WHERE test_id = $1 AND user_id = $2 AND status <> 'cancelled'`
+	err = r.db.QueryRow(limitQuery, testID, userID, cooldown).Scan(&used, &nextAllowed, &coolingDown)
+	if err != nil {
+		return nil, err
+	}
+
+	accommodation, err := findAccommodation(r.db, testID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Особые условия добавляют попытки к лимиту и время к длительности.
+	// В попытку записываем только то, что действительно применилось.
+	applied := models.AttemptAccommodation{TimeMultiplier: 1}
+	if maxAttempts.Valid {
+		limit := maxAttempts.Int64
+		if accommodation != nil {
+			limit += int64(accommodation.ExtraAttempts)
+		}
+		if int64(used) >= limit {
+			return nil, &AttemptError{Message: fmt.Sprintf("Attempt limit reached: %d of %d attempts used", used, limit)}
+		}
+		applied.ExtraAttempt = int64(used) >= maxAttempts.Int64
+	}
+
+	if accommodation != nil && duration.Valid && accommodation.TimeMultiplier > 1 {
+		extended := int64(math.Ceil(float64(duration.Int64) * accommodation.TimeMultiplier))
+		applied.ExtraMinutes = int(extended - duration.Int64)
+		applied.TimeMultiplier = accommodation.TimeMultiplier
+		duration.Int64 = extended
+	}
+
+	var accommodationID *int
+	if applied.ExtraAttempt || applied.ExtraMinutes > 0 {
+		accommodationID = &accommodation.ID
+	}
+
+	if coolingDown && nextAllowed.Valid {
+		return nil, &AttemptError{Message: "Next attempt is available after " + nextAllowed.Time.Format("2006-01-02 15:04:05")}
+	}
+
+	var shuffleQuestions, shuffleOptions bool
+	shuffleQuery := `SELECT shuffle_questions, shuffle_options FROM tests WHERE id = $1`
+	err = r.db.QueryRow(shuffleQuery, testID).Scan(&shuffleQuestions, &shuffleOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Дедлайн считаем на стороне БД, чтобы он был в том же времени, что и started_at
+	query := `INSERT INTO attempts (test_id, user_id, status, started_at, deadline,
+                                    accommodation_id, time_multiplier, extra_minutes, extra_attempt)
+              VALUES ($1, $2, 'in_progress', CURRENT_TIMESTAMP,
+                      CURRENT_TIMESTAMP + $3::int * INTERVAL '1 minute', $4, $5, $6, $7)
+              RETURNING id, started_at, deadline`
 
 	var attempt models.Attempt
-	err = r.db.QueryRow(query, testID, userID).Scan(
+	var deadline sql.NullTime
+	err = tx.QueryRow(query, testID, userID, duration, accommodationID,
+		applied.TimeMultiplier, applied.ExtraMinutes, applied.ExtraAttempt).Scan(
 		&attempt.ID,
 		&attempt.StartedAt,
+		&deadline,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := snapshotAttemptQuestions(tx, attempt.ID, testID, shuffleQuestions, shuffleOptions); err != nil {
+		return nil, err
+	}
+
+	attempt.MaxScore, err = updateAttemptMaxScore(tx, attempt.ID, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	attempt.TestID = testID
 	attempt.UserID = userID
 	attempt.Status = "in_progress"
+	if deadline.Valid {
+		attempt.Deadline = &deadline.Time
+	}
+	if accommodationID != nil {
+		applied.AttemptID = attempt.ID
+		applied.UserID = userID
+		applied.AccommodationID = accommodationID
+		attempt.Accommodation = &applied
+	}
 
 	return &attempt, nil
 }
 
-func (r *AttemptRepository) GetAttemptByID(id int) (*models.Attempt, error) {
-	query := `SELECT id, test_id, user_id, status, score, started_at, completed_at
-              FROM attempts WHERE id = $1`
+const attemptColumns = `id, test_id, user_id, status, score, started_at, completed_at, deadline, max_score,
+                      score_breakdown, accommodation_id, time_multiplier, extra_minutes, extra_attempt`
 
-	var attempt models.Attempt
+func scanAttempt(row rowScanner, attempt *models.Attempt) error {
 	var score sql.NullFloat64
 	var completedAt sql.NullTime
+	var deadline sql.NullTime
+	var breakdown sql.NullString
+	var accommodationID sql.NullInt64
+	var applied models.AttemptAccommodation
 
-	err := r.db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&attempt.ID,
 		&attempt.TestID,
 		&attempt.UserID,
@@ -70,13 +187,33 @@ func (r *AttemptRepository) GetAttemptByID(id int) (*models.Attempt, error) {
 		&score,
 		&attempt.StartedAt,
 		&completedAt,
+		&deadline,
+		&attempt.MaxScore,
+		&breakdown,
+		&accommodationID,
+		&applied.TimeMultiplier,
+		&applied.ExtraMinutes,
+		&applied.ExtraAttempt,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
+		return err
+	}
+
+	if applied.ExtraMinutes > 0 || applied.ExtraAttempt {
+		applied.AttemptID = attempt.ID
+		applied.UserID = attempt.UserID
+		if accommodationID.Valid {
+			id := int(accommodationID.Int64)
+			applied.AccommodationID = &id
+		}
+		attempt.Accommodation = &applied
+	}
+
+	if breakdown.Valid {
+		attempt.ScoreBreakdown = &models.ScoreBreakdown{}
+		if err := json.Unmarshal([]byte(breakdown.String), attempt.ScoreBreakdown); err != nil {
+			return err
 		}
-		return nil, err
 	}
 
 	if score.Valid {
@@ -87,29 +224,37 @@ func (r *AttemptRepository) GetAttemptByID(id int) (*models.Attempt, error) {
 		attempt.CompletedAt = &completedAt.Time
 	}
 
+	if deadline.Valid {
+		attempt.Deadline = &deadline.Time
+	}
+
+	return nil
+}
+
+func (r *AttemptRepository) GetAttemptByID(id int) (*models.Attempt, error) {
+	query := `SELECT ` + attemptColumns + `
+              FROM attempts WHERE id = $1`
+
+	var attempt models.Attempt
+	err := scanAttempt(r.db.QueryRow(query, id), &attempt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
 	return &attempt, nil
 }
 
 func (r *AttemptRepository) GetUserAttempt(testID, userID int) (*models.Attempt, error) {
-	query := `SELECT id, test_id, user_id, status, score, started_at, completed_at
+	query := `SELECT ` + attemptColumns + `
               FROM attempts 
               WHERE test_id = $1 AND user_id = $2
               ORDER BY started_at DESC LIMIT 1`
 
 	var attempt models.Attempt
-	var score sql.NullFloat64
-	var completedAt sql.NullTime
-
-	err := r.db.QueryRow(query, testID, userID).Scan(
-		&attempt.ID,
-		&attempt.TestID,
-		&attempt.UserID,
-		&attempt.Status,
-		&score,
-		&attempt.StartedAt,
-		&completedAt,
-	)
-
+	err := scanAttempt(r.db.QueryRow(query, testID, userID), &attempt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -117,14 +262,6 @@ func (r *AttemptRepository) GetUserAttempt(testID, userID int) (*models.Attempt,
 		return nil, err
 	}
 
-	if score.Valid {
-		attempt.Score = &score.Float64
-	}
-
-	if completedAt.Valid {
-		attempt.CompletedAt = &completedAt.Time
-	}
-
 	return &attempt, nil
 }
 
@@ -198,72 +335,255 @@ func (r *AttemptRepository) GetUserAttempt(testID, userID int) (*models.Attempt,
 // 	return answer, nil
 // }
 
-func (r *AttemptRepository) SubmitAnswer(attemptID, questionID, questionVersion, selectedOption int) (*models.Answer, error) {
-	var status string
-	checkQuery := `SELECT status FROM attempts WHERE id = $1`
-	err := r.db.QueryRow(checkQuery, attemptID).Scan(&status)
+func (r *AttemptRepository) SubmitAnswer(answer *models.Answer) (*models.Answer, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	if err := lockAnswerableAttempt(tx, answer.AttemptID); err != nil {
+		return nil, err
+	}
+
+	saved, err := saveAnswer(tx, answer)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, &AttemptError{Message: "A newer answer to this question has already been saved"}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return answer, nil
+}
+
+// SubmitAnswers сохраняет пакет ответов попытки в одной транзакции. Ошибка в
+// отдельном ответе не отменяет остальные - она возвращается в результате этого
+// ответа; ответы с устаревшим client_seq пропускаются.
+func (r *AttemptRepository) SubmitAnswers(attemptID int, answers []models.Answer) ([]models.AnswerResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockAnswerableAttempt(tx, attemptID); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.AnswerResult, 0, len(answers))
+	for i := range answers {
+		answer := &answers[i]
+		answer.AttemptID = attemptID
+
+		result := models.AnswerResult{
+			QuestionID: answer.QuestionID,
+			ClientSeq:  answer.ClientSeq,
+		}
+
+		saved, err := saveAnswer(tx, answer)
+		if attemptErr, ok := err.(*AttemptError); ok {
+			result.Status = models.AnswerResultRejected
+			result.Error = attemptErr.Message
+		} else if err != nil {
+			return nil, err
+		} else if !saved {
+			result.Status = models.AnswerResultStale
+		} else {
+			result.Status = models.AnswerResultSaved
+		}
+
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// lockAnswerableAttempt блокирует попытку до конца транзакции и проверяет,
+// что в нее еще можно записывать ответы
+func lockAnswerableAttempt(tx *sql.Tx, attemptID int) error {
+	var status string
+	var expired bool
+	checkQuery := `SELECT status, COALESCE(deadline < CURRENT_TIMESTAMP, false)
+                   FROM attempts WHERE id = $1 FOR UPDATE`
+	err := tx.QueryRow(checkQuery, attemptID).Scan(&status, &expired)
+	if err != nil {
+		return err
+	}
 
 	if status != "in_progress" {
-		return nil, &AttemptError{Message: "Attempt is not in progress"}
+		return &AttemptError{Message: "Attempt is not in progress"}
+	}
+
+	if expired {
+		return &AttemptError{Message: "Time limit for this attempt has expired"}
+	}
+
+	return nil
+}
+
+// saveAnswer проверяет ответ и записывает его в попытку. Возвращает false, если
+// ответ не записан, потому что на сервере уже есть ответ с большим или равным client_seq.
+// Ошибки проверки (AttemptError) возникают до любых изменений в базе.
+func saveAnswer(tx *sql.Tx, answer *models.Answer) (bool, error) {
+	// Принимаем ответы только на вопросы, зафиксированные при старте попытки
+	snapshot, err := attemptSnapshotEntry(tx, answer.AttemptID, answer.QuestionID)
+	if err != nil {
+		return false, err
+	}
+	if snapshot == nil {
+		return false, &AttemptError{Message: "Question is not part of this attempt"}
+	}
+	// Пересчет мог перевести идущую попытку на новую версию вопроса, пока клиент
+	// держит старую. Индексы вариантов в этих версиях совпадают (см. migrateToLatestVersions),
+	// поэтому ответ на более раннюю версию принимается в версии попытки
+	if answer.QuestionVersion > snapshot.QuestionVersion {
+		return false, &AttemptError{Message: fmt.Sprintf("This attempt uses version %d of the question", snapshot.QuestionVersion)}
+	}
+	answer.QuestionVersion = snapshot.QuestionVersion
+
+	// Ключ вопроса нужен заранее: по нему проверяем и сам ответ, и его правильность
+	var question models.Question
+	questionQuery := `SELECT ` + questionColumns + `
+                      FROM questions WHERE id = $1 AND version = $2`
+	err = scanQuestion(tx.QueryRow(questionQuery, answer.QuestionID, answer.QuestionVersion), &question)
+	if err == sql.ErrNoRows {
+		return false, &AttemptError{Message: "Question not found"}
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := normalizeAnswerInput(&question, answer); err != nil {
+		return false, err
+	}
+
+	// Студент видит варианты в порядке своей попытки: в базу и на проверку идут
+	// исходные индексы, а ответ клиенту возвращается в порядке показа
+	stored := *answer
+	mapDisplayedOptions(&stored, snapshot.OptionOrder)
+
+	// Развернутые ответы остаются непроверенными до ручной проверки
+	var isCorrect *bool
+	if !needsManualGrading(&question) {
+		correct := isAnswerCorrect(&question, &stored)
+		isCorrect = &correct
 	}
 
 	var existingID int
-	existingQuery := `SELECT id FROM attempt_answers 
+	var existingSeq sql.NullInt64
+	var previous *models.Answer
+	existingQuery := `SELECT id, client_seq, question_version, selected_option, selected_options,
+                             text_answer, numeric_answer
+                      FROM attempt_answers 
                       WHERE attempt_id = $1 AND question_id = $2`
-	err = r.db.QueryRow(existingQuery, attemptID, questionID).Scan(&existingID)
+	previous, err = scanPreviousAnswer(tx.QueryRow(existingQuery, stored.AttemptID, stored.QuestionID), &existingID, &existingSeq)
 
-	var answerID int
 	if err == sql.ErrNoRows {
 		insertQuery := `INSERT INTO attempt_answers 
-                        (attempt_id, question_id, question_version, selected_option, answered_at)
-                        VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+                        (attempt_id, question_id, question_version, selected_option, selected_options,
+                         text_answer, numeric_answer, correct_answer, is_correct, client_seq, answered_at)
+                        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8, $9, CURRENT_TIMESTAMP)
                         RETURNING id`
-		err = r.db.QueryRow(insertQuery,
-			attemptID, questionID, questionVersion, selectedOption).Scan(&answerID)
+		err = tx.QueryRow(insertQuery,
+			stored.AttemptID, stored.QuestionID, stored.QuestionVersion,
+			stored.SelectedOption, pq.Array(stored.SelectedOptions),
+			stored.TextAnswer, stored.NumericAnswer, isCorrect, stored.ClientSeq).Scan(&stored.ID)
 	} else if err == nil {
+		// Автосохранение, отправленное раньше уже записанного, не должно его затереть
+		if stored.ClientSeq != nil && existingSeq.Valid && existingSeq.Int64 >= *stored.ClientSeq {
+			return false, nil
+		}
+
+		// Ответ без client_seq записывается всегда, но сохраненный номер не сбрасывает
 		updateQuery := `UPDATE attempt_answers 
-                        SET selected_option = $1, answered_at = CURRENT_TIMESTAMP
-                        WHERE id = $2 RETURNING id`
-		err = r.db.QueryRow(updateQuery, selectedOption, existingID).Scan(&answerID)
-		answerID = existingID
+                        SET question_version = $1, selected_option = $2, selected_options = $3,
+                            text_answer = $4, numeric_answer = $5,
+                            correct_answer = $6, is_correct = $6,
+                            client_seq = COALESCE($7, client_seq), answered_at = CURRENT_TIMESTAMP
+                        WHERE id = $8`
+		_, err = tx.Exec(updateQuery, stored.QuestionVersion, stored.SelectedOption,
+			pq.Array(stored.SelectedOptions), stored.TextAnswer, stored.NumericAnswer,
+			isCorrect, stored.ClientSeq, existingID)
+		stored.ID = existingID
 	}
 
 	if err != nil {
-		return nil, err
+		return false, err
 	}
 
-	// ИСПРАВЛЕНО: Используем correct_option вместо correct_answer
-	var correctOption int
-	questionQuery := `SELECT correct_option FROM questions WHERE id = $1 AND version = $2`
-	err = r.db.QueryRow(questionQuery, questionID, questionVersion).Scan(&correctOption)
-	if err != nil {
-		return nil, err
+	// Повторное сохранение того же ответа (автосохранение) в историю не попадает
+	if previous == nil || !sameAnswerContent(previous, &stored) {
+		historyQuery := `INSERT INTO attempt_answer_history
+                         (attempt_id, question_id, question_version, selected_option, selected_options,
+                          text_answer, numeric_answer, answered_at)
+                         VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)`
+		_, err = tx.Exec(historyQuery, stored.AttemptID, stored.QuestionID, stored.QuestionVersion,
+			stored.SelectedOption, pq.Array(stored.SelectedOptions), stored.TextAnswer, stored.NumericAnswer)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	correct := selectedOption == correctOption
+	// Правильность ответа до завершения попытки не раскрывается: ее видно
+	// только в разборе, по политике просмотра теста
+	answer.ID = stored.ID
+	answer.IsCorrect = nil
+	answer.PointsAwarded = nil
 
-	// ИСПРАВЛЕНО: Обновляем правильность ответа
-	updateCorrectQuery := `UPDATE attempt_answers 
-                          SET correct_answer = $1, is_correct = $1 
-                          WHERE id = $2`
-	_, err = r.db.Exec(updateCorrectQuery, correct, answerID)
-	if err != nil {
-		return nil, err
-	}
+	return true, nil
+}
 
-	answer := &models.Answer{
-		ID:              answerID,
-		AttemptID:       attemptID,
-		QuestionID:      questionID,
-		QuestionVersion: questionVersion,
-		SelectedOption:  selectedOption,
-		IsCorrect:       &correct, // Добавляем информацию о правильности
+// normalizeAnswerInput проверяет, что ответ подходит к типу вопроса,
+// и оставляет в нем только поля, относящиеся к этому типу
+func normalizeAnswerInput(question *models.Question, answer *models.Answer) error {
+	selectedOption := answer.SelectedOption
+	selectedOptions := answer.SelectedOptions
+	textAnswer := answer.TextAnswer
+	numericAnswer := answer.NumericAnswer
+
+	answer.SelectedOption = -1
+	answer.SelectedOptions = nil
+	answer.TextAnswer = nil
+	answer.NumericAnswer = nil
+
+	switch question.QuestionType {
+	case models.QuestionTypeMultiple:
+		selected := normalizeOptions(selectedOptions)
+		for _, option := range selected {
+			if option < 0 || option >= len(question.Options) {
+				return &AttemptError{Message: "Invalid option selected"}
+			}
+		}
+		answer.SelectedOptions = selected
+	case models.QuestionTypeText, models.QuestionTypeEssay:
+		if textAnswer == nil {
+			return &AttemptError{Message: "text_answer is required for this question"}
+		}
+		answer.TextAnswer = textAnswer
+	case models.QuestionTypeNumeric:
+		if numericAnswer == nil {
+			return &AttemptError{Message: "numeric_answer is required for this question"}
+		}
+		if math.IsNaN(*numericAnswer) || math.IsInf(*numericAnswer, 0) {
+			return &AttemptError{Message: "numeric_answer must be a finite number"}
+		}
+		answer.NumericAnswer = numericAnswer
+	default:
+		if selectedOption >= len(question.Options) {
+			return &AttemptError{Message: "Invalid option selected"}
+		}
+		answer.SelectedOption = selectedOption
 	}
 
-	return answer, nil
+	return nil
 }
 
 func (r *AttemptRepository) CompleteAttempt(attemptID int) (*models.Attempt, error) {
@@ -285,84 +605,232 @@ func (r *AttemptRepository) CompleteAttempt(attemptID int) (*models.Attempt, err
 		return nil, &AttemptError{Message: "Attempt is not in progress"}
 	}
 
-	var totalScore, maxScore float64
-	scoreQuery := `
-        SELECT 
-            COALESCE(SUM(CASE WHEN aa.is_correct = true THEN q.points ELSE 0 END), 0) as total_score,
-            COALESCE(SUM(q.points), 0) as max_score
-        FROM attempt_answers aa
-        JOIN questions q ON aa.question_id = q.id
-        WHERE aa.attempt_id = $1`
+	config, err := loadScoringConfig(tx, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scoreAttemptAnswers(tx, attemptID, config); err != nil {
+		return nil, err
+	}
+
+	breakdown, err := buildScoreBreakdown(tx, attemptID, config)
+	if err != nil {
+		return nil, err
+	}
 
-	err = tx.QueryRow(scoreQuery, attemptID).Scan(&totalScore, &maxScore)
+	// Пока есть непроверенные развернутые ответы, результат не финальный
+	newStatus := "completed"
+	if breakdown.Pending > 0 {
+		newStatus = "awaiting_review"
+	}
+
+	breakdownJSON, err := json.Marshal(breakdown)
 	if err != nil {
 		return nil, err
 	}
 
 	updateQuery := `UPDATE attempts 
-                    SET status = 'completed', score = $1, completed_at = CURRENT_TIMESTAMP
-                    WHERE id = $2
+                    SET status = $1, score = $2, score_breakdown = $3, completed_at = CURRENT_TIMESTAMP
+                    WHERE id = $4
                     RETURNING completed_at`
 
 	var completedAt time.Time
-	err = tx.QueryRow(updateQuery, totalScore, attemptID).Scan(&completedAt)
+	err = tx.QueryRow(updateQuery, newStatus, breakdown.Score, string(breakdownJSON), attemptID).Scan(&completedAt)
 	if err != nil {
 		return nil, err
 	}
 
 	var attempt models.Attempt
-	var score sql.NullFloat64
-	var completedAtNull sql.NullTime
-
-	getQuery := `SELECT id, test_id, user_id, status, score, started_at, completed_at
+	getQuery := `SELECT ` + attemptColumns + `
                  FROM attempts WHERE id = $1`
 
-	err = tx.QueryRow(getQuery, attemptID).Scan(
-		&attempt.ID,
-		&attempt.TestID,
-		&attempt.UserID,
-		&attempt.Status,
-		&score,
-		&attempt.StartedAt,
-		&completedAtNull,
-	)
-
+	err = scanAttempt(tx.QueryRow(getQuery, attemptID), &attempt)
 	if err != nil {
 		return nil, err
 	}
 
-	if score.Valid {
-		attempt.Score = &score.Float64
+	if newStatus == "completed" {
+		if err := saveTestResult(tx, testID, userID, completedAt); err != nil {
+			return nil, err
+		}
+		if err := issueCertificate(tx, testID, userID, attemptID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	if completedAtNull.Valid {
-		attempt.CompletedAt = &completedAtNull.Time
+	return &attempt, nil
+}
+
+// saveTestResult пересчитывает итог студента по тесту в test_results
+// по всем завершенным попыткам согласно score_policy теста; балл и максимум
+// берутся из одной и той же попытки (или усредняются вместе)
+func saveTestResult(tx *sql.Tx, testID, userID int, completedAt time.Time) error {
+	var policy string
+	err := tx.QueryRow(`SELECT score_policy FROM tests WHERE id = $1`, testID).Scan(&policy)
+	if err != nil {
+		return err
+	}
+
+	scoresQuery := `SELECT COALESCE(score, 0), max_score FROM attempts
+                    WHERE test_id = $1 AND user_id = $2 AND status = 'completed'
+                    ORDER BY completed_at, id`
+	rows, err := tx.Query(scoresQuery, testID, userID)
+	if err != nil {
+		return err
+	}
+
+	var scores []attemptScore
+	for rows.Next() {
+		var score attemptScore
+		if err := rows.Scan(&score.Score, &score.MaxScore); err != nil {
+			rows.Close()
+			return err
+		}
+		scores = append(scores, score)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
-	resultQuery := `INSERT INTO test_results (test_id, user_id, score, max_score, completed_at)
-                    VALUES ($1, $2, $3, $4, $5)
+	resultQuery := `INSERT INTO test_results (test_id, user_id, score, max_score, attempts_count, completed_at)
+                    VALUES ($1, $2, $3, $4, $5, $6)
                     ON CONFLICT (test_id, user_id) DO UPDATE 
-                    SET score = EXCLUDED.score, completed_at = EXCLUDED.completed_at`
+                    SET score = EXCLUDED.score, max_score = EXCLUDED.max_score,
+                        attempts_count = EXCLUDED.attempts_count, completed_at = EXCLUDED.completed_at`
+
+	result := applyScorePolicy(policy, scores)
+	_, err = tx.Exec(resultQuery, testID, userID, result.Score, result.MaxScore, len(scores), completedAt)
+	return err
+}
+
+// questionKey - вопрос в конкретной версии
+type questionKey struct {
+	ID      int
+	Version int
+}
+
+// queryer - общее у *sql.DB и *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// loadAnsweredQuestions загружает версии вопросов, на которые есть ответы в попытке
+func loadAnsweredQuestions(q queryer, attemptID int) (map[questionKey]*models.Question, error) {
+	return loadQuestionVersions(q, `SELECT question_id, question_version
+                                    FROM attempt_answers WHERE attempt_id = $1`, attemptID)
+}
+
+// loadQuestionVersions загружает вопросы по подзапросу, возвращающему пары (id, версия)
+func loadQuestionVersions(q queryer, keysQuery string, args ...interface{}) (map[questionKey]*models.Question, error) {
+	query := `SELECT ` + questionColumns + `
+              FROM questions
+              WHERE (id, version) IN (` + keysQuery + `)`
 
-	_, err = tx.Exec(resultQuery, testID, userID, totalScore, maxScore, completedAt)
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	questions := make(map[questionKey]*models.Question)
+	for rows.Next() {
+		var question models.Question
+		if err := scanQuestion(rows, &question); err != nil {
+			return nil, err
+		}
+		questions[questionKey{question.ID, question.Version}] = &question
 	}
 
-	return &attempt, nil
+	return questions, rows.Err()
 }
 
-func (r *AttemptRepository) GetAttemptAnswers(attemptID int) ([]models.Answer, error) {
-	query := `SELECT id, attempt_id, question_id, question_version, selected_option, is_correct
-              FROM attempt_answers 
-              WHERE attempt_id = $1
+const answerColumns = `id, attempt_id, question_id, question_version, selected_option, selected_options,
+                     text_answer, numeric_answer, is_correct, points_awarded,
+                     review_comment, reviewed_by, reviewed_at, client_seq`
+
+func scanAnswer(row rowScanner, answer *models.Answer) error {
+	var selectedOptions pq.Int64Array
+	var textAnswer sql.NullString
+	var numericAnswer sql.NullFloat64
+	var isCorrect sql.NullBool
+	var pointsAwarded sql.NullFloat64
+	var reviewComment sql.NullString
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+	var clientSeq sql.NullInt64
+
+	err := row.Scan(
+		&answer.ID,
+		&answer.AttemptID,
+		&answer.QuestionID,
+		&answer.QuestionVersion,
+		&answer.SelectedOption,
+		&selectedOptions,
+		&textAnswer,
+		&numericAnswer,
+		&isCorrect,
+		&pointsAwarded,
+		&reviewComment,
+		&reviewedBy,
+		&reviewedAt,
+		&clientSeq,
+	)
+	if err != nil {
+		return err
+	}
+
+	answer.SelectedOptions = intsFromArray(selectedOptions)
+
+	if textAnswer.Valid {
+		answer.TextAnswer = &textAnswer.String
+	}
+
+	if numericAnswer.Valid {
+		answer.NumericAnswer = &numericAnswer.Float64
+	}
+
+	if isCorrect.Valid {
+		answer.IsCorrect = &isCorrect.Bool
+	}
+
+	if pointsAwarded.Valid {
+		answer.PointsAwarded = &pointsAwarded.Float64
+	}
+
+	if reviewComment.Valid {
+		answer.ReviewComment = &reviewComment.String
+	}
+
+	if reviewedBy.Valid {
+		reviewer := int(reviewedBy.Int64)
+		answer.ReviewedBy = &reviewer
+	}
+
+	if reviewedAt.Valid {
+		answer.ReviewedAt = &reviewedAt.Time
+	}
+
+	if clientSeq.Valid {
+		answer.ClientSeq = &clientSeq.Int64
+	}
+
+	return nil
+}
+
+// queryAnswers выбирает ответы по условию where (например, `WHERE attempt_id = $1`)
+func queryAnswers(q queryer, where string, args ...interface{}) ([]models.Answer, error) {
+	query := `SELECT ` + answerColumns + `
+              FROM attempt_answers ` + where + `
               ORDER BY id`
 
-	rows, err := r.db.Query(query, attemptID)
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -371,34 +839,20 @@ func (r *AttemptRepository) GetAttemptAnswers(attemptID int) ([]models.Answer, e
 	var answers []models.Answer
 	for rows.Next() {
 		var answer models.Answer
-		var isCorrect sql.NullBool
-
-		err := rows.Scan(
-			&answer.ID,
-			&answer.AttemptID,
-			&answer.QuestionID,
-			&answer.QuestionVersion,
-			&answer.SelectedOption,
-			&isCorrect,
-		)
-		if err != nil {
+		if err := scanAnswer(rows, &answer); err != nil {
 			return nil, err
 		}
-
-		if isCorrect.Valid {
-			answer.IsCorrect = &isCorrect.Bool
-		}
-
 		answers = append(answers, answer)
 	}
 
-	return answers, nil
+	return answers, rows.Err()
 }
 
 // GetTestResults получает результаты теста (для преподавателя)
 func (r *AttemptRepository) GetTestResults(testID int) ([]models.Attempt, error) {
 	query := `SELECT a.id, a.test_id, a.user_id, a.status, a.score, 
-                     a.started_at, a.completed_at, u.full_name
+                     a.started_at, a.completed_at, a.deadline, a.max_score, a.score_breakdown,
+                     a.accommodation_id, a.time_multiplier, a.extra_minutes, a.extra_attempt
               FROM attempts a
               JOIN users u ON a.user_id = u.id
               WHERE a.test_id = $1 AND a.status = 'completed'
@@ -413,36 +867,45 @@ func (r *AttemptRepository) GetTestResults(testID int) ([]models.Attempt, error)
 	var attempts []models.Attempt
 	for rows.Next() {
 		var attempt models.Attempt
-		var score sql.NullFloat64
-		var completedAt sql.NullTime
-		var fullName string
-
-		err := rows.Scan(
-			&attempt.ID,
-			&attempt.TestID,
-			&attempt.UserID,
-			&attempt.Status,
-			&score,
-			&attempt.StartedAt,
-			&completedAt,
-			&fullName,
-		)
-		if err != nil {
+		if err := scanAttempt(rows, &attempt); err != nil {
 			return nil, err
 		}
 
-		if score.Valid {
-			attempt.Score = &score.Float64
-		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, nil
+}
+
+// GetFinalResults возвращает итоги студентов по тесту (test_results)
+func (r *AttemptRepository) GetFinalResults(testID int) ([]models.TestResult, error) {
+	query := `SELECT test_id, user_id, score, max_score, attempts_count, completed_at
+              FROM test_results
+              WHERE test_id = $1
+              ORDER BY score DESC, user_id`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var results []models.TestResult
+	for rows.Next() {
+		var result models.TestResult
+		var completedAt sql.NullTime
+		err := rows.Scan(&result.TestID, &result.UserID, &result.Score, &result.MaxScore,
+			&result.AttemptsCount, &completedAt)
+		if err != nil {
+			return nil, err
+		}
 		if completedAt.Valid {
-			attempt.CompletedAt = &completedAt.Time
+			result.CompletedAt = &completedAt.Time
 		}
-
-		attempts = append(attempts, attempt)
+		results = append(results, result)
 	}
 
-	return attempts, nil
+	return results, rows.Err()
 }
 
 func (r *AttemptRepository) CancelAttempt(attemptID int) error {
@@ -464,31 +927,222 @@ func (r *AttemptRepository) CancelAttempt(attemptID int) error {
 	return nil
 }
 
-func (r *AttemptRepository) CompleteAllAttemptsForTest(testID int) error {
-	query := `
-        UPDATE attempts 
-        SET status = 'completed', completed_at = CURRENT_TIMESTAMP
-        WHERE test_id = $1 AND status = 'in_progress'
-        RETURNING id
-    `
+// CompleteAllAttemptsForTest завершает все незаконченные попытки теста
+// (при деактивации или закрытии по расписанию) с обычным подсчетом баллов
+func (r *AttemptRepository) CompleteAllAttemptsForTest(testID int) ([]models.Attempt, error) {
+	return r.completeAttempts(`SELECT id FROM attempts 
+                               WHERE test_id = $1 AND status = 'in_progress'`, testID)
+}
 
-	rows, err := r.db.Query(query, testID)
+// ExpireOverdueAttempts завершает все попытки, у которых истек дедлайн.
+// Подсчет баллов такой же, как при ручном завершении через CompleteAttempt.
+func (r *AttemptRepository) ExpireOverdueAttempts() ([]models.Attempt, error) {
+	return r.completeAttempts(`SELECT id FROM attempts 
+                               WHERE status = 'in_progress' AND deadline < CURRENT_TIMESTAMP`)
+}
+
+// completeAttempts завершает через CompleteAttempt попытки, выбранные запросом
+func (r *AttemptRepository) completeAttempts(query string, args ...interface{}) ([]models.Attempt, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer rows.Close()
 
 	var attemptIDs []int
 	for rows.Next() {
 		var attemptID int
 		if err := rows.Scan(&attemptID); err != nil {
-			return err
+			rows.Close()
+			return nil, err
 		}
 		attemptIDs = append(attemptIDs, attemptID)
 	}
+	rows.Close()
 
-	// TODO: можно добавить отправку уведомлений пользователям
-	// о принудительном завершении попыток, но мне что-то лень :)
+	var completed []models.Attempt
+	for _, attemptID := range attemptIDs {
+		attempt, err := r.CompleteAttempt(attemptID)
+		if err != nil {
+			// Попытку могли завершить вручную между выборкой и обновлением
+			if _, ok := err.(*AttemptError); ok {
+				continue
+			}
+			return completed, err
+		}
+		completed = append(completed, *attempt)
+	}
 
-	return nil
+	return completed, nil
+}
+
+// GetPendingReviews возвращает развернутые ответы, ожидающие ручной проверки.
+// testID = 0 - по всем тестам, teacherID = 0 - без фильтра по преподавателю.
+func (r *AttemptRepository) GetPendingReviews(testID, teacherID int) ([]models.ReviewItem, error) {
+	query := `SELECT aa.id, a.id, t.id, t.title, u.id, u.full_name,
+                     q.id, q.version, q.text, COALESCE(w.weight, q.points),
+                     COALESCE(aa.text_answer, ''), aa.answered_at
+              FROM attempt_answers aa
+              JOIN attempts a ON aa.attempt_id = a.id
+              JOIN tests t ON a.test_id = t.id
+              JOIN users u ON a.user_id = u.id
+              JOIN questions q ON aa.question_id = q.id AND aa.question_version = q.version
+              LEFT JOIN test_question_weights w ON w.test_id = t.id AND w.question_id = q.id
+              WHERE a.status = 'awaiting_review'
+                AND q.question_type = 'essay'
+                AND aa.points_awarded IS NULL
+                AND ($1 = 0 OR t.id = $1)
+                AND ($2 = 0 OR t.teacher_id = $2)
+              ORDER BY aa.answered_at`
+
+	rows, err := r.db.Query(query, testID, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ReviewItem
+	for rows.Next() {
+		var item models.ReviewItem
+		err := rows.Scan(
+			&item.AnswerID,
+			&item.AttemptID,
+			&item.TestID,
+			&item.TestTitle,
+			&item.UserID,
+			&item.StudentName,
+			&item.QuestionID,
+			&item.QuestionVersion,
+			&item.QuestionText,
+			&item.MaxPoints,
+			&item.TextAnswer,
+			&item.AnsweredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// GetAnswerByID возвращает ответ вместе с попыткой, к которой он относится
+func (r *AttemptRepository) GetAnswerByID(answerID int) (*models.Answer, error) {
+	answers, err := queryAnswers(r.db, `WHERE id = $1`, answerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(answers) == 0 {
+		return nil, nil
+	}
+	return &answers[0], nil
+}
+
+// GradeAnswer выставляет баллы за развернутый ответ. Когда в попытке не остается
+// непроверенных ответов, попытка завершается и попадает в test_results -
+// в этом случае возвращается завершенная попытка, иначе nil.
+func (r *AttemptRepository) GradeAnswer(answerID, reviewerID int, points float64, comment string) (*models.Attempt, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var attemptID, testID, userID int
+	var status string
+	var question models.Question
+	checkQuery := `SELECT a.id, a.test_id, a.user_id, a.status
+                   FROM attempt_answers aa
+                   JOIN attempts a ON aa.attempt_id = a.id
+                   WHERE aa.id = $1
+                   FOR UPDATE OF a`
+	err = tx.QueryRow(checkQuery, answerID).Scan(&attemptID, &testID, &userID, &status)
+	if err == sql.ErrNoRows {
+		return nil, &AttemptError{Message: "Answer not found"}
+	} else if err != nil {
+		return nil, err
+	}
+
+	questionQuery := `SELECT ` + questionColumns + `
+                      FROM questions
+                      WHERE (id, version) = (SELECT question_id, question_version
+                                             FROM attempt_answers WHERE id = $1)`
+	if err := scanQuestion(tx.QueryRow(questionQuery, answerID), &question); err != nil {
+		return nil, err
+	}
+
+	if !needsManualGrading(&question) {
+		return nil, &AttemptError{Message: "Only essay answers are graded manually"}
+	}
+
+	if status != "awaiting_review" {
+		return nil, &AttemptError{Message: "Attempt is not awaiting review"}
+	}
+
+	config, err := loadScoringConfig(tx, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Максимум за ответ - вес вопроса в этом тесте
+	maxPoints := config.weight(&question)
+	if points < 0 || points > maxPoints {
+		return nil, &AttemptError{Message: fmt.Sprintf("Points must be between 0 and %g", maxPoints)}
+	}
+
+	// Ответ считается правильным, если за него поставлен полный балл
+	correct := points >= maxPoints
+	gradeQuery := `UPDATE attempt_answers
+                   SET points_awarded = $1, correct_answer = $2, is_correct = $2,
+                       review_comment = $3, reviewed_by = $4, reviewed_at = CURRENT_TIMESTAMP
+                   WHERE id = $5`
+	_, err = tx.Exec(gradeQuery, points, correct, nullString(comment), reviewerID, answerID)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdown, err := buildScoreBreakdown(tx, attemptID, config)
+	if err != nil {
+		return nil, err
+	}
+
+	breakdownJSON, err := json.Marshal(breakdown)
+	if err != nil {
+		return nil, err
+	}
+
+	if breakdown.Pending > 0 {
+		updateQuery := `UPDATE attempts SET score = $1, score_breakdown = $2 WHERE id = $3`
+		if _, err := tx.Exec(updateQuery, breakdown.Score, string(breakdownJSON), attemptID); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+
+	finalizeQuery := `UPDATE attempts SET status = 'completed', score = $1, score_breakdown = $2
+                      WHERE id = $3`
+	if _, err := tx.Exec(finalizeQuery, breakdown.Score, string(breakdownJSON), attemptID); err != nil {
+		return nil, err
+	}
+
+	var attempt models.Attempt
+	getQuery := `SELECT ` + attemptColumns + `
+                 FROM attempts WHERE id = $1`
+	if err := scanAttempt(tx.QueryRow(getQuery, attemptID), &attempt); err != nil {
+		return nil, err
+	}
+
+	if err := saveTestResult(tx, testID, userID, *attempt.CompletedAt); err != nil {
+		return nil, err
+	}
+
+	if err := issueCertificate(tx, testID, userID, attemptID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
 }
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"sql_module/internal/models"
+)
+
+// Что студент видит при разборе завершенной попытки
+const (
+	// ReviewScoreOnly - только итоговый балл и свои ответы, без проверки по вопросам
+	ReviewScoreOnly = "score_only"
+	// ReviewCorrectAnswers - плюс правильность, баллы по вопросам и ключ ответа
+	ReviewCorrectAnswers = "correct_answers"
+	// ReviewFull - плюс пояснения к вопросу и к каждому варианту
+	ReviewFull = "full"
+)
+
+// Когда разбор становится доступен студенту
+const (
+	ReviewImmediate  = "immediate"   // сразу после завершения попытки
+	ReviewAfterClose = "after_close" // после закрытия теста
+)
+
+func IsValidReviewContent(content string) bool {
+	switch content {
+	case ReviewScoreOnly, ReviewCorrectAnswers, ReviewFull:
+		return true
+	}
+	return false
+}
+
+func IsValidReviewAvailability(availability string) bool {
+	switch availability {
+	case ReviewImmediate, ReviewAfterClose:
+		return true
+	}
+	return false
+}
+
+// GetAttemptAnswers возвращает разбор попытки: вопросы набора в порядке показа
+// с ответами студента. content (ReviewScoreOnly, ReviewCorrectAnswers, ReviewFull)
+// определяет, какие поля проверки, ключа и пояснений заполняются.
+func (r *AttemptRepository) GetAttemptAnswers(attemptID int, content string) ([]models.AnswerReview, error) {
+	set, err := loadAttemptQuestionSet(r.db, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := loadQuestionVersions(r.db, `SELECT question_id, question_version
+                                                  FROM attempt_questions WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := queryAnswers(r.db, `WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	answersByQuestion := make(map[int]*models.Answer, len(answers))
+	for i := range answers {
+		answersByQuestion[answers[i].QuestionID] = &answers[i]
+	}
+
+	reviews := make([]models.AnswerReview, 0, len(set))
+	for _, item := range set {
+		question, ok := questions[questionKey{item.QuestionID, item.QuestionVersion}]
+		if !ok {
+			continue
+		}
+
+		// Вопрос и ответ показываем в том порядке вариантов, который видел студент
+		displayed := *question
+		applyOptionOrder(&displayed, item.OptionOrder)
+
+		review := models.AnswerReview{
+			QuestionID:      item.QuestionID,
+			QuestionVersion: item.QuestionVersion,
+			Position:        item.Position,
+			Title:           displayed.Title,
+			Text:            displayed.Text,
+			QuestionType:    displayed.QuestionType,
+			Options:         displayed.Options,
+			SelectedOption:  -1,
+		}
+
+		answer, answered := answersByQuestion[item.QuestionID]
+		if answered {
+			shown := *answer
+			toDisplayedOptions(&shown, item.OptionOrder)
+
+			review.Answered = true
+			review.SelectedOption = shown.SelectedOption
+			review.SelectedOptions = shown.SelectedOptions
+			review.TextAnswer = shown.TextAnswer
+			review.NumericAnswer = shown.NumericAnswer
+		}
+
+		if content == ReviewCorrectAnswers || content == ReviewFull {
+			if answered {
+				review.IsCorrect = answer.IsCorrect
+				review.PointsAwarded = answer.PointsAwarded
+				review.ReviewComment = answer.ReviewComment
+			}
+			fillAnswerKey(&review, &displayed)
+		}
+
+		if content == ReviewFull {
+			review.Explanation = displayed.Explanation
+			review.OptionExplanations = displayed.OptionExplanations
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	return reviews, nil
+}
+
+// fillAnswerKey добавляет в разбор ключ ответа в зависимости от типа вопроса
+func fillAnswerKey(review *models.AnswerReview, question *models.Question) {
+	switch question.QuestionType {
+	case models.QuestionTypeMultiple:
+		review.CorrectOptions = question.CorrectOptions
+	case models.QuestionTypeText:
+		review.AcceptedAnswers = question.AcceptedAnswers
+	case models.QuestionTypeNumeric:
+		review.CorrectNumeric = question.NumericAnswer
+		review.Tolerance = question.Tolerance
+		review.ToleranceType = question.ToleranceType
+	case models.QuestionTypeEssay:
+		// ключа нет, оценку и комментарий ставит преподаватель
+	default:
+		correct := question.CorrectOption
+		review.CorrectOption = &correct
+	}
+}
+
+// toDisplayedOptions переводит индексы вариантов ответа из исходных в порядок показа
+func toDisplayedOptions(answer *models.Answer, order []int) {
+	if len(order) == 0 {
+		return
+	}
+
+	displayed := make([]int, len(order))
+	for i, canonical := range order {
+		if canonical >= 0 && canonical < len(displayed) {
+			displayed[canonical] = i
+		}
+	}
+
+	if answer.SelectedOption >= 0 && answer.SelectedOption < len(displayed) {
+		answer.SelectedOption = displayed[answer.SelectedOption]
+	}
+
+	if len(answer.SelectedOptions) > 0 {
+		selected := make([]int, 0, len(answer.SelectedOptions))
+		for _, option := range answer.SelectedOptions {
+			if option >= 0 && option < len(displayed) {
+				selected = append(selected, displayed[option])
+			}
+		}
+		answer.SelectedOptions = normalizeOptions(selected)
+	}
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"database/sql"
+	"sql_module/internal/models"
+)
+
+// scoringConfig - настройки подсчета баллов теста
+type scoringConfig struct {
+	mode        string
+	penalty     float64         // доля веса вопроса, снимаемая за неверный ответ
+	clampAtZero bool            // итог попытки не опускается ниже нуля
+	weights     map[int]float64 // переопределенные веса вопросов в тесте
+}
+
+func loadScoringConfig(tx *sql.Tx, testID int) (*scoringConfig, error) {
+	config := &scoringConfig{weights: make(map[int]float64)}
+
+	query := `SELECT scoring_mode, wrong_answer_penalty, clamp_at_zero FROM tests WHERE id = $1`
+	err := tx.QueryRow(query, testID).Scan(&config.mode, &config.penalty, &config.clampAtZero)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT question_id, weight FROM test_question_weights WHERE test_id = $1`, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var questionID int
+		var weight float64
+		if err := rows.Scan(&questionID, &weight); err != nil {
+			return nil, err
+		}
+		config.weights[questionID] = weight
+	}
+
+	return config, rows.Err()
+}
+
+// weight - вес вопроса в тесте: переопределение или questions.points
+func (c *scoringConfig) weight(question *models.Question) float64 {
+	if weight, ok := c.weights[question.ID]; ok {
+		return weight
+	}
+	return float64(question.Points)
+}
+
+// answerPoints считает баллы за автоматически проверяемый ответ. За неверный ответ
+// снимается штраф; пропущенный ответ (ничего не выбрано) не штрафуется.
+func (c *scoringConfig) answerPoints(question *models.Question, answer *models.Answer) float64 {
+	weight := c.weight(question)
+	credit := answerCredit(question, answer, c.mode)
+	if credit > 0 || isAnswerOmitted(question, answer) {
+		return weight * credit
+	}
+	return -weight * c.penalty
+}
+
+// updateAttemptMaxScore пересчитывает максимум попытки. Максимум считаем по набору
+// попытки, чтобы пропущенные вопросы тоже в него входили
+func updateAttemptMaxScore(tx *sql.Tx, attemptID, testID int) (float64, error) {
+	maxQuery := `UPDATE attempts
+                 SET max_score = (SELECT COALESCE(SUM(COALESCE(w.weight, q.points)), 0)
+                                  FROM attempt_questions aq
+                                  JOIN questions q ON aq.question_id = q.id AND aq.question_version = q.version
+                                  LEFT JOIN test_question_weights w ON w.test_id = $2 AND w.question_id = aq.question_id
+                                  WHERE aq.attempt_id = $1)
+                 WHERE id = $1
+                 RETURNING max_score`
+
+	var maxScore float64
+	err := tx.QueryRow(maxQuery, attemptID, testID).Scan(&maxScore)
+	return maxScore, err
+}
+
+// scoreAttemptAnswers начисляет баллы (points_awarded) за каждый автоматически
+// проверяемый ответ попытки. Развернутые ответы остаются без баллов до ручной проверки.
+func scoreAttemptAnswers(tx *sql.Tx, attemptID int, config *scoringConfig) error {
+	answers, err := queryAnswers(tx, `WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return err
+	}
+
+	questions, err := loadAnsweredQuestions(tx, attemptID)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `UPDATE attempt_answers SET points_awarded = $1 WHERE id = $2`
+	for i := range answers {
+		question, ok := questions[questionKey{answers[i].QuestionID, answers[i].QuestionVersion}]
+		if !ok || needsManualGrading(question) {
+			continue
+		}
+
+		awarded := config.answerPoints(question, &answers[i])
+		if _, err := tx.Exec(updateQuery, awarded, answers[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildScoreBreakdown собирает расшифровку балла по набору вопросов попытки:
+// баллы и штрафы по каждому вопросу, итог с учетом ограничения снизу и максимум
+func buildScoreBreakdown(tx *sql.Tx, attemptID int, config *scoringConfig) (*models.ScoreBreakdown, error) {
+	set, err := loadAttemptQuestionSet(tx, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := loadQuestionVersions(tx, `SELECT question_id, question_version
+                                                FROM attempt_questions WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := queryAnswers(tx, `WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	answersByQuestion := make(map[int]*models.Answer, len(answers))
+	for i := range answers {
+		answersByQuestion[answers[i].QuestionID] = &answers[i]
+	}
+
+	breakdown := &models.ScoreBreakdown{Questions: make([]models.QuestionScore, 0, len(set))}
+	err = tx.QueryRow(`SELECT max_score FROM attempts WHERE id = $1`, attemptID).Scan(&breakdown.MaxScore)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range set {
+		question, ok := questions[questionKey{item.QuestionID, item.QuestionVersion}]
+		if !ok {
+			continue
+		}
+
+		score := models.QuestionScore{
+			QuestionID:      item.QuestionID,
+			QuestionVersion: item.QuestionVersion,
+			Weight:          config.weight(question),
+		}
+
+		answer, answered := answersByQuestion[item.QuestionID]
+		switch {
+		case !answered:
+			zero := 0.0
+			score.Points = &zero
+			score.Status = models.QuestionScoreUnanswered
+		case answer.PointsAwarded == nil:
+			score.Status = models.QuestionScorePending
+			breakdown.Pending++
+		default:
+			points := *answer.PointsAwarded
+			score.Points = &points
+			switch {
+			case points < 0:
+				score.Penalty = -points
+				score.Status = models.QuestionScoreWrong
+			case points >= score.Weight-numericEpsilon:
+				score.Status = models.QuestionScoreCorrect
+			case points > 0:
+				score.Status = models.QuestionScorePartial
+			case isAnswerOmitted(question, answer):
+				score.Status = models.QuestionScoreUnanswered
+			default:
+				score.Status = models.QuestionScoreWrong
+			}
+			breakdown.RawScore += points
+			breakdown.Penalty += score.Penalty
+		}
+
+		breakdown.Questions = append(breakdown.Questions, score)
+	}
+
+	breakdown.Score = breakdown.RawScore
+	if config.clampAtZero && breakdown.Score < 0 {
+		breakdown.Score = 0
+		breakdown.ClampedToZero = true
+	}
+
+	return breakdown, nil
+}
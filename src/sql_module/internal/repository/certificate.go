@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"database/sql"
+	"math"
+	"sql_module/internal/certificate"
+	"sql_module/internal/models"
+)
+
+const certificateColumns = `id, test_id, user_id, attempt_id, verification_code, student_name,
+                            test_title, course_name, score, max_score, percentage,
+                            passing_percent, issued_at, revoked_at`
+
+func scanCertificate(row rowScanner, c *models.Certificate) error {
+	var revokedAt sql.NullTime
+	err := row.Scan(&c.ID, &c.TestID, &c.UserID, &c.AttemptID, &c.VerificationCode, &c.StudentName,
+		&c.TestTitle, &c.CourseName, &c.Score, &c.MaxScore, &c.Percentage,
+		&c.PassingPercent, &c.IssuedAt, &revokedAt)
+	if err != nil {
+		return err
+	}
+	if revokedAt.Valid {
+		c.RevokedAt = &revokedAt.Time
+	}
+	return nil
+}
+
+// issueCertificate выдает сертификат, если итог студента в test_results достиг
+// порога прохождения теста. Сертификат выдается один раз на тест; отозванный
+// при пересчете сертификат выдается заново, с новым кодом проверки.
+// Вызывается после saveTestResult в той же транзакции.
+func issueCertificate(tx *sql.Tx, testID, userID, attemptID int) error {
+	var passingPercent sql.NullFloat64
+	c := models.Certificate{TestID: testID, UserID: userID, AttemptID: attemptID}
+	query := `SELECT t.passing_percent, t.title, c.name, u.full_name, tr.score, tr.max_score
+              FROM test_results tr
+              JOIN tests t ON t.id = tr.test_id
+              JOIN courses c ON c.id = t.course_id
+              JOIN users u ON u.id = tr.user_id
+              WHERE tr.test_id = $1 AND tr.user_id = $2`
+	err := tx.QueryRow(query, testID, userID).Scan(&passingPercent, &c.TestTitle, &c.CourseName,
+		&c.StudentName, &c.Score, &c.MaxScore)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !passingPercent.Valid || c.MaxScore <= 0 || c.Score/c.MaxScore*100 < passingPercent.Float64 {
+		return nil
+	}
+
+	c.PassingPercent = passingPercent.Float64
+	c.Percentage = math.Round(c.Score/c.MaxScore*10000) / 100
+	c.VerificationCode, err = certificate.NewVerificationCode()
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO certificates
+                        (test_id, user_id, attempt_id, verification_code, student_name, test_title,
+                         course_name, score, max_score, percentage, passing_percent)
+                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+                    ON CONFLICT (test_id, user_id) DO UPDATE
+                    SET attempt_id = EXCLUDED.attempt_id, verification_code = EXCLUDED.verification_code,
+                        student_name = EXCLUDED.student_name, test_title = EXCLUDED.test_title,
+                        course_name = EXCLUDED.course_name, score = EXCLUDED.score,
+                        max_score = EXCLUDED.max_score, percentage = EXCLUDED.percentage,
+                        passing_percent = EXCLUDED.passing_percent,
+                        issued_at = CURRENT_TIMESTAMP, revoked_at = NULL
+                    WHERE certificates.revoked_at IS NOT NULL
+                    RETURNING id, issued_at`
+	err = tx.QueryRow(insertQuery, c.TestID, c.UserID, c.AttemptID, c.VerificationCode, c.StudentName,
+		c.TestTitle, c.CourseName, c.Score, c.MaxScore, c.Percentage, c.PassingPercent).
+		Scan(&c.ID, &c.IssuedAt)
+	if err == sql.ErrNoRows {
+		// Действующий сертификат уже выдан раньше
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// PDF строим после вставки, чтобы в нем была дата выдачи из БД
+	_, err = tx.Exec(`UPDATE certificates SET pdf = $1 WHERE id = $2`, certificate.Render(&c), c.ID)
+	return err
+}
+
+// revokeFailedCertificate отзывает действующий сертификат студента, если его
+// итог в test_results после пересчета ниже порога, указанного в сертификате
+func revokeFailedCertificate(tx *sql.Tx, testID, userID int) error {
+	query := `UPDATE certificates c
+              SET revoked_at = CURRENT_TIMESTAMP
+              FROM test_results tr
+              WHERE c.test_id = $1 AND c.user_id = $2 AND c.revoked_at IS NULL
+                AND tr.test_id = c.test_id AND tr.user_id = c.user_id
+                AND (tr.max_score <= 0 OR tr.score / tr.max_score * 100 < c.passing_percent)`
+	_, err := tx.Exec(query, testID, userID)
+	return err
+}
+
+// GetCertificate возвращает сертификат по ID или nil
+func (r *AttemptRepository) GetCertificate(id int) (*models.Certificate, error) {
+	return r.getCertificate(`SELECT `+certificateColumns+` FROM certificates WHERE id = $1`, id)
+}
+
+// GetCertificateByCode ищет сертификат по коду проверки или возвращает nil
+func (r *AttemptRepository) GetCertificateByCode(code string) (*models.Certificate, error) {
+	return r.getCertificate(`SELECT `+certificateColumns+` FROM certificates WHERE verification_code = $1`, code)
+}
+
+// GetCertificateByAttempt возвращает сертификат, выданный после этой попытки, или nil
+func (r *AttemptRepository) GetCertificateByAttempt(attemptID int) (*models.Certificate, error) {
+	return r.getCertificate(`SELECT `+certificateColumns+` FROM certificates WHERE attempt_id = $1`, attemptID)
+}
+
+func (r *AttemptRepository) getCertificate(query string, arg interface{}) (*models.Certificate, error) {
+	var c models.Certificate
+	err := scanCertificate(r.db.QueryRow(query, arg), &c)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCertificatePDF возвращает PDF сертификата
+func (r *AttemptRepository) GetCertificatePDF(id int) ([]byte, error) {
+	var pdf []byte
+	err := r.db.QueryRow(`SELECT pdf FROM certificates WHERE id = $1`, id).Scan(&pdf)
+	return pdf, err
+}
+
+// GetUserCertificates возвращает сертификаты студента, новые первыми
+func (r *AttemptRepository) GetUserCertificates(userID int) ([]models.Certificate, error) {
+	query := `SELECT ` + certificateColumns + `
+              FROM certificates
+              WHERE user_id = $1
+              ORDER BY issued_at DESC, id DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var certificates []models.Certificate
+	for rows.Next() {
+		var c models.Certificate
+		if err := scanCertificate(rows, &c); err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, c)
+	}
+
+	return certificates, rows.Err()
+}
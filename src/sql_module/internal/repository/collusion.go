@@ -0,0 +1,413 @@
+package repository
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"sql_module/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Значения по умолчанию и пороги поиска списывания
+const (
+	DefaultMinSharedErrors      = 3
+	DefaultCollusionProbability = 0.01
+
+	collusionCloseInTime         = time.Minute
+	collusionMinTimingQuestions  = 5   // меньше общих вопросов - корреляцию времени не считаем
+	collusionSynchronizedTiming  = 0.8 // корреляция времени ответов
+	collusionSynchronizedAnswers = 2   // одинаковые ошибки, сделанные почти одновременно
+)
+
+type collusionAnswer struct {
+	response   string // ответ в сравнимом виде
+	correct    bool
+	answeredAt time.Time
+	answer     *models.Answer
+}
+
+type collusionAttempt struct {
+	id          int
+	userID      int
+	startedAt   time.Time
+	completedAt time.Time
+	answers     map[questionKey]collusionAnswer
+}
+
+// GetCollusionReport сравнивает ответы завершенных попыток теста попарно.
+// Главный признак - одинаковые неверные ответы: для каждого вопроса считается
+// вероятность, что два независимо ошибившихся студента выберут один и тот же
+// неверный ответ (по частотам неверных ответов всех попыток), и по ним -
+// вероятность набрать не меньше совпадений случайно. Время ответов - вторичный
+// признак, на отбор пар не влияет. Развернутые ответы не сравниваются.
+func (r *AttemptRepository) GetCollusionReport(testID, minSharedErrors int, maxProbability float64) (*models.CollusionReport, error) {
+	report := &models.CollusionReport{
+		TestID:          testID,
+		MinSharedErrors: minSharedErrors,
+		MaxProbability:  maxProbability,
+		Pairs:           []models.CollusionPair{},
+	}
+
+	attemptsQuery := `SELECT id, user_id, started_at, completed_at
+                      FROM attempts
+                      WHERE test_id = $1 AND status = 'completed'
+                      ORDER BY id`
+	rows, err := r.db.Query(attemptsQuery, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attempts []*collusionAttempt
+	byID := make(map[int]*collusionAttempt)
+	for rows.Next() {
+		attempt := &collusionAttempt{answers: make(map[questionKey]collusionAnswer)}
+		var completedAt sql.NullTime
+		if err := rows.Scan(&attempt.id, &attempt.userID, &attempt.startedAt, &completedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attempt.completedAt = attempt.startedAt
+		if completedAt.Valid {
+			attempt.completedAt = completedAt.Time
+		}
+		attempts = append(attempts, attempt)
+		byID[attempt.id] = attempt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Attempts = len(attempts)
+	if len(attempts) < 2 {
+		return report, nil
+	}
+
+	const answersKeys = `SELECT aa.question_id, aa.question_version
+                         FROM attempt_answers aa
+                         JOIN attempts a ON a.id = aa.attempt_id
+                         WHERE a.test_id = $1 AND a.status = 'completed'`
+	questions, err := loadQuestionVersions(r.db, answersKeys, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	answersQuery := `SELECT aa.attempt_id, aa.question_id, aa.question_version, aa.selected_option,
+                            aa.selected_options, aa.text_answer, aa.numeric_answer, aa.is_correct, aa.answered_at
+                     FROM attempt_answers aa
+                     JOIN attempts a ON a.id = aa.attempt_id
+                     WHERE a.test_id = $1 AND a.status = 'completed'`
+	rows, err = r.db.Query(answersQuery, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Частоты неверных ответов по вопросам
+	wrongCounts := make(map[questionKey]map[string]int)
+	wrongTotals := make(map[questionKey]int)
+
+	for rows.Next() {
+		var attemptID int
+		var key questionKey
+		var selectedOption sql.NullInt64
+		var selectedOptions pq.Int64Array
+		var textAnswer sql.NullString
+		var numericAnswer sql.NullFloat64
+		var isCorrect sql.NullBool
+		var answeredAt time.Time
+		err := rows.Scan(&attemptID, &key.ID, &key.Version, &selectedOption, &selectedOptions,
+			&textAnswer, &numericAnswer, &isCorrect, &answeredAt)
+		if err != nil {
+			return nil, err
+		}
+
+		question, ok := questions[key]
+		attempt := byID[attemptID]
+		if !ok || attempt == nil || needsManualGrading(question) || !isCorrect.Valid {
+			continue
+		}
+
+		answer := &models.Answer{SelectedOption: -1}
+		if selectedOption.Valid {
+			answer.SelectedOption = int(selectedOption.Int64)
+		}
+		for _, option := range selectedOptions {
+			answer.SelectedOptions = append(answer.SelectedOptions, int(option))
+		}
+		if textAnswer.Valid {
+			answer.TextAnswer = &textAnswer.String
+		}
+		if numericAnswer.Valid {
+			answer.NumericAnswer = &numericAnswer.Float64
+		}
+
+		if isAnswerOmitted(question, answer) {
+			continue
+		}
+
+		response := comparableResponse(question, answer)
+		attempt.answers[key] = collusionAnswer{
+			response:   response,
+			correct:    isCorrect.Bool,
+			answeredAt: answeredAt,
+			answer:     answer,
+		}
+
+		if !isCorrect.Bool {
+			if wrongCounts[key] == nil {
+				wrongCounts[key] = make(map[string]int)
+			}
+			wrongCounts[key][response]++
+			wrongTotals[key]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Вероятность, что двое ошибившихся независимо дадут одинаковый неверный ответ
+	sameWrong := make(map[questionKey]float64, len(wrongCounts))
+	for key, counts := range wrongCounts {
+		total := float64(wrongTotals[key])
+		for _, count := range counts {
+			share := float64(count) / total
+			sameWrong[key] += share * share
+		}
+	}
+
+	// Для пары студентов оставляем самую подозрительную пару попыток
+	type userPair struct{ a, b int }
+	best := make(map[userPair]models.CollusionPair)
+
+	for i := 0; i < len(attempts); i++ {
+		for j := i + 1; j < len(attempts); j++ {
+			a, b := attempts[i], attempts[j]
+			if a.userID == b.userID {
+				continue
+			}
+			report.PairsCompared++
+
+			pair, ok := compareAttempts(a, b, questions, wrongCounts, wrongTotals, sameWrong, minSharedErrors, maxProbability)
+			if !ok {
+				continue
+			}
+
+			users := userPair{a.userID, b.userID}
+			if users.a > users.b {
+				users.a, users.b = users.b, users.a
+			}
+			if current, exists := best[users]; !exists || collusionPairLess(pair, current) {
+				best[users] = pair
+			}
+		}
+	}
+
+	for _, pair := range best {
+		report.Pairs = append(report.Pairs, pair)
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		return collusionPairLess(report.Pairs[i], report.Pairs[j])
+	})
+
+	return report, nil
+}
+
+// compareAttempts сравнивает ответы двух попыток. ok = false - совпадения
+// ошибок объяснимы случаем
+func compareAttempts(a, b *collusionAttempt, questions map[questionKey]*models.Question,
+	wrongCounts map[questionKey]map[string]int, wrongTotals map[questionKey]int,
+	sameWrong map[questionKey]float64, minSharedErrors int, maxProbability float64) (models.CollusionPair, bool) {
+
+	pair := models.CollusionPair{
+		AttemptA: a.id,
+		UserA:    a.userID,
+		AttemptB: b.id,
+		UserB:    b.userID,
+		Flags:    []string{},
+		Evidence: []models.CollusionEvidence{},
+	}
+
+	var probabilities []float64
+	var offsetsA, offsetsB []float64
+	var sharedKeys []questionKey
+	for key, answerA := range a.answers {
+		answerB, ok := b.answers[key]
+		if !ok {
+			continue
+		}
+		pair.CommonAnswered++
+		offsetsA = append(offsetsA, answerA.answeredAt.Sub(a.startedAt).Seconds())
+		offsetsB = append(offsetsB, answerB.answeredAt.Sub(b.startedAt).Seconds())
+
+		if answerA.response != answerB.response {
+			pair.Differences++
+		}
+		if answerA.correct || answerB.correct {
+			continue
+		}
+
+		pair.BothWrong++
+		probabilities = append(probabilities, sameWrong[key])
+		pair.ExpectedIdenticalWrong += sameWrong[key]
+		if answerA.response == answerB.response {
+			pair.IdenticalWrong++
+			sharedKeys = append(sharedKeys, key)
+		}
+	}
+
+	if pair.IdenticalWrong < minSharedErrors {
+		return pair, false
+	}
+
+	pair.Probability = tailProbability(probabilities, pair.IdenticalWrong)
+	if pair.Probability > maxProbability {
+		return pair, false
+	}
+
+	pair.ErrorSimilarity = round3(float64(pair.IdenticalWrong) / math.Max(float64(pair.Differences), 1))
+	pair.ExpectedIdenticalWrong = round3(pair.ExpectedIdenticalWrong)
+	pair.OverlappingAttempts = a.startedAt.Before(b.completedAt) && b.startedAt.Before(a.completedAt)
+	if len(offsetsA) >= collusionMinTimingQuestions {
+		if r, ok := pearson(offsetsA, offsetsB); ok {
+			r = round3(r)
+			pair.TimingCorrelation = &r
+		}
+	}
+
+	sort.Slice(sharedKeys, func(i, j int) bool {
+		if sharedKeys[i].ID != sharedKeys[j].ID {
+			return sharedKeys[i].ID < sharedKeys[j].ID
+		}
+		return sharedKeys[i].Version < sharedKeys[j].Version
+	})
+	for _, key := range sharedKeys {
+		answerA, answerB := a.answers[key], b.answers[key]
+		question := questions[key]
+
+		gap := answerA.answeredAt.Sub(answerB.answeredAt)
+		if gap < 0 {
+			gap = -gap
+		}
+		if gap <= collusionCloseInTime {
+			pair.CloseInTime++
+		}
+
+		pair.Evidence = append(pair.Evidence, models.CollusionEvidence{
+			QuestionID:      key.ID,
+			QuestionVersion: key.Version,
+			Title:           question.Title,
+			Answer:          displayResponse(question, answerA.answer),
+			AnswerRate:      round3(float64(wrongCounts[key][answerA.response]) / float64(wrongTotals[key])),
+			AnsweredAtA:     answerA.answeredAt,
+			AnsweredAtB:     answerB.answeredAt,
+		})
+	}
+
+	pair.Flags = append(pair.Flags, models.CollusionFlagSharedErrors)
+	if pair.ErrorSimilarity >= 1 {
+		pair.Flags = append(pair.Flags, models.CollusionFlagHighErrorSimilarity)
+	}
+	if hasSynchronizedTiming(&pair) {
+		pair.Flags = append(pair.Flags, models.CollusionFlagSynchronizedTiming)
+	}
+
+	return pair, true
+}
+
+func hasSynchronizedTiming(pair *models.CollusionPair) bool {
+	if !pair.OverlappingAttempts {
+		return false
+	}
+	if pair.CloseInTime >= collusionSynchronizedAnswers {
+		return true
+	}
+	return pair.TimingCorrelation != nil && *pair.TimingCorrelation >= collusionSynchronizedTiming
+}
+
+// collusionPairLess - порядок в отчете: сначала менее вероятные совпадения,
+// при равной вероятности - с синхронным временем ответов, затем с большим числом совпадений
+func collusionPairLess(a, b models.CollusionPair) bool {
+	if a.Probability != b.Probability {
+		return a.Probability < b.Probability
+	}
+	syncA, syncB := hasSynchronizedTiming(&a), hasSynchronizedTiming(&b)
+	if syncA != syncB {
+		return syncA
+	}
+	if a.IdenticalWrong != b.IdenticalWrong {
+		return a.IdenticalWrong > b.IdenticalWrong
+	}
+	if a.AttemptA != b.AttemptA {
+		return a.AttemptA < b.AttemptA
+	}
+	return a.AttemptB < b.AttemptB
+}
+
+// tailProbability - вероятность не меньше k успехов в независимых испытаниях
+// с вероятностями успеха p (пуассон-биномиальное распределение)
+func tailProbability(p []float64, k int) float64 {
+	dist := make([]float64, len(p)+1)
+	dist[0] = 1
+	for i, pi := range p {
+		for j := i + 1; j > 0; j-- {
+			dist[j] = dist[j]*(1-pi) + dist[j-1]*pi
+		}
+		dist[0] *= 1 - pi
+	}
+
+	tail := 0.0
+	for j := k; j < len(dist); j++ {
+		tail += dist[j]
+	}
+	return math.Min(tail, 1)
+}
+
+// comparableResponse приводит ответ к строке, по которой ответы сравниваются между собой
+func comparableResponse(question *models.Question, answer *models.Answer) string {
+	switch question.QuestionType {
+	case models.QuestionTypeMultiple:
+		options := normalizeOptions(answer.SelectedOptions)
+		parts := make([]string, len(options))
+		for i, option := range options {
+			parts[i] = strconv.Itoa(option)
+		}
+		return strings.Join(parts, ",")
+	case models.QuestionTypeText:
+		return normalizeTextAnswer(question, strings.TrimSpace(*answer.TextAnswer))
+	case models.QuestionTypeNumeric:
+		return strconv.FormatFloat(*answer.NumericAnswer, 'g', -1, 64)
+	default:
+		return strconv.Itoa(answer.SelectedOption)
+	}
+}
+
+// displayResponse - ответ в виде, понятном преподавателю: тексты выбранных вариантов
+func displayResponse(question *models.Question, answer *models.Answer) string {
+	optionText := func(option int) string {
+		if option >= 0 && option < len(question.Options) {
+			return question.Options[option]
+		}
+		return strconv.Itoa(option)
+	}
+
+	switch question.QuestionType {
+	case models.QuestionTypeMultiple:
+		options := normalizeOptions(answer.SelectedOptions)
+		texts := make([]string, len(options))
+		for i, option := range options {
+			texts[i] = optionText(option)
+		}
+		return strings.Join(texts, "; ")
+	case models.QuestionTypeText:
+		return strings.TrimSpace(*answer.TextAnswer)
+	case models.QuestionTypeNumeric:
+		return strconv.FormatFloat(*answer.NumericAnswer, 'g', -1, 64)
+	default:
+		return optionText(answer.SelectedOption)
+	}
+}
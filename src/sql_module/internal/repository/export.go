@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"sql_module/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// GetExportQuestions возвращает вопросы, на которые отвечали в завершенных
+// попытках теста, - столбцы выгрузки по вопросам
+func (r *AttemptRepository) GetExportQuestions(testID int) ([]models.ExportQuestion, error) {
+	query := `SELECT DISTINCT ON (aa.question_id) aa.question_id, q.title
+              FROM attempt_answers aa
+              JOIN attempts a ON a.id = aa.attempt_id
+              JOIN questions q ON q.id = aa.question_id AND q.version = aa.question_version
+              WHERE a.test_id = $1 AND a.status = 'completed'
+              ORDER BY aa.question_id, aa.question_version DESC`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []models.ExportQuestion
+	for rows.Next() {
+		var question models.ExportQuestion
+		if err := rows.Scan(&question.QuestionID, &question.Title); err != nil {
+			return nil, err
+		}
+		questions = append(questions, question)
+	}
+
+	return questions, rows.Err()
+}
+
+// ExportTestResults передает в fn завершенные попытки теста по одной, пока
+// курсор открыт, - выгрузка не держит все попытки в памяти. Баллы по вопросам
+// собираются в порядке questionIDs; пустой список - без столбцов по вопросам.
+// Ошибка fn прерывает выгрузку и возвращается как есть.
+func (r *AttemptRepository) ExportTestResults(testID int, questionIDs []int, fn func(*models.ResultExportRow) error) error {
+	query := `SELECT a.id, a.user_id, u.full_name, u.email, a.started_at, a.completed_at,
+                     a.score, a.max_score,
+                     ARRAY(SELECT (SELECT aa.points_awarded FROM attempt_answers aa
+                                   WHERE aa.attempt_id = a.id AND aa.question_id = q.id
+                                   ORDER BY aa.id DESC LIMIT 1)
+                           FROM unnest($2::int[]) WITH ORDINALITY AS q(id, ord)
+                           ORDER BY q.ord)
+              FROM attempts a
+              JOIN users u ON u.id = a.user_id
+              WHERE a.test_id = $1 AND a.status = 'completed'
+              ORDER BY u.full_name, a.user_id, a.started_at`
+
+	if questionIDs == nil {
+		questionIDs = []int{}
+	}
+
+	rows, err := r.db.Query(query, testID, pq.Array(questionIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.ResultExportRow
+		var completedAt sql.NullTime
+		var score sql.NullFloat64
+		var points []sql.NullFloat64
+		err := rows.Scan(&row.AttemptID, &row.UserID, &row.FullName, &row.Email, &row.StartedAt,
+			&completedAt, &score, &row.MaxScore, pq.Array(&points))
+		if err != nil {
+			return err
+		}
+
+		if completedAt.Valid {
+			row.CompletedAt = &completedAt.Time
+		}
+		if score.Valid {
+			row.Score = &score.Float64
+		}
+
+		row.Points = make([]*float64, len(points))
+		for i := range points {
+			if points[i].Valid {
+				row.Points[i] = &points[i].Float64
+			}
+		}
+
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ExportGradebook передает в fn студентов курса по одному вместе с их ячейками
+// журнала (ключ - id теста), пока курсор открыт, - выгрузка не держит журнал
+// в памяти. Ошибка fn прерывает выгрузку и возвращается как есть.
+func (r *AttemptRepository) ExportGradebook(courseID int, testIDs []int, fn func(models.User, map[int]models.GradebookCell) error) error {
+	query := `SELECT u.id, u.full_name, u.email, c.test_id, c.in_progress, c.awaiting_review,
+                     c.attempts_count, c.score, c.max_score
+              FROM course_enrollments ce
+              JOIN users u ON u.id = ce.user_id
+              LEFT JOIN (` + gradebookCellsQuery + `) c ON c.user_id = u.id
+              WHERE ce.course_id = $2 AND ce.role = 'student'
+              ORDER BY u.full_name, u.id`
+
+	rows, err := r.db.Query(query, pq.Array(testIDs), courseID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Строки студента идут подряд; студент передается, когда начинается следующий
+	var student *models.User
+	var cells map[int]models.GradebookCell
+	for rows.Next() {
+		var user models.User
+		var testID, attemptsCount sql.NullInt64
+		var inProgress, awaitingReview sql.NullBool
+		var score, maxScore sql.NullFloat64
+		err := rows.Scan(&user.ID, &user.FullName, &user.Email, &testID, &inProgress, &awaitingReview,
+			&attemptsCount, &score, &maxScore)
+		if err != nil {
+			return err
+		}
+
+		if student == nil || student.ID != user.ID {
+			if student != nil {
+				if err := fn(*student, cells); err != nil {
+					return err
+				}
+			}
+			student = &user
+			cells = make(map[int]models.GradebookCell)
+		}
+
+		if testID.Valid {
+			cells[int(testID.Int64)] = newGradebookCell(int(testID.Int64), user.ID, inProgress.Bool,
+				awaitingReview.Bool, int(attemptsCount.Int64), score, maxScore)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if student != nil {
+		return fn(*student, cells)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"sql_module/internal/models"
+)
+
+// Готовые шкалы оценок
+var gradeScalePresets = map[string]models.GradeScale{
+	"russian_5": {Name: "Пятибалльная", Levels: []models.GradeLevel{
+		{Grade: "5", MinPercent: 85},
+		{Grade: "4", MinPercent: 70},
+		{Grade: "3", MinPercent: 50},
+		{Grade: "2", MinPercent: 0},
+	}},
+	"pass_fail": {Name: "Зачет", Levels: []models.GradeLevel{
+		{Grade: "зачтено", MinPercent: 50},
+		{Grade: "не зачтено", MinPercent: 0},
+	}},
+	"letter": {Name: "Буквенная", Levels: []models.GradeLevel{
+		{Grade: "A", MinPercent: 90},
+		{Grade: "B", MinPercent: 80},
+		{Grade: "C", MinPercent: 70},
+		{Grade: "D", MinPercent: 60},
+		{Grade: "F", MinPercent: 0},
+	}},
+}
+
+// GradeScalePreset возвращает копию готовой шкалы: russian_5, pass_fail или letter
+func GradeScalePreset(name string) (*models.GradeScale, bool) {
+	preset, ok := gradeScalePresets[name]
+	if !ok {
+		return nil, false
+	}
+	scale := preset
+	scale.Levels = append([]models.GradeLevel(nil), preset.Levels...)
+	return &scale, true
+}
+
+// GradeScore считает процент от максимума (с точностью до сотых) и оценку по шкале.
+// scale может быть nil - тогда возвращается только процент.
+func GradeScore(scale *models.GradeScale, score *float64, maxScore float64) (*float64, *string) {
+	if score == nil || maxScore <= 0 {
+		return nil, nil
+	}
+
+	percentage := math.Round(*score/maxScore*10000) / 100
+	if scale == nil {
+		return &percentage, nil
+	}
+
+	for _, level := range scale.Levels {
+		if percentage >= level.MinPercent {
+			grade := level.Grade
+			return &percentage, &grade
+		}
+	}
+
+	return &percentage, nil
+}
+
+// GetGradeScale возвращает шкалу оценок курса или nil, если она не задана
+func (r *CourseRepository) GetGradeScale(courseID int) (*models.GradeScale, error) {
+	scale := &models.GradeScale{CourseID: courseID}
+	query := `SELECT name, updated_at FROM grade_scales WHERE course_id = $1`
+	err := r.db.QueryRow(query, courseID).Scan(&scale.Name, &scale.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	levelsQuery := `SELECT grade, min_percent FROM grade_scale_levels
+                    WHERE course_id = $1
+                    ORDER BY min_percent DESC`
+	rows, err := r.db.Query(levelsQuery, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scale.Levels = []models.GradeLevel{}
+	for rows.Next() {
+		var level models.GradeLevel
+		if err := rows.Scan(&level.Grade, &level.MinPercent); err != nil {
+			return nil, err
+		}
+		scale.Levels = append(scale.Levels, level)
+	}
+
+	return scale, rows.Err()
+}
+
+// SetGradeScale заменяет шкалу оценок курса
+func (r *CourseRepository) SetGradeScale(scale *models.GradeScale) error {
+	sort.Slice(scale.Levels, func(i, j int) bool {
+		return scale.Levels[i].MinPercent > scale.Levels[j].MinPercent
+	})
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsertQuery := `INSERT INTO grade_scales (course_id, name, updated_at)
+                    VALUES ($1, $2, CURRENT_TIMESTAMP)
+                    ON CONFLICT (course_id) DO UPDATE
+                    SET name = EXCLUDED.name, updated_at = EXCLUDED.updated_at
+                    RETURNING updated_at`
+	if err := tx.QueryRow(upsertQuery, scale.CourseID, scale.Name).Scan(&scale.UpdatedAt); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM grade_scale_levels WHERE course_id = $1`, scale.CourseID); err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO grade_scale_levels (course_id, grade, min_percent) VALUES ($1, $2, $3)`
+	for _, level := range scale.Levels {
+		if _, err := tx.Exec(insertQuery, scale.CourseID, level.Grade, level.MinPercent); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteGradeScale убирает шкалу оценок курса
+func (r *CourseRepository) DeleteGradeScale(courseID int) error {
+	result, err := r.db.Exec(`DELETE FROM grade_scales WHERE course_id = $1`, courseID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
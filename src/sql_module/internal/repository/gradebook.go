@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"database/sql"
+	"sql_module/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// GetGradeCategories возвращает категории оценок курса с их тестами
+func (r *CourseRepository) GetGradeCategories(courseID int) ([]models.GradeCategory, error) {
+	query := `SELECT c.id, c.course_id, c.name, c.weight,
+                     COALESCE(array_agg(ct.test_id ORDER BY ct.test_id) FILTER (WHERE ct.test_id IS NOT NULL), '{}')
+              FROM grade_categories c
+              LEFT JOIN grade_category_tests ct ON ct.category_id = c.id
+              WHERE c.course_id = $1
+              GROUP BY c.id
+              ORDER BY c.id`
+
+	rows, err := r.db.Query(query, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.GradeCategory
+	for rows.Next() {
+		var category models.GradeCategory
+		var testIDs pq.Int64Array
+		err := rows.Scan(&category.ID, &category.CourseID, &category.Name, &category.Weight, &testIDs)
+		if err != nil {
+			return nil, err
+		}
+		category.TestIDs = make([]int, len(testIDs))
+		for i, id := range testIDs {
+			category.TestIDs[i] = int(id)
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// SetGradeCategories заменяет категории оценок курса. Принадлежность тестов
+// курсу проверяет вызывающий
+func (r *CourseRepository) SetGradeCategories(courseID int, categories []models.GradeCategory) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM grade_categories WHERE course_id = $1`, courseID); err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO grade_categories (course_id, name, weight) VALUES ($1, $2, $3) RETURNING id`
+	linkQuery := `INSERT INTO grade_category_tests (test_id, category_id) VALUES ($1, $2)`
+	for i := range categories {
+		categories[i].CourseID = courseID
+		err := tx.QueryRow(insertQuery, courseID, categories[i].Name, categories[i].Weight).Scan(&categories[i].ID)
+		if err != nil {
+			return err
+		}
+
+		for _, testID := range categories[i].TestIDs {
+			if _, err := tx.Exec(linkQuery, testID, categories[i].ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// gradebookCellsQuery - состояние студентов по тестам $1 по их попыткам
+const gradebookCellsQuery = `SELECT a.test_id, a.user_id,
+                                    bool_or(a.status = 'in_progress') AS in_progress,
+                                    bool_or(a.status = 'awaiting_review') AS awaiting_review,
+                                    COUNT(*) FILTER (WHERE a.status <> 'cancelled') AS attempts_count,
+                                    tr.score, tr.max_score
+                             FROM attempts a
+                             LEFT JOIN test_results tr ON tr.test_id = a.test_id AND tr.user_id = a.user_id
+                             WHERE a.test_id = ANY($1)
+                             GROUP BY a.test_id, a.user_id, tr.score, tr.max_score`
+
+// GetGradebookCells возвращает состояние студентов по тестам. Пары
+// студент-тест без попыток в результат не попадают
+func (r *AttemptRepository) GetGradebookCells(testIDs []int) ([]models.GradebookCell, error) {
+	rows, err := r.db.Query(gradebookCellsQuery, pq.Array(testIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cells []models.GradebookCell
+	for rows.Next() {
+		var testID, userID, attemptsCount int
+		var inProgress, awaitingReview bool
+		var score, maxScore sql.NullFloat64
+		err := rows.Scan(&testID, &userID, &inProgress, &awaitingReview, &attemptsCount, &score, &maxScore)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, newGradebookCell(testID, userID, inProgress, awaitingReview, attemptsCount, score, maxScore))
+	}
+
+	return cells, rows.Err()
+}
+
+func newGradebookCell(testID, userID int, inProgress, awaitingReview bool, attemptsCount int,
+	score, maxScore sql.NullFloat64) models.GradebookCell {
+
+	cell := models.GradebookCell{TestID: testID, UserID: userID, AttemptsCount: attemptsCount}
+	if score.Valid {
+		cell.Score = &score.Float64
+		cell.MaxScore = &maxScore.Float64
+		cell.Percentage, _ = GradeScore(nil, cell.Score, maxScore.Float64)
+	}
+
+	// Идущая попытка важнее уже засчитанного результата: он еще может измениться
+	switch {
+	case inProgress:
+		cell.Status = models.GradebookInProgress
+	case awaitingReview:
+		cell.Status = models.GradebookAwaitingReview
+	case score.Valid:
+		cell.Status = models.GradebookCompleted
+	default:
+		cell.Status = models.GradebookNotStarted
+	}
+	return cell
+}
+
+// GradebookLayout - тесты, категории и шкала журнала, общие для всех его строк
+type GradebookLayout struct {
+	Tests      []models.Test
+	Categories []models.GradeCategory
+	Scale      *models.GradeScale
+
+	categoryOf map[int]int // id теста -> id категории
+}
+
+func NewGradebookLayout(tests []models.Test, categories []models.GradeCategory, scale *models.GradeScale) *GradebookLayout {
+	categoryOf := make(map[int]int)
+	for _, category := range categories {
+		for _, testID := range category.TestIDs {
+			categoryOf[testID] = category.ID
+		}
+	}
+	return &GradebookLayout{Tests: tests, Categories: categories, Scale: scale, categoryOf: categoryOf}
+}
+
+// TestIDs возвращает id тестов журнала в порядке столбцов
+func (l *GradebookLayout) TestIDs() []int {
+	testIDs := make([]int, len(l.Tests))
+	for i, test := range l.Tests {
+		testIDs[i] = test.ID
+	}
+	return testIDs
+}
+
+// BuildGradebook собирает журнал оценок из строк студентов (см. GradebookLayout.Row)
+func BuildGradebook(courseID int, layout *GradebookLayout, students []models.User, cells []models.GradebookCell) *models.Gradebook {
+	gradebook := &models.Gradebook{
+		CourseID:   courseID,
+		Tests:      make([]models.GradebookTest, len(layout.Tests)),
+		Categories: layout.Categories,
+		GradeScale: layout.Scale,
+		Students:   make([]models.GradebookRow, len(students)),
+	}
+	if gradebook.Categories == nil {
+		gradebook.Categories = []models.GradeCategory{}
+	}
+
+	for i, test := range layout.Tests {
+		gradebook.Tests[i] = models.GradebookTest{ID: test.ID, Title: test.Title, IsActive: test.IsActive}
+		if categoryID, ok := layout.categoryOf[test.ID]; ok {
+			gradebook.Tests[i].CategoryID = &categoryID
+		}
+	}
+
+	cellsOf := make(map[int]map[int]models.GradebookCell)
+	for _, cell := range cells {
+		if cellsOf[cell.UserID] == nil {
+			cellsOf[cell.UserID] = make(map[int]models.GradebookCell)
+		}
+		cellsOf[cell.UserID][cell.TestID] = cell
+	}
+
+	for i, student := range students {
+		gradebook.Students[i] = layout.Row(student, cellsOf[student.ID])
+	}
+
+	return gradebook
+}
+
+// Row считает строку журнала студента по его ячейкам (ключ - id теста).
+// В итог входят только оцененные тесты: не начатый тест не считается нулем.
+// Если у курса есть категории, итог - средневзвешенный процент категорий,
+// в которых есть оценки, а тесты вне категорий в него не входят.
+// Без категорий итог - процент от суммы баллов.
+func (l *GradebookLayout) Row(student models.User, cells map[int]models.GradebookCell) models.GradebookRow {
+	row := models.GradebookRow{
+		UserID:     student.ID,
+		FullName:   student.FullName,
+		Email:      student.Email,
+		Cells:      make([]models.GradebookCell, len(l.Tests)),
+		Categories: make([]models.GradebookCategoryCell, len(l.Categories)),
+	}
+
+	categoryIndex := make(map[int]int, len(l.Categories))
+	for j, category := range l.Categories {
+		categoryIndex[category.ID] = j
+		row.Categories[j].CategoryID = category.ID
+	}
+
+	for j, test := range l.Tests {
+		cell, ok := cells[test.ID]
+		if !ok {
+			cell = models.GradebookCell{TestID: test.ID, UserID: student.ID, Status: models.GradebookNotStarted}
+		}
+		row.Cells[j] = cell
+
+		if cell.Score == nil {
+			continue
+		}
+		row.TotalScore += *cell.Score
+		row.TotalMaxScore += *cell.MaxScore
+
+		if categoryID, ok := l.categoryOf[test.ID]; ok {
+			categoryCell := &row.Categories[categoryIndex[categoryID]]
+			categoryCell.Score += *cell.Score
+			categoryCell.MaxScore += *cell.MaxScore
+		}
+	}
+
+	row.TotalScore = round2(row.TotalScore)
+	row.TotalMaxScore = round2(row.TotalMaxScore)
+	row.Percentage, _ = GradeScore(nil, &row.TotalScore, row.TotalMaxScore)
+
+	if len(l.Categories) == 0 {
+		row.FinalPercentage, row.FinalGrade = GradeScore(l.Scale, &row.TotalScore, row.TotalMaxScore)
+		return row
+	}
+
+	var weighted, weightSum float64
+	for j := range row.Categories {
+		categoryCell := &row.Categories[j]
+		categoryCell.Score = round2(categoryCell.Score)
+		categoryCell.MaxScore = round2(categoryCell.MaxScore)
+		categoryCell.Percentage, _ = GradeScore(nil, &categoryCell.Score, categoryCell.MaxScore)
+		if categoryCell.Percentage == nil {
+			continue
+		}
+		weighted += l.Categories[j].Weight * *categoryCell.Percentage
+		weightSum += l.Categories[j].Weight
+	}
+	if weightSum > 0 {
+		final := weighted / weightSum
+		row.FinalPercentage, row.FinalGrade = GradeScore(l.Scale, &final, 100)
+	}
+
+	return row
+}
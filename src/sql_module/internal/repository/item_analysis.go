@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"database/sql"
+	"sort"
+	"sql_module/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Пороги признаков в анализе вопросов
+const (
+	itemTooHardBelow       = 0.2  // доля верных ответов
+	itemTooEasyAbove       = 0.95 // доля верных ответов
+	itemLowDiscrimination  = 0.2  // точечно-бисериальная корреляция
+	itemHighOmitRate       = 0.25
+	itemMinPresentedToFlag = 5 // на меньшей выборке признаки не выставляем
+)
+
+// itemAccumulator собирает ответы на одну версию вопроса
+type itemAccumulator struct {
+	question *models.Question
+	tests    map[int]bool
+	correct  []float64 // 1 - верный ответ, по каждому показу
+	totals   []float64 // итог попытки в процентах, по каждому показу
+	answered int
+	// выбравшие вариант: число и сумма итогов
+	optionCounts []int
+	optionTotals []float64
+}
+
+// GetItemAnalysis считает по завершенным попыткам тестов для каждой версии вопроса
+// долю верных ответов, точечно-бисериальную корреляцию с итогом попытки,
+// частоту выбора вариантов и долю пропусков. Итог попытки берется в процентах
+// от ее максимума, чтобы попытки разных тестов были сопоставимы.
+func (r *AttemptRepository) GetItemAnalysis(testIDs []int) (*models.ItemAnalysisReport, error) {
+	report := &models.ItemAnalysisReport{TestIDs: testIDs, Items: []models.ItemAnalysis{}}
+
+	totals := make(map[int]float64)
+	testOf := make(map[int]int)
+	attemptsQuery := `SELECT id, test_id, COALESCE(score, 0), max_score
+                      FROM attempts
+                      WHERE test_id = ANY($1) AND status = 'completed'`
+	rows, err := r.db.Query(attemptsQuery, pq.Array(testIDs))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var attemptID, testID int
+		var score, maxScore float64
+		if err := rows.Scan(&attemptID, &testID, &score, &maxScore); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if maxScore > 0 {
+			totals[attemptID] = score / maxScore * 100
+		}
+		testOf[attemptID] = testID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Attempts = len(testOf)
+	if report.Attempts == 0 {
+		return report, nil
+	}
+
+	// Показанные вопросы берем из набора попытки, а для старых попыток без набора - из ответов
+	const presentedQuery = `WITH done AS (
+                                SELECT id FROM attempts WHERE test_id = ANY($1) AND status = 'completed'
+                            )
+                            SELECT attempt_id, question_id, question_version FROM attempt_questions
+                            WHERE attempt_id IN (SELECT id FROM done)
+                            UNION
+                            SELECT attempt_id, question_id, question_version FROM attempt_answers
+                            WHERE attempt_id IN (SELECT id FROM done)`
+
+	questions, err := loadQuestionVersions(r.db,
+		`SELECT question_id, question_version FROM (`+presentedQuery+`) p`, pq.Array(testIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT p.attempt_id, p.question_id, p.question_version,
+                     aa.id, aa.selected_option, aa.selected_options, aa.text_answer, aa.numeric_answer,
+                     COALESCE(aa.is_correct, false)
+              FROM (` + presentedQuery + `) p
+              LEFT JOIN attempt_answers aa
+                     ON aa.attempt_id = p.attempt_id AND aa.question_id = p.question_id
+                    AND aa.question_version = p.question_version`
+	rows, err = r.db.Query(query, pq.Array(testIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[questionKey]*itemAccumulator)
+	for rows.Next() {
+		var attemptID int
+		var key questionKey
+		var answerID, selectedOption sql.NullInt64
+		var selectedOptions pq.Int64Array
+		var textAnswer sql.NullString
+		var numericAnswer sql.NullFloat64
+		var correct bool
+		err := rows.Scan(&attemptID, &key.ID, &key.Version, &answerID, &selectedOption,
+			&selectedOptions, &textAnswer, &numericAnswer, &correct)
+		if err != nil {
+			return nil, err
+		}
+
+		question, ok := questions[key]
+		if !ok {
+			continue
+		}
+
+		item, ok := items[key]
+		if !ok {
+			item = &itemAccumulator{
+				question:     question,
+				tests:        make(map[int]bool),
+				optionCounts: make([]int, len(question.Options)),
+				optionTotals: make([]float64, len(question.Options)),
+			}
+			items[key] = item
+		}
+
+		total := totals[attemptID]
+		item.tests[testOf[attemptID]] = true
+		item.totals = append(item.totals, total)
+
+		answer := models.Answer{SelectedOption: -1}
+		if selectedOption.Valid {
+			answer.SelectedOption = int(selectedOption.Int64)
+		}
+		for _, option := range selectedOptions {
+			answer.SelectedOptions = append(answer.SelectedOptions, int(option))
+		}
+		if textAnswer.Valid {
+			answer.TextAnswer = &textAnswer.String
+		}
+		if numericAnswer.Valid {
+			answer.NumericAnswer = &numericAnswer.Float64
+		}
+
+		if !answerID.Valid || isAnswerOmitted(question, &answer) {
+			item.correct = append(item.correct, 0)
+			continue
+		}
+
+		item.answered++
+		if correct {
+			item.correct = append(item.correct, 1)
+		} else {
+			item.correct = append(item.correct, 0)
+		}
+
+		chosen := answer.SelectedOptions
+		if question.QuestionType == models.QuestionTypeSingle {
+			chosen = []int{answer.SelectedOption}
+		}
+		for _, option := range chosen {
+			if option >= 0 && option < len(item.optionCounts) {
+				item.optionCounts[option]++
+				item.optionTotals[option] += total
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		report.Items = append(report.Items, buildItemAnalysis(item))
+	}
+
+	sort.Slice(report.Items, func(i, j int) bool {
+		a, b := report.Items[i], report.Items[j]
+		if a.QuestionID != b.QuestionID {
+			return a.QuestionID < b.QuestionID
+		}
+		return a.QuestionVersion < b.QuestionVersion
+	})
+
+	return report, nil
+}
+
+func buildItemAnalysis(item *itemAccumulator) models.ItemAnalysis {
+	question := item.question
+	presented := len(item.correct)
+	analysis := models.ItemAnalysis{
+		QuestionID:      question.ID,
+		QuestionVersion: question.Version,
+		Title:           question.Title,
+		QuestionType:    question.QuestionType,
+		TestIDs:         []int{},
+		Presented:       presented,
+		Answered:        item.answered,
+		Flags:           []string{},
+	}
+
+	for testID := range item.tests {
+		analysis.TestIDs = append(analysis.TestIDs, testID)
+	}
+	sort.Ints(analysis.TestIDs)
+
+	for _, c := range item.correct {
+		if c == 1 {
+			analysis.Correct++
+		}
+	}
+
+	if presented == 0 {
+		return analysis
+	}
+
+	difficulty := round3(float64(analysis.Correct) / float64(presented))
+	analysis.Difficulty = &difficulty
+	analysis.OmitRate = round3(float64(presented-item.answered) / float64(presented))
+
+	if r, ok := pearson(item.correct, item.totals); ok {
+		discrimination := round3(r)
+		analysis.Discrimination = &discrimination
+	}
+
+	isChoice := question.QuestionType == models.QuestionTypeSingle || question.QuestionType == models.QuestionTypeMultiple
+	maxCorrectCount, maxDistractorCount := 0, 0
+	if isChoice {
+		correctOptions := map[int]bool{question.CorrectOption: true}
+		if question.QuestionType == models.QuestionTypeMultiple {
+			correctOptions = make(map[int]bool)
+			for _, option := range question.CorrectOptions {
+				correctOptions[option] = true
+			}
+		}
+
+		for i, text := range question.Options {
+			option := models.OptionAnalysis{
+				Index:     i,
+				Text:      text,
+				IsCorrect: correctOptions[i],
+				Count:     item.optionCounts[i],
+				Rate:      round3(float64(item.optionCounts[i]) / float64(presented)),
+			}
+			if option.Count > 0 {
+				meanTotal := round3(item.optionTotals[i] / float64(option.Count))
+				option.MeanTotal = &meanTotal
+			}
+			analysis.Options = append(analysis.Options, option)
+
+			if option.IsCorrect && option.Count > maxCorrectCount {
+				maxCorrectCount = option.Count
+			} else if !option.IsCorrect && option.Count > maxDistractorCount {
+				maxDistractorCount = option.Count
+			}
+		}
+	}
+
+	if presented < itemMinPresentedToFlag {
+		return analysis
+	}
+
+	if difficulty < itemTooHardBelow {
+		analysis.Flags = append(analysis.Flags, models.ItemFlagTooHard)
+	} else if difficulty > itemTooEasyAbove {
+		analysis.Flags = append(analysis.Flags, models.ItemFlagTooEasy)
+	}
+	if analysis.Discrimination != nil {
+		if *analysis.Discrimination < 0 {
+			analysis.Flags = append(analysis.Flags, models.ItemFlagNegativeDiscrimination)
+		} else if *analysis.Discrimination < itemLowDiscrimination {
+			analysis.Flags = append(analysis.Flags, models.ItemFlagLowDiscrimination)
+		}
+	}
+	if isChoice && maxDistractorCount > maxCorrectCount {
+		analysis.Flags = append(analysis.Flags, models.ItemFlagDistractorPreferred)
+	}
+	if analysis.OmitRate > itemHighOmitRate {
+		analysis.Flags = append(analysis.Flags, models.ItemFlagHighOmitRate)
+	}
+
+	return analysis
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sql_module/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// DefaultMasteryThreshold - порог освоения результата обучения по умолчанию, процент
+const DefaultMasteryThreshold = 70
+
+const outcomeColumns = `o.id, o.course_id, o.code, o.title, COALESCE(o.description, ''), o.mastery_threshold, o.created_at,
+                        COALESCE(array_agg(qo.question_id ORDER BY qo.question_id) FILTER (WHERE qo.question_id IS NOT NULL), '{}')`
+
+func scanOutcome(row rowScanner, outcome *models.LearningOutcome) error {
+	var questionIDs pq.Int64Array
+	err := row.Scan(&outcome.ID, &outcome.CourseID, &outcome.Code, &outcome.Title, &outcome.Description,
+		&outcome.MasteryThreshold, &outcome.CreatedAt, &questionIDs)
+	if err != nil {
+		return err
+	}
+
+	outcome.QuestionIDs = make([]int, len(questionIDs))
+	for i, id := range questionIDs {
+		outcome.QuestionIDs[i] = int(id)
+	}
+	return nil
+}
+
+// GetOutcomes возвращает результаты обучения курса с привязанными вопросами
+func (r *CourseRepository) GetOutcomes(courseID int) ([]models.LearningOutcome, error) {
+	query := `SELECT ` + outcomeColumns + `
+              FROM learning_outcomes o
+              LEFT JOIN question_outcomes qo ON qo.outcome_id = o.id
+              WHERE o.course_id = $1
+              GROUP BY o.id
+              ORDER BY o.id`
+
+	rows, err := r.db.Query(query, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outcomes []models.LearningOutcome
+	for rows.Next() {
+		var outcome models.LearningOutcome
+		if err := scanOutcome(rows, &outcome); err != nil {
+			return nil, err
+		}
+		outcomes = append(outcomes, outcome)
+	}
+
+	return outcomes, rows.Err()
+}
+
+// GetOutcome возвращает результат обучения или nil, если его нет
+func (r *CourseRepository) GetOutcome(outcomeID int) (*models.LearningOutcome, error) {
+	query := `SELECT ` + outcomeColumns + `
+              FROM learning_outcomes o
+              LEFT JOIN question_outcomes qo ON qo.outcome_id = o.id
+              WHERE o.id = $1
+              GROUP BY o.id`
+
+	var outcome models.LearningOutcome
+	err := scanOutcome(r.db.QueryRow(query, outcomeID), &outcome)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &outcome, nil
+}
+
+func (r *CourseRepository) CreateOutcome(outcome *models.LearningOutcome) error {
+	query := `INSERT INTO learning_outcomes (course_id, code, title, description, mastery_threshold)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id, created_at`
+	outcome.QuestionIDs = []int{}
+	return r.db.QueryRow(query, outcome.CourseID, outcome.Code, outcome.Title, outcome.Description,
+		outcome.MasteryThreshold).Scan(&outcome.ID, &outcome.CreatedAt)
+}
+
+func (r *CourseRepository) UpdateOutcome(outcome *models.LearningOutcome) error {
+	query := `UPDATE learning_outcomes
+              SET code = $1, title = $2, description = $3, mastery_threshold = $4
+              WHERE id = $5`
+	_, err := r.db.Exec(query, outcome.Code, outcome.Title, outcome.Description, outcome.MasteryThreshold, outcome.ID)
+	return err
+}
+
+func (r *CourseRepository) DeleteOutcome(outcomeID int) error {
+	result, err := r.db.Exec(`DELETE FROM learning_outcomes WHERE id = $1`, outcomeID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetOutcomeQuestions заменяет вопросы, проверяющие результат обучения. Привязать
+// можно только вопросы преподавателя курса и вопросы, которые есть в тестах курса
+// (в списке теста или в наборах попыток при пулах)
+func (r *CourseRepository) SetOutcomeQuestions(outcomeID int, questionIDs []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(questionIDs) > 0 {
+		var foreign sql.NullInt64
+		foreignQuery := `SELECT MIN(q.id)
+                         FROM unnest($1::int[]) AS q(id)
+                         JOIN learning_outcomes o ON o.id = $2
+                         JOIN courses c ON c.id = o.course_id
+                         WHERE NOT EXISTS (SELECT 1 FROM questions qs
+                                           WHERE qs.id = q.id AND qs.author_id = c.teacher_id)
+                           AND NOT EXISTS (SELECT 1 FROM test_questions tq
+                                           JOIN tests t ON t.id = tq.test_id
+                                           WHERE tq.question_id = q.id AND t.course_id = c.id)
+                           AND NOT EXISTS (SELECT 1 FROM attempt_questions aq
+                                           JOIN attempts a ON a.id = aq.attempt_id
+                                           JOIN tests t ON t.id = a.test_id
+                                           WHERE aq.question_id = q.id AND t.course_id = c.id)`
+		if err := tx.QueryRow(foreignQuery, pq.Array(questionIDs), outcomeID).Scan(&foreign); err != nil {
+			return err
+		}
+		if foreign.Valid {
+			return &QuestionError{Message: fmt.Sprintf("Question %d not found in this course", foreign.Int64)}
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM question_outcomes WHERE outcome_id = $1`, outcomeID); err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO question_outcomes (outcome_id, question_id)
+                    SELECT $1::int, q.id FROM (SELECT DISTINCT unnest($2::int[]) AS id) q`
+	if _, err := tx.Exec(insertQuery, outcomeID, pq.Array(questionIDs)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetOutcomeMastery считает освоение результатов обучения студентами userIDs
+// по всем их завершенным попыткам тестов курса. За каждый показ вопроса
+// результат получает баллы за вопрос (штраф не уводит ниже нуля) из максимума,
+// равного весу вопроса; ответы, ждущие ручной проверки, не учитываются.
+// Результат - по каждому студенту список в порядке outcomes.
+func (r *AttemptRepository) GetOutcomeMastery(courseID int, outcomes []models.LearningOutcome, userIDs []int) (map[int][]models.OutcomeMastery, error) {
+	mastery := make(map[int][]models.OutcomeMastery, len(userIDs))
+	for _, userID := range userIDs {
+		list := make([]models.OutcomeMastery, len(outcomes))
+		for i, outcome := range outcomes {
+			list[i] = models.OutcomeMastery{OutcomeID: outcome.ID, Code: outcome.Code, Title: outcome.Title}
+		}
+		mastery[userID] = list
+	}
+
+	// Вопрос может проверять несколько результатов
+	outcomesOf := make(map[int][]int)
+	for i, outcome := range outcomes {
+		for _, questionID := range outcome.QuestionIDs {
+			outcomesOf[questionID] = append(outcomesOf[questionID], i)
+		}
+	}
+
+	if len(outcomesOf) > 0 && len(userIDs) > 0 {
+		query := `SELECT a.user_id, a.score_breakdown
+                  FROM attempts a
+                  JOIN tests t ON t.id = a.test_id
+                  WHERE t.course_id = $1 AND a.user_id = ANY($2)
+                    AND a.status = 'completed' AND a.score_breakdown IS NOT NULL`
+		rows, err := r.db.Query(query, courseID, pq.Array(userIDs))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var userID int
+			var raw string
+			if err := rows.Scan(&userID, &raw); err != nil {
+				return nil, err
+			}
+
+			var breakdown models.ScoreBreakdown
+			if err := json.Unmarshal([]byte(raw), &breakdown); err != nil {
+				return nil, err
+			}
+
+			list := mastery[userID]
+			inAttempt := make(map[int]bool)
+			for _, question := range breakdown.Questions {
+				if question.Points == nil || question.Weight <= 0 {
+					continue
+				}
+				for _, i := range outcomesOf[question.QuestionID] {
+					list[i].Score += math.Min(math.Max(*question.Points, 0), question.Weight)
+					list[i].MaxScore += question.Weight
+					list[i].Evidence++
+					inAttempt[i] = true
+				}
+			}
+			for i := range inAttempt {
+				list[i].Attempts++
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, list := range mastery {
+		for i := range list {
+			list[i].Score = round2(list[i].Score)
+			list[i].MaxScore = round2(list[i].MaxScore)
+			list[i].Mastery, _ = GradeScore(nil, &list[i].Score, list[i].MaxScore)
+
+			switch {
+			case list[i].Mastery == nil:
+				list[i].Status = models.MasteryNotAssessed
+			case *list[i].Mastery >= outcomes[i].MasteryThreshold:
+				list[i].Status = models.MasteryMastered
+			default:
+				list[i].Status = models.MasteryNotMastered
+			}
+		}
+	}
+
+	return mastery, nil
+}
+
+// SummarizeMastery сводит освоение каждого результата обучения по студентам
+func SummarizeMastery(outcomes []models.LearningOutcome, students []models.StudentMastery) []models.OutcomeSummary {
+	summaries := make([]models.OutcomeSummary, len(outcomes))
+	for i, outcome := range outcomes {
+		summary := models.OutcomeSummary{
+			OutcomeID:        outcome.ID,
+			Code:             outcome.Code,
+			Title:            outcome.Title,
+			MasteryThreshold: outcome.MasteryThreshold,
+		}
+
+		var values []float64
+		for _, student := range students {
+			cell := student.Outcomes[i]
+			switch cell.Status {
+			case models.MasteryMastered:
+				summary.Mastered++
+			case models.MasteryNotMastered:
+				summary.NotMastered++
+			}
+			if cell.Mastery != nil {
+				values = append(values, *cell.Mastery)
+			}
+		}
+
+		summary.Assessed = len(values)
+		if len(values) > 0 {
+			meanMastery := round2(mean(values))
+			summary.MeanMastery = &meanMastery
+		}
+		summaries[i] = summary
+	}
+	return summaries
+}
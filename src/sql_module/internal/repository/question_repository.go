@@ -24,6 +24,89 @@ func NewQuestionRepository(db *sql.DB) *QuestionRepository {
 	return &QuestionRepository{db: db}
 }
 
+const questionColumns = `id, title, text, question_type, options, correct_option, correct_options,
+                     points, author_id, version, is_deleted, created_at,
+                     accepted_answers, case_sensitive, normalize_spaces, use_regex,
+                     numeric_answer, tolerance, tolerance_type, tags,
+                     explanation, option_explanations`
+
+func scanQuestion(row rowScanner, question *models.Question) error {
+	var options pq.StringArray
+	var correctOptions pq.Int64Array
+	var acceptedAnswers pq.StringArray
+	var numericAnswer sql.NullFloat64
+	var toleranceType sql.NullString
+	var tags pq.StringArray
+	var explanation sql.NullString
+	var optionExplanations pq.StringArray
+
+	err := row.Scan(
+		&question.ID,
+		&question.Title,
+		&question.Text,
+		&question.QuestionType,
+		&options,
+		&question.CorrectOption,
+		&correctOptions,
+		&question.Points,
+		&question.AuthorID,
+		&question.Version,
+		&question.IsDeleted,
+		&question.CreatedAt,
+		&acceptedAnswers,
+		&question.CaseSensitive,
+		&question.NormalizeSpaces,
+		&question.UseRegex,
+		&numericAnswer,
+		&question.Tolerance,
+		&toleranceType,
+		&tags,
+		&explanation,
+		&optionExplanations,
+	)
+	if err != nil {
+		return err
+	}
+
+	question.Options = []string(options)
+	if question.Options == nil {
+		question.Options = []string{}
+	}
+	question.CorrectOptions = intsFromArray(correctOptions)
+	if len(acceptedAnswers) > 0 {
+		question.AcceptedAnswers = []string(acceptedAnswers)
+	}
+	if numericAnswer.Valid {
+		question.NumericAnswer = &numericAnswer.Float64
+	}
+	question.ToleranceType = toleranceType.String
+	question.Tags = []string(tags)
+	if question.Tags == nil {
+		question.Tags = []string{}
+	}
+	question.Explanation = explanation.String
+	if len(optionExplanations) > 0 {
+		question.OptionExplanations = []string(optionExplanations)
+	}
+	return nil
+}
+
+// nullString превращает пустую строку в NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func intsFromArray(values pq.Int64Array) []int {
+	if values == nil {
+		return nil
+	}
+	result := make([]int, len(values))
+	for i, v := range values {
+		result[i] = int(v)
+	}
+	return result
+}
+
 func (r *QuestionRepository) Create(question *models.Question) error {
 	// Проверяем, что автор существует
 	var userExists bool
@@ -36,17 +119,43 @@ func (r *QuestionRepository) Create(question *models.Question) error {
 		return &QuestionError{Message: "Author does not exist"}
 	}
 
-	query := `INSERT INTO questions (title, text, options, correct_option, points, author_id, version) 
-              VALUES ($1, $2, $3, $4, $5, $6, 1) 
+	if question.QuestionType == "" {
+		question.QuestionType = models.QuestionTypeSingle
+	}
+	if question.Options == nil {
+		question.Options = []string{}
+	}
+	if question.Tags == nil {
+		question.Tags = []string{}
+	}
+
+	query := `INSERT INTO questions (title, text, question_type, options, correct_option, correct_options,
+                                     points, author_id, version,
+                                     accepted_answers, case_sensitive, normalize_spaces, use_regex,
+                                     numeric_answer, tolerance, tolerance_type, tags,
+                                     explanation, option_explanations) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18) 
               RETURNING id, created_at`
 
 	err = r.db.QueryRow(query,
 		question.Title,
 		question.Text,
+		question.QuestionType,
 		pq.Array(question.Options), // Здесь исправление!
 		question.CorrectOption,
+		pq.Array(question.CorrectOptions),
 		question.Points,
-		question.AuthorID).
+		question.AuthorID,
+		pq.Array(question.AcceptedAnswers),
+		question.CaseSensitive,
+		question.NormalizeSpaces,
+		question.UseRegex,
+		question.NumericAnswer,
+		question.Tolerance,
+		nullString(question.ToleranceType),
+		pq.Array(question.Tags),
+		nullString(question.Explanation),
+		pq.Array(question.OptionExplanations)).
 		Scan(&question.ID, &question.CreatedAt)
 
 	question.Version = 1
@@ -55,8 +164,7 @@ func (r *QuestionRepository) Create(question *models.Question) error {
 }
 
 func (r *QuestionRepository) GetByID(id int) (*models.Question, error) {
-	query := `SELECT id, title, text, options, correct_option, points, author_id, 
-                     version, is_deleted, created_at 
+	query := `SELECT ` + questionColumns + ` 
               FROM questions 
               WHERE id = $1 AND is_deleted = false 
               ORDER BY version DESC 
@@ -64,21 +172,7 @@ func (r *QuestionRepository) GetByID(id int) (*models.Question, error) {
 	row := r.db.QueryRow(query, id)
 
 	var question models.Question
-	var options pq.StringArray
-
-	err := row.Scan(
-		&question.ID,
-		&question.Title,
-		&question.Text,
-		&options,
-		&question.CorrectOption,
-		&question.Points,
-		&question.AuthorID,
-		&question.Version,
-		&question.IsDeleted,
-		&question.CreatedAt,
-	)
-
+	err := scanQuestion(row, &question)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -86,13 +180,11 @@ func (r *QuestionRepository) GetByID(id int) (*models.Question, error) {
 		return nil, err
 	}
 
-	question.Options = []string(options)
 	return &question, nil
 }
 
 func (r *QuestionRepository) GetByTeacher(teacherID int) ([]models.Question, error) {
-	query := `SELECT DISTINCT ON (id) id, title, text, options, correct_option, points, 
-                     author_id, version, is_deleted, created_at 
+	query := `SELECT DISTINCT ON (id) ` + questionColumns + ` 
               FROM questions 
               WHERE author_id = $1 AND is_deleted = false 
               ORDER BY id, version DESC`
@@ -105,25 +197,10 @@ func (r *QuestionRepository) GetByTeacher(teacherID int) ([]models.Question, err
 	var questions []models.Question
 	for rows.Next() {
 		var question models.Question
-		var options pq.StringArray
-
-		err := rows.Scan(
-			&question.ID,
-			&question.Title,
-			&question.Text,
-			&options,
-			&question.CorrectOption,
-			&question.Points,
-			&question.AuthorID,
-			&question.Version,
-			&question.IsDeleted,
-			&question.CreatedAt,
-		)
-		if err != nil {
+		if err := scanQuestion(rows, &question); err != nil {
 			return nil, err
 		}
 
-		question.Options = []string(options)
 		questions = append(questions, question)
 	}
 	return questions, nil
@@ -135,6 +212,11 @@ func (r *QuestionRepository) Update(question *models.Question) error {
         SELECT 1 FROM test_questions tq
         JOIN tests t ON tq.test_id = t.id
         WHERE tq.question_id = $1 AND t.is_active = true AND t.is_deleted = false
+    ) OR EXISTS(
+        SELECT 1 FROM test_pool_rules pr
+        JOIN tests t ON pr.test_id = t.id
+        JOIN questions q ON q.id = $1 AND q.author_id = t.teacher_id AND pr.tag = ANY(q.tags)
+        WHERE t.is_active = true AND t.is_deleted = false
     )`
 	err := r.db.QueryRow(checkQuery, question.ID).Scan(&usedInActiveTests)
 	if err != nil {
@@ -158,25 +240,42 @@ func (r *QuestionRepository) createNewVersion(question *models.Question) error {
 		return err
 	}
 
-	query := `INSERT INTO questions (id, title, text, options, correct_option, points, author_id, version) 
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+	query := `INSERT INTO questions (id, title, text, question_type, options, correct_option, correct_options,
+                                     points, author_id, version,
+                                     accepted_answers, case_sensitive, normalize_spaces, use_regex,
+                                     numeric_answer, tolerance, tolerance_type, tags,
+                                     explanation, option_explanations) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) 
               RETURNING created_at`
 
 	err = r.db.QueryRow(query,
 		question.ID,
 		question.Title,
 		question.Text,
+		question.QuestionType,
 		pq.Array(question.Options),
 		question.CorrectOption,
+		pq.Array(question.CorrectOptions),
 		question.Points,
 		question.AuthorID,
-		maxVersion+1).
+		maxVersion+1,
+		pq.Array(question.AcceptedAnswers),
+		question.CaseSensitive,
+		question.NormalizeSpaces,
+		question.UseRegex,
+		question.NumericAnswer,
+		question.Tolerance,
+		nullString(question.ToleranceType),
+		pq.Array(question.Tags),
+		nullString(question.Explanation),
+		pq.Array(question.OptionExplanations)).
 		Scan(&question.CreatedAt)
 
 	if err != nil {
 		return err
 	}
 
+	question.Version = maxVersion + 1
 	return nil
 }
 
@@ -189,15 +288,29 @@ func (r *QuestionRepository) updateCurrentVersion(question *models.Question) err
 	}
 
 	query := `UPDATE questions 
-              SET title = $1, text = $2, options = $3, correct_option = $4, points = $5 
-              WHERE id = $6 AND version = $7`
+              SET title = $1, text = $2, options = $3, correct_option = $4, correct_options = $5, points = $6,
+                  accepted_answers = $7, case_sensitive = $8, normalize_spaces = $9, use_regex = $10,
+                  numeric_answer = $11, tolerance = $12, tolerance_type = $13, tags = $14,
+                  explanation = $15, option_explanations = $16 
+              WHERE id = $17 AND version = $18`
 
 	result, err := r.db.Exec(query,
 		question.Title,
 		question.Text,
 		pq.Array(question.Options),
 		question.CorrectOption,
+		pq.Array(question.CorrectOptions),
 		question.Points,
+		pq.Array(question.AcceptedAnswers),
+		question.CaseSensitive,
+		question.NormalizeSpaces,
+		question.UseRegex,
+		question.NumericAnswer,
+		question.Tolerance,
+		nullString(question.ToleranceType),
+		pq.Array(question.Tags),
+		nullString(question.Explanation),
+		pq.Array(question.OptionExplanations),
 		question.ID,
 		currentVersion)
 
@@ -255,8 +368,7 @@ func (r *QuestionRepository) Restore(id int) error {
 }
 
 func (r *QuestionRepository) GetVersions(id int) ([]models.Question, error) {
-	query := `SELECT id, title, text, options, correct_option, points, author_id, 
-                     version, is_deleted, created_at 
+	query := `SELECT ` + questionColumns + ` 
               FROM questions 
               WHERE id = $1 
               ORDER BY version DESC`
@@ -269,33 +381,17 @@ func (r *QuestionRepository) GetVersions(id int) ([]models.Question, error) {
 	var versions []models.Question
 	for rows.Next() {
 		var question models.Question
-		var options pq.StringArray // ИСПРАВЛЕНИЕ
-
-		err := rows.Scan(
-			&question.ID,
-			&question.Title,
-			&question.Text,
-			&options,
-			&question.CorrectOption,
-			&question.Points,
-			&question.AuthorID,
-			&question.Version,
-			&question.IsDeleted,
-			&question.CreatedAt,
-		)
-		if err != nil {
+		if err := scanQuestion(rows, &question); err != nil {
 			return nil, err
 		}
 
-		question.Options = []string(options)
 		versions = append(versions, question)
 	}
 	return versions, nil
 }
 
 func (r *QuestionRepository) GetDeleted() ([]models.Question, error) {
-	query := `SELECT DISTINCT ON (id) id, title, text, options, correct_option, points, 
-                     author_id, version, is_deleted, created_at 
+	query := `SELECT DISTINCT ON (id) ` + questionColumns + ` 
               FROM questions 
               WHERE is_deleted = true 
               ORDER BY id, version DESC`
@@ -308,25 +404,10 @@ func (r *QuestionRepository) GetDeleted() ([]models.Question, error) {
 	var questions []models.Question
 	for rows.Next() {
 		var question models.Question
-		var options pq.StringArray
-
-		err := rows.Scan(
-			&question.ID,
-			&question.Title,
-			&question.Text,
-			&options,
-			&question.CorrectOption,
-			&question.Points,
-			&question.AuthorID,
-			&question.Version,
-			&question.IsDeleted,
-			&question.CreatedAt,
-		)
-		if err != nil {
+		if err := scanQuestion(rows, &question); err != nil {
 			return nil, err
 		}
 
-		question.Options = []string(options)
 		questions = append(questions, question)
 	}
 	return questions, nil
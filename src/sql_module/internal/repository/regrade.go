@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sql_module/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// latestVersionsQuery - последняя версия каждого вопроса
+const latestVersionsQuery = `SELECT id, MAX(version) AS version FROM questions GROUP BY id`
+
+// RegradeQuestion переводит попытки, в которых был вопрос questionID, на его последнюю
+// версию (с исправленным ключом) и пересчитывает их баллы и test_results.
+// version > 0 ограничивает пересчет попытками с этой версией вопроса, testID > 0 - одним тестом.
+func (r *AttemptRepository) RegradeQuestion(questionID, version, testID, regradedBy int, reason string) (*models.Regrade, error) {
+	regrade := &models.Regrade{QuestionID: &questionID, Reason: reason, RegradedBy: regradedBy}
+	if version > 0 {
+		regrade.QuestionVersion = &version
+	}
+	if testID > 0 {
+		regrade.TestID = &testID
+	}
+
+	attemptsQuery := `SELECT aq.attempt_id
+                      FROM attempt_questions aq
+                      JOIN attempts a ON a.id = aq.attempt_id
+                      WHERE aq.question_id = $1 AND ($2 = 0 OR aq.question_version = $2)
+                        AND ($3 = 0 OR a.test_id = $3) AND a.status <> 'cancelled'
+                      ORDER BY aq.attempt_id`
+
+	return r.regrade(regrade, questionID, attemptsQuery, questionID, version, testID)
+}
+
+// RegradeTest переводит все попытки теста на последние версии их вопросов и пересчитывает
+// баллы по текущим настройкам теста (веса, штрафы) и test_results
+func (r *AttemptRepository) RegradeTest(testID, regradedBy int, reason string) (*models.Regrade, error) {
+	regrade := &models.Regrade{TestID: &testID, Reason: reason, RegradedBy: regradedBy}
+
+	attemptsQuery := `SELECT id FROM attempts
+                      WHERE test_id = $1 AND status <> 'cancelled'
+                      ORDER BY id`
+
+	return r.regrade(regrade, 0, attemptsQuery, testID)
+}
+
+// regradeTarget - попытка, затронутая пересчетом, в состоянии до него
+type regradeTarget struct {
+	id       int
+	testID   int
+	userID   int
+	status   string
+	score    *float64
+	maxScore float64
+}
+
+// regrade выполняет пересчет попыток, выбранных attemptsQuery, в одной транзакции.
+// questionID > 0 - на последнюю версию переводится только этот вопрос, иначе все вопросы попытки.
+func (r *AttemptRepository) regrade(regrade *models.Regrade, questionID int, attemptsQuery string, args ...interface{}) (*models.Regrade, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var attemptIDs []int64
+	rows, err := tx.Query(attemptsQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attemptIDs = append(attemptIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	targets, err := lockRegradeTargets(tx, attemptIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateToLatestVersions(tx, attemptIDs, questionID); err != nil {
+		return nil, err
+	}
+
+	configs := make(map[int]*scoringConfig)
+	results := make(map[[2]int]bool) // (test_id, user_id) с завершенными попытками
+	regrade.Changes = []models.RegradeChange{}
+
+	for _, target := range targets {
+		if err := reevaluateAnswers(tx, target.id); err != nil {
+			return nil, err
+		}
+
+		// Незавершенная попытка будет оценена при завершении уже по новому ключу
+		if target.status == "in_progress" {
+			continue
+		}
+
+		config, ok := configs[target.testID]
+		if !ok {
+			config, err = loadScoringConfig(tx, target.testID)
+			if err != nil {
+				return nil, err
+			}
+			configs[target.testID] = config
+		}
+
+		if err := scoreAttemptAnswers(tx, target.id, config); err != nil {
+			return nil, err
+		}
+
+		maxScore, err := updateAttemptMaxScore(tx, target.id, target.testID)
+		if err != nil {
+			return nil, err
+		}
+
+		breakdown, err := buildScoreBreakdown(tx, target.id, config)
+		if err != nil {
+			return nil, err
+		}
+
+		breakdownJSON, err := json.Marshal(breakdown)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`UPDATE attempts SET score = $1, score_breakdown = $2 WHERE id = $3`,
+			breakdown.Score, string(breakdownJSON), target.id)
+		if err != nil {
+			return nil, err
+		}
+
+		newScore := breakdown.Score
+		regrade.Changes = append(regrade.Changes, models.RegradeChange{
+			AttemptID:   target.id,
+			TestID:      target.testID,
+			UserID:      target.userID,
+			OldScore:    target.score,
+			NewScore:    &newScore,
+			OldMaxScore: target.maxScore,
+			NewMaxScore: maxScore,
+		})
+
+		if target.status == "completed" {
+			results[[2]int{target.testID, target.userID}] = true
+		}
+	}
+
+	for key := range results {
+		if err := refreshTestResult(tx, key[0], key[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := saveRegradeLog(tx, regrade); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return regrade, nil
+}
+
+func lockRegradeTargets(tx *sql.Tx, attemptIDs []int64) ([]regradeTarget, error) {
+	query := `SELECT id, test_id, user_id, status, score, max_score
+              FROM attempts
+              WHERE id = ANY($1)
+              ORDER BY id
+              FOR UPDATE`
+
+	rows, err := tx.Query(query, pq.Array(attemptIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []regradeTarget
+	for rows.Next() {
+		var target regradeTarget
+		var score sql.NullFloat64
+		err := rows.Scan(&target.id, &target.testID, &target.userID, &target.status, &score, &target.maxScore)
+		if err != nil {
+			return nil, err
+		}
+		if score.Valid {
+			target.score = &score.Float64
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+// migrateToLatestVersions переводит наборы вопросов попыток, ответы и историю ответов на последние
+// версии вопросов. Варианты ответа хранятся по индексам, поэтому перевод возможен,
+// только если тип вопроса и число вариантов в версиях совпадают.
+func migrateToLatestVersions(tx *sql.Tx, attemptIDs []int64, questionID int) error {
+	pairsQuery := `SELECT DISTINCT aq.question_id, aq.question_version, lv.version
+                   FROM attempt_questions aq
+                   JOIN (` + latestVersionsQuery + `) lv ON lv.id = aq.question_id
+                   WHERE aq.attempt_id = ANY($1) AND aq.question_version <> lv.version
+                     AND ($2 = 0 OR aq.question_id = $2)`
+
+	rows, err := tx.Query(pairsQuery, pq.Array(attemptIDs), questionID)
+	if err != nil {
+		return err
+	}
+
+	type versionPair struct {
+		questionID, from, to int
+	}
+	var pairs []versionPair
+	for rows.Next() {
+		var pair versionPair
+		if err := rows.Scan(&pair.questionID, &pair.from, &pair.to); err != nil {
+			rows.Close()
+			return err
+		}
+		pairs = append(pairs, pair)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		var fromType, toType string
+		var fromOptions, toOptions int
+		compareQuery := `SELECT question_type, COALESCE(array_length(options, 1), 0)
+                         FROM questions WHERE id = $1 AND version = $2`
+		if err := tx.QueryRow(compareQuery, pair.questionID, pair.from).Scan(&fromType, &fromOptions); err != nil {
+			return err
+		}
+		if err := tx.QueryRow(compareQuery, pair.questionID, pair.to).Scan(&toType, &toOptions); err != nil {
+			return err
+		}
+		if fromType != toType || fromOptions != toOptions {
+			return &AttemptError{Message: fmt.Sprintf(
+				"Cannot regrade question %d: versions %d and %d have different answer options",
+				pair.questionID, pair.from, pair.to)}
+		}
+	}
+
+	migrateQuery := `UPDATE attempt_questions aq
+                     SET question_version = lv.version
+                     FROM (` + latestVersionsQuery + `) lv
+                     WHERE lv.id = aq.question_id AND aq.attempt_id = ANY($1)
+                       AND aq.question_version <> lv.version AND ($2 = 0 OR aq.question_id = $2)`
+	if _, err := tx.Exec(migrateQuery, pq.Array(attemptIDs), questionID); err != nil {
+		return err
+	}
+
+	// Ответы и их история переводятся вслед за набором вопросов попытки
+	for _, table := range []string{"attempt_answers", "attempt_answer_history"} {
+		answersQuery := `UPDATE ` + table + ` aa
+                         SET question_version = aq.question_version
+                         FROM attempt_questions aq
+                         WHERE aq.attempt_id = aa.attempt_id AND aq.question_id = aa.question_id
+                           AND aa.attempt_id = ANY($1) AND aa.question_version <> aq.question_version`
+		if _, err := tx.Exec(answersQuery, pq.Array(attemptIDs)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reevaluateAnswers заново проверяет автоматически проверяемые ответы попытки
+// по ключу их текущей версии вопроса
+func reevaluateAnswers(tx *sql.Tx, attemptID int) error {
+	answers, err := queryAnswers(tx, `WHERE attempt_id = $1`, attemptID)
+	if err != nil {
+		return err
+	}
+
+	questions, err := loadAnsweredQuestions(tx, attemptID)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `UPDATE attempt_answers SET correct_answer = $1, is_correct = $1 WHERE id = $2`
+	for i := range answers {
+		question, ok := questions[questionKey{answers[i].QuestionID, answers[i].QuestionVersion}]
+		if !ok || needsManualGrading(question) {
+			continue
+		}
+
+		correct := isAnswerCorrect(question, &answers[i])
+		if _, err := tx.Exec(updateQuery, correct, answers[i].ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refreshTestResult пересчитывает test_results студента по его завершенным попыткам
+func refreshTestResult(tx *sql.Tx, testID, userID int) error {
+	var lastAttemptID int
+	var completedAt time.Time
+	lastQuery := `SELECT id, completed_at FROM attempts
+                  WHERE test_id = $1 AND user_id = $2 AND status = 'completed'
+                  ORDER BY completed_at DESC, id DESC
+                  LIMIT 1`
+	err := tx.QueryRow(lastQuery, testID, userID).Scan(&lastAttemptID, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := saveTestResult(tx, testID, userID, completedAt); err != nil {
+		return err
+	}
+
+	// После пересчета итог мог опуститься ниже порога или впервые его достичь
+	if err := revokeFailedCertificate(tx, testID, userID); err != nil {
+		return err
+	}
+	return issueCertificate(tx, testID, userID, lastAttemptID)
+}
+
+func saveRegradeLog(tx *sql.Tx, regrade *models.Regrade) error {
+	insertQuery := `INSERT INTO regrades (test_id, question_id, question_version, reason, regraded_by)
+                    VALUES ($1, $2, $3, $4, $5)
+                    RETURNING id, created_at`
+	err := tx.QueryRow(insertQuery, regrade.TestID, regrade.QuestionID, regrade.QuestionVersion,
+		nullString(regrade.Reason), regrade.RegradedBy).Scan(&regrade.ID, &regrade.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changeQuery := `INSERT INTO regrade_changes
+                    (regrade_id, attempt_id, test_id, user_id, old_score, new_score, old_max_score, new_max_score)
+                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	for _, change := range regrade.Changes {
+		_, err := tx.Exec(changeQuery, regrade.ID, change.AttemptID, change.TestID, change.UserID,
+			change.OldScore, change.NewScore, change.OldMaxScore, change.NewMaxScore)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRegrades возвращает журнал пересчетов, затронувших тест, с изменениями по попыткам этого теста
+func (r *AttemptRepository) GetRegrades(testID int) ([]models.Regrade, error) {
+	query := `SELECT id, test_id, question_id, question_version, reason, regraded_by, created_at
+              FROM regrades
+              WHERE test_id = $1 OR id IN (SELECT regrade_id FROM regrade_changes WHERE test_id = $1)
+              ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var regrades []models.Regrade
+	index := make(map[int]int)
+	for rows.Next() {
+		var regrade models.Regrade
+		var regradeTestID, questionID, questionVersion sql.NullInt64
+		var reason sql.NullString
+		err := rows.Scan(&regrade.ID, &regradeTestID, &questionID, &questionVersion,
+			&reason, &regrade.RegradedBy, &regrade.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if regradeTestID.Valid {
+			id := int(regradeTestID.Int64)
+			regrade.TestID = &id
+		}
+		if questionID.Valid {
+			id := int(questionID.Int64)
+			regrade.QuestionID = &id
+		}
+		if questionVersion.Valid {
+			version := int(questionVersion.Int64)
+			regrade.QuestionVersion = &version
+		}
+		regrade.Reason = reason.String
+		regrade.Changes = []models.RegradeChange{}
+
+		index[regrade.ID] = len(regrades)
+		regrades = append(regrades, regrade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	changesQuery := `SELECT regrade_id, attempt_id, test_id, user_id, old_score, new_score,
+                            old_max_score, new_max_score
+                     FROM regrade_changes
+                     WHERE test_id = $1
+                     ORDER BY regrade_id, attempt_id`
+
+	changeRows, err := r.db.Query(changesQuery, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer changeRows.Close()
+
+	for changeRows.Next() {
+		var regradeID int
+		var change models.RegradeChange
+		var oldScore, newScore sql.NullFloat64
+		err := changeRows.Scan(&regradeID, &change.AttemptID, &change.TestID, &change.UserID,
+			&oldScore, &newScore, &change.OldMaxScore, &change.NewMaxScore)
+		if err != nil {
+			return nil, err
+		}
+
+		if oldScore.Valid {
+			change.OldScore = &oldScore.Float64
+		}
+		if newScore.Valid {
+			change.NewScore = &newScore.Float64
+		}
+
+		if i, ok := index[regradeID]; ok {
+			regrades[i].Changes = append(regrades[i].Changes, change)
+		}
+	}
+
+	return regrades, changeRows.Err()
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"math"
+	"sql_module/internal/models"
+)
+
+// Число интервалов гистограммы процентов
+const (
+	DefaultHistogramBins = 10
+	MaxHistogramBins     = 100
+)
+
+// GetResultsSummary считает сводную статистику по попыткам теста:
+// распределение итогов завершенных попыток, долю завершенных, среднюю длительность
+// и альфу Кронбаха. bins - число равных интервалов гистограммы на отрезке 0..100%.
+func (r *AttemptRepository) GetResultsSummary(testID, bins int) (*models.ResultsSummary, error) {
+	summary := &models.ResultsSummary{Histogram: []models.HistogramBin{}}
+
+	countsQuery := `SELECT status, COUNT(*) FROM attempts WHERE test_id = $1 GROUP BY status`
+	rows, err := r.db.Query(countsQuery, testID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		switch status {
+		case "in_progress":
+			summary.Attempts.InProgress = count
+		case "awaiting_review":
+			summary.Attempts.AwaitingReview = count
+		case "completed":
+			summary.Attempts.Completed = count
+		case "cancelled":
+			summary.Attempts.Cancelled = count
+		}
+		summary.Attempts.Total += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if summary.Attempts.Total > 0 {
+		rate := round3(float64(summary.Attempts.Completed) / float64(summary.Attempts.Total))
+		summary.CompletionRate = &rate
+	}
+
+	completedQuery := `SELECT id, COALESCE(score, 0), max_score,
+                              EXTRACT(EPOCH FROM completed_at - started_at)
+                       FROM attempts
+                       WHERE test_id = $1 AND status = 'completed'
+                       ORDER BY id`
+	rows, err = r.db.Query(completedQuery, testID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attemptIDs []int
+	var scores, percentages, durations []float64
+	for rows.Next() {
+		var attemptID int
+		var score, maxScore float64
+		var duration *float64
+		if err := rows.Scan(&attemptID, &score, &maxScore, &duration); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		attemptIDs = append(attemptIDs, attemptID)
+		scores = append(scores, score)
+		if maxScore > 0 {
+			percentages = append(percentages, score/maxScore*100)
+		}
+		if duration != nil {
+			durations = append(durations, *duration)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summary.Score = scoreStats(scores)
+	summary.Percentage = scoreStats(percentages)
+	summary.Histogram = buildHistogram(percentages, bins)
+
+	if len(durations) > 0 {
+		duration := math.Round(mean(durations))
+		summary.AverageDurationSeconds = &duration
+	}
+
+	items, err := r.commonItemScores(testID, attemptIDs)
+	if err != nil {
+		return nil, err
+	}
+	summary.AlphaItems = len(items)
+	if alpha, ok := cronbachAlpha(items); ok {
+		alpha = round3(alpha)
+		summary.CronbachAlpha = &alpha
+	}
+
+	return summary, nil
+}
+
+// buildHistogram раскладывает проценты по bins равным интервалам 0..100.
+// Значения вне отрезка (штрафы, бонусы) попадают в крайние интервалы.
+func buildHistogram(percentages []float64, bins int) []models.HistogramBin {
+	if bins <= 0 {
+		bins = DefaultHistogramBins
+	}
+
+	width := 100 / float64(bins)
+	histogram := make([]models.HistogramBin, bins)
+	for i := range histogram {
+		histogram[i].From = round2(float64(i) * width)
+		histogram[i].To = round2(float64(i+1) * width)
+	}
+
+	for _, p := range percentages {
+		index := int(p / width)
+		if index < 0 {
+			index = 0
+		}
+		if index >= bins {
+			index = bins - 1
+		}
+		histogram[index].Count++
+	}
+
+	return histogram
+}
+
+// commonItemScores возвращает баллы за вопросы, которые были во всех завершенных попытках
+// (при пулах вопросов у попыток разные наборы). Неотвеченный вопрос - 0 баллов.
+// result[i][j] - балл attemptIDs[j] за i-й общий вопрос.
+func (r *AttemptRepository) commonItemScores(testID int, attemptIDs []int) ([][]float64, error) {
+	if len(attemptIDs) < 2 {
+		return nil, nil
+	}
+
+	column := make(map[int]int, len(attemptIDs))
+	for j, attemptID := range attemptIDs {
+		column[attemptID] = j
+	}
+
+	query := `SELECT aq.question_id, aq.attempt_id, COALESCE(aa.points_awarded, 0)
+              FROM attempt_questions aq
+              JOIN attempts a ON a.id = aq.attempt_id
+              LEFT JOIN attempt_answers aa ON aa.attempt_id = aq.attempt_id AND aa.question_id = aq.question_id
+              WHERE a.test_id = $1 AND a.status = 'completed'
+                AND aq.question_id IN (
+                    SELECT aq2.question_id
+                    FROM attempt_questions aq2
+                    JOIN attempts a2 ON a2.id = aq2.attempt_id
+                    WHERE a2.test_id = $1 AND a2.status = 'completed'
+                    GROUP BY aq2.question_id
+                    HAVING COUNT(*) = $2
+                )
+              ORDER BY aq.question_id`
+	rows, err := r.db.Query(query, testID, len(attemptIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items [][]float64
+	lastQuestionID := 0
+	for rows.Next() {
+		var questionID, attemptID int
+		var points float64
+		if err := rows.Scan(&questionID, &attemptID, &points); err != nil {
+			return nil, err
+		}
+
+		j, ok := column[attemptID]
+		if !ok {
+			continue
+		}
+		if len(items) == 0 || questionID != lastQuestionID {
+			items = append(items, make([]float64, len(attemptIDs)))
+			lastQuestionID = questionID
+		}
+		items[len(items)-1][j] = points
+	}
+
+	return items, rows.Err()
+}
@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"sql_module/internal/models"
+	"strings"
+)
+
+// Режимы начисления баллов за вопросы с несколькими правильными вариантами
+const (
+	// ScoringAllOrNothing - полный балл только при точном совпадении набора вариантов
+	ScoringAllOrNothing = "all_or_nothing"
+	// ScoringProportional - доля отмеченных правильных минус доля отмеченных неправильных
+	// (от числа неправильных вариантов), не меньше нуля; отметка всех вариантов дает 0
+	ScoringProportional = "proportional"
+	// ScoringProportionalPenalty - (верно отмеченные - ошибочно отмеченные) / число правильных, не меньше нуля
+	ScoringProportionalPenalty = "proportional_penalty"
+)
+
+func IsValidScoringMode(mode string) bool {
+	switch mode {
+	case ScoringAllOrNothing, ScoringProportional, ScoringProportionalPenalty:
+		return true
+	}
+	return false
+}
+
+// Политики учета повторных попыток: какая попытка идет в test_results
+const (
+	ScorePolicyBest    = "best"
+	ScorePolicyLast    = "last"
+	ScorePolicyFirst   = "first"
+	ScorePolicyAverage = "average"
+)
+
+func IsValidScorePolicy(policy string) bool {
+	switch policy {
+	case ScorePolicyBest, ScorePolicyLast, ScorePolicyFirst, ScorePolicyAverage:
+		return true
+	}
+	return false
+}
+
+// attemptScore - балл завершенной попытки и максимум ее набора вопросов.
+// Максимумы попыток могут различаться (пулы, веса, перепроверка)
+type attemptScore struct {
+	Score    float64
+	MaxScore float64
+}
+
+func (a attemptScore) percentage() float64 {
+	if a.MaxScore <= 0 {
+		return 0
+	}
+	return a.Score / a.MaxScore
+}
+
+// applyScorePolicy выбирает итоговый балл и максимум из попыток,
+// отсортированных по времени завершения. Лучшая попытка определяется
+// по проценту, при среднем усредняются и баллы, и максимумы
+func applyScorePolicy(policy string, attempts []attemptScore) attemptScore {
+	if len(attempts) == 0 {
+		return attemptScore{}
+	}
+
+	switch policy {
+	case ScorePolicyLast:
+		return attempts[len(attempts)-1]
+	case ScorePolicyFirst:
+		return attempts[0]
+	case ScorePolicyAverage:
+		var sum attemptScore
+		for _, attempt := range attempts {
+			sum.Score += attempt.Score
+			sum.MaxScore += attempt.MaxScore
+		}
+		n := float64(len(attempts))
+		return attemptScore{Score: sum.Score / n, MaxScore: sum.MaxScore / n}
+	default:
+		best := attempts[0]
+		for _, attempt := range attempts[1:] {
+			if attempt.percentage() > best.percentage() {
+				best = attempt
+			}
+		}
+		return best
+	}
+}
+
+// normalizeOptions сортирует варианты и убирает повторы
+func normalizeOptions(options []int) []int {
+	seen := make(map[int]bool, len(options))
+	result := make([]int, 0, len(options))
+	for _, option := range options {
+		if !seen[option] {
+			seen[option] = true
+			result = append(result, option)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+func sameOptionSet(a, b []int) bool {
+	a = normalizeOptions(a)
+	b = normalizeOptions(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// multipleChoiceCredit возвращает долю балла (от 0 до 1) за ответ
+// на вопрос с несколькими правильными вариантами
+func multipleChoiceCredit(correct, selected []int, optionsCount int, mode string) float64 {
+	correct = normalizeOptions(correct)
+	selected = normalizeOptions(selected)
+
+	// Пустой выбор - пропуск, а не частично верный ответ
+	if len(correct) == 0 || len(selected) == 0 {
+		return 0
+	}
+
+	isCorrect := make(map[int]bool, len(correct))
+	for _, option := range correct {
+		isCorrect[option] = true
+	}
+
+	hits, misses := 0, 0
+	for _, option := range selected {
+		if isCorrect[option] {
+			hits++
+		} else {
+			misses++
+		}
+	}
+
+	switch mode {
+	case ScoringProportional:
+		// Баллы дают только отмеченные правильные варианты, отмеченные неправильные
+		// их снимают; неотмеченные неправильные ничего не приносят
+		credit := float64(hits) / float64(len(correct))
+		if distractors := optionsCount - len(correct); distractors > 0 {
+			credit -= float64(misses) / float64(distractors)
+		}
+		if credit < 0 {
+			return 0
+		}
+		return credit
+	case ScoringProportionalPenalty:
+		credit := float64(hits-misses) / float64(len(correct))
+		if credit < 0 {
+			return 0
+		}
+		return credit
+	default:
+		if hits == len(correct) && misses == 0 {
+			return 1
+		}
+		return 0
+	}
+}
+
+// needsManualGrading - ответ на вопрос проверяет преподаватель, а не сервер
+func needsManualGrading(question *models.Question) bool {
+	return question.QuestionType == models.QuestionTypeEssay
+}
+
+// isAnswerOmitted - студент сохранил ответ, но ничего не выбрал и не ввел
+func isAnswerOmitted(question *models.Question, answer *models.Answer) bool {
+	switch question.QuestionType {
+	case models.QuestionTypeMultiple:
+		return len(answer.SelectedOptions) == 0
+	case models.QuestionTypeText, models.QuestionTypeEssay:
+		return answer.TextAnswer == nil || strings.TrimSpace(*answer.TextAnswer) == ""
+	case models.QuestionTypeNumeric:
+		return answer.NumericAnswer == nil
+	default:
+		return answer.SelectedOption < 0
+	}
+}
+
+// isAnswerCorrect проверяет ответ студента по ключу вопроса
+func isAnswerCorrect(question *models.Question, answer *models.Answer) bool {
+	switch question.QuestionType {
+	case models.QuestionTypeMultiple:
+		return len(answer.SelectedOptions) > 0 && sameOptionSet(answer.SelectedOptions, question.CorrectOptions)
+	case models.QuestionTypeText:
+		return answer.TextAnswer != nil && matchTextAnswer(question, *answer.TextAnswer)
+	case models.QuestionTypeNumeric:
+		return answer.NumericAnswer != nil && question.NumericAnswer != nil &&
+			withinTolerance(*question.NumericAnswer, *answer.NumericAnswer, question.Tolerance, question.ToleranceType)
+	default:
+		return answer.SelectedOption == question.CorrectOption
+	}
+}
+
+// answerCredit возвращает долю балла за ответ (от 0 до 1) с учетом режима оценивания теста
+func answerCredit(question *models.Question, answer *models.Answer, mode string) float64 {
+	if question.QuestionType == models.QuestionTypeMultiple {
+		return multipleChoiceCredit(question.CorrectOptions, answer.SelectedOptions, len(question.Options), mode)
+	}
+
+	if isAnswerCorrect(question, answer) {
+		return 1
+	}
+	return 0
+}
+
+// normalizeTextAnswer приводит ответ к виду, в котором его сравниваем с эталоном
+func normalizeTextAnswer(question *models.Question, text string) string {
+	if question.NormalizeSpaces {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	if !question.CaseSensitive {
+		text = strings.ToLower(text)
+	}
+	return text
+}
+
+// textAnswerPattern собирает регулярку, которая должна совпасть с ответом целиком
+func textAnswerPattern(question *models.Question, accepted string) (*regexp.Regexp, error) {
+	pattern := "^(?:" + accepted + ")$"
+	if !question.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+func matchTextAnswer(question *models.Question, text string) bool {
+	given := normalizeTextAnswer(question, text)
+
+	for _, accepted := range question.AcceptedAnswers {
+		if question.UseRegex {
+			re, err := textAnswerPattern(question, accepted)
+			if err != nil {
+				continue
+			}
+			if re.MatchString(given) {
+				return true
+			}
+		} else if normalizeTextAnswer(question, accepted) == given {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateTextPatterns проверяет, что все допустимые ответы компилируются как регулярки
+func ValidateTextPatterns(question *models.Question) error {
+	for _, accepted := range question.AcceptedAnswers {
+		if _, err := textAnswerPattern(question, accepted); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", accepted, err)
+		}
+	}
+	return nil
+}
+
+// numericEpsilon гасит ошибки округления при сравнении чисел с плавающей точкой
+const numericEpsilon = 1e-9
+
+func withinTolerance(expected, given, tolerance float64, toleranceType string) bool {
+	diff := math.Abs(given - expected)
+	if toleranceType == models.ToleranceRelative {
+		return diff <= math.Abs(expected)*tolerance+numericEpsilon
+	}
+	return diff <= tolerance+numericEpsilon
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"sql_module/internal/models"
+)
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// variance - дисперсия выборки (с поправкой n-1)
+func variance(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return sum / float64(len(values)-1)
+}
+
+// pearson - коэффициент корреляции; для дихотомического x это точечно-бисериальная корреляция.
+// ok = false, если у одной из величин нет разброса.
+func pearson(x, y []float64) (float64, bool) {
+	if len(x) != len(y) || len(x) < 2 {
+		return 0, false
+	}
+
+	mx, my := mean(x), mean(y)
+	var cov, vx, vy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(vx*vy), true
+}
+
+// round3 округляет показатель до тысячных
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+	return (sorted[middle-1] + sorted[middle]) / 2
+}
+
+// scoreStats - описательная статистика, значения округлены до сотых
+func scoreStats(values []float64) *models.ScoreStats {
+	if len(values) == 0 {
+		return nil
+	}
+
+	stats := &models.ScoreStats{Min: values[0], Max: values[0]}
+	for _, v := range values {
+		stats.Min = math.Min(stats.Min, v)
+		stats.Max = math.Max(stats.Max, v)
+	}
+	stats.Mean = round2(mean(values))
+	stats.Median = round2(median(values))
+	stats.StdDev = round2(math.Sqrt(variance(values)))
+	stats.Min = round2(stats.Min)
+	stats.Max = round2(stats.Max)
+	return stats
+}
+
+// cronbachAlpha считает альфу Кронбаха по матрице баллов: items[i][j] - балл j-й попытки за i-й вопрос.
+// ok = false, если вопросов или попыток меньше двух или у суммы нет разброса.
+func cronbachAlpha(items [][]float64) (float64, bool) {
+	k := len(items)
+	if k < 2 || len(items[0]) < 2 {
+		return 0, false
+	}
+
+	totals := make([]float64, len(items[0]))
+	var itemVariances float64
+	for _, scores := range items {
+		itemVariances += variance(scores)
+		for j, score := range scores {
+			totals[j] += score
+		}
+	}
+
+	totalVariance := variance(totals)
+	if totalVariance == 0 {
+		return 0, false
+	}
+
+	return float64(k) / float64(k-1) * (1 - itemVariances/totalVariance), true
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"sql_module/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Код доступа: 6 символов без похожих (0/O, 1/I), чтобы его было легко продиктовать
+const (
+	accessCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	accessCodeLength   = 6
+)
+
+// Подбор кода: после стольких неверных кодов за окно студенту отказывают без проверки
+const (
+	MaxAccessCodeFailures    = 5
+	AccessCodeLockoutMinutes = 10
+)
+
+func generateAccessCode() (string, error) {
+	buf := make([]byte, accessCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, v := range buf {
+		buf[i] = accessCodeAlphabet[int(v)%len(accessCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// GetAccess возвращает ограничения на старт попыток теста.
+// Если они не заданы, возвращаются пустые ограничения.
+func (r *TestRepository) GetAccess(testID int) (*models.TestAccess, error) {
+	access := &models.TestAccess{TestID: testID, AllowedNetworks: []string{}}
+
+	var code sql.NullString
+	var rotatedAt sql.NullTime
+	var networks []string
+	query := `SELECT access_code, code_rotated_at, allowed_networks FROM test_access WHERE test_id = $1`
+	err := r.db.QueryRow(query, testID).Scan(&code, &rotatedAt, pq.Array(&networks))
+	if err == sql.ErrNoRows {
+		return access, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if code.Valid {
+		access.AccessCode = &code.String
+	}
+	if rotatedAt.Valid {
+		access.CodeRotatedAt = &rotatedAt.Time
+	}
+	if networks != nil {
+		access.AllowedNetworks = networks
+	}
+
+	return access, nil
+}
+
+// SetAccess задает ограничения на старт. requireCode включает код доступа:
+// уже выданный код сохраняется, иначе генерируется новый.
+func (r *TestRepository) SetAccess(testID int, requireCode bool, networks []string) (*models.TestAccess, error) {
+	var newCode *string
+	if requireCode {
+		code, err := generateAccessCode()
+		if err != nil {
+			return nil, err
+		}
+		newCode = &code
+	}
+
+	if networks == nil {
+		networks = []string{}
+	}
+
+	query := `INSERT INTO test_access (test_id, access_code, code_rotated_at, allowed_networks)
+              VALUES ($1, $2::varchar, CASE WHEN $2::varchar IS NULL THEN NULL ELSE CURRENT_TIMESTAMP END, $3)
+              ON CONFLICT (test_id) DO UPDATE
+              SET access_code = CASE WHEN $2::varchar IS NULL THEN NULL
+                                     ELSE COALESCE(test_access.access_code, $2::varchar) END,
+                  code_rotated_at = CASE WHEN $2::varchar IS NULL THEN NULL
+                                         WHEN test_access.access_code IS NULL THEN CURRENT_TIMESTAMP
+                                         ELSE test_access.code_rotated_at END,
+                  allowed_networks = EXCLUDED.allowed_networks`
+	if _, err := r.db.Exec(query, testID, newCode, pq.Array(networks)); err != nil {
+		return nil, err
+	}
+
+	return r.GetAccess(testID)
+}
+
+// RotateAccessCode выдает тесту новый код доступа. Старый код сразу перестает действовать,
+// уже начатые попытки продолжаются.
+func (r *TestRepository) RotateAccessCode(testID int) (*models.TestAccess, error) {
+	code, err := generateAccessCode()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO test_access (test_id, access_code, code_rotated_at)
+              VALUES ($1, $2, CURRENT_TIMESTAMP)
+              ON CONFLICT (test_id) DO UPDATE
+              SET access_code = EXCLUDED.access_code, code_rotated_at = EXCLUDED.code_rotated_at`
+	if _, err := r.db.Exec(query, testID, code); err != nil {
+		return nil, err
+	}
+
+	return r.GetAccess(testID)
+}
+
+// LogStartDenial записывает отказ в старте попытки
+func (r *TestRepository) LogStartDenial(denial *models.StartDenial) error {
+	query := `INSERT INTO attempt_start_denials (test_id, user_id, client_ip, reason)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id, created_at`
+	return r.db.QueryRow(query, denial.TestID, denial.UserID, denial.ClientIP, denial.Reason).
+		Scan(&denial.ID, &denial.CreatedAt)
+}
+
+// CountRecentCodeFailures - число неверных кодов студента за окно блокировки
+func (r *TestRepository) CountRecentCodeFailures(testID, userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM attempt_start_denials
+              WHERE test_id = $1 AND user_id = $2 AND reason = $3
+                AND created_at > CURRENT_TIMESTAMP - $4::int * INTERVAL '1 minute'`
+	err := r.db.QueryRow(query, testID, userID, models.StartDenialInvalidCode,
+		AccessCodeLockoutMinutes).Scan(&count)
+	return count, err
+}
+
+// GetStartDenials возвращает журнал отказов в старте попыток теста, новые первыми
+func (r *TestRepository) GetStartDenials(testID int) ([]models.StartDenial, error) {
+	query := `SELECT id, test_id, user_id, client_ip, reason, created_at
+              FROM attempt_start_denials
+              WHERE test_id = $1
+              ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var denials []models.StartDenial
+	for rows.Next() {
+		var denial models.StartDenial
+		err := rows.Scan(&denial.ID, &denial.TestID, &denial.UserID, &denial.ClientIP,
+			&denial.Reason, &denial.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		denials = append(denials, denial)
+	}
+
+	return denials, rows.Err()
+}
@@ -22,22 +22,31 @@ func NewTestRepository(db *sql.DB) *TestRepository {
 	return &TestRepository{db: db}
 }
 
-func (r *TestRepository) Create(test *models.Test) error {
-	query := `INSERT INTO tests (title, description, course_id, teacher_id, is_active) 
-              VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
-	err := r.db.QueryRow(query, test.Title, test.Description, test.CourseID,
-		test.TeacherID, test.IsActive).
-		Scan(&test.ID, &test.CreatedAt)
-	return err
+// rowScanner - общий интерфейс для *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (r *TestRepository) GetByID(id int) (*models.Test, error) {
-	query := `SELECT id, title, description, course_id, teacher_id, is_active, 
-                     is_deleted, created_at 
-              FROM tests WHERE id = $1 AND is_deleted = false`
-	row := r.db.QueryRow(query, id)
+const testColumns = `id, title, description, course_id, teacher_id, is_active,
+                     is_deleted, created_at, duration_minutes, scoring_mode,
+                     max_attempts, cooldown_minutes, score_policy,
+                     shuffle_questions, shuffle_options, opens_at, closes_at,
+                     wrong_answer_penalty, clamp_at_zero, review_content, review_availability,
+                     passing_percent`
+
+// questionsCountQuery - число вопросов в попытке: по правилам пула, если они заданы,
+// иначе по фиксированному списку test_questions
+const questionsCountQuery = `SELECT CASE
+                                 WHEN EXISTS(SELECT 1 FROM test_pool_rules WHERE test_id = $1)
+                                 THEN (SELECT SUM(question_count) FROM test_pool_rules WHERE test_id = $1)
+                                 ELSE (SELECT COUNT(*) FROM test_questions WHERE test_id = $1)
+                             END`
+
+func scanTest(row rowScanner, test *models.Test) error {
+	var duration, maxAttempts, cooldown sql.NullInt64
+	var opensAt, closesAt sql.NullTime
+	var passingPercent sql.NullFloat64
 
-	var test models.Test
 	err := row.Scan(
 		&test.ID,
 		&test.Title,
@@ -47,7 +56,93 @@ func (r *TestRepository) GetByID(id int) (*models.Test, error) {
 		&test.IsActive,
 		&test.IsDeleted,
 		&test.CreatedAt,
+		&duration,
+		&test.ScoringMode,
+		&maxAttempts,
+		&cooldown,
+		&test.ScorePolicy,
+		&test.ShuffleQuestions,
+		&test.ShuffleOptions,
+		&opensAt,
+		&closesAt,
+		&test.WrongAnswerPenalty,
+		&test.ClampAtZero,
+		&test.ReviewContent,
+		&test.ReviewAvailability,
+		&passingPercent,
 	)
+	if err != nil {
+		return err
+	}
+
+	if duration.Valid {
+		minutes := int(duration.Int64)
+		test.DurationMinutes = &minutes
+	}
+
+	if maxAttempts.Valid {
+		limit := int(maxAttempts.Int64)
+		test.MaxAttempts = &limit
+	}
+
+	if cooldown.Valid {
+		minutes := int(cooldown.Int64)
+		test.CooldownMinutes = &minutes
+	}
+
+	if opensAt.Valid {
+		test.OpensAt = &opensAt.Time
+	}
+
+	if closesAt.Valid {
+		test.ClosesAt = &closesAt.Time
+	}
+
+	if passingPercent.Valid {
+		test.PassingPercent = &passingPercent.Float64
+	}
+
+	return nil
+}
+
+func (r *TestRepository) Create(test *models.Test) error {
+	if test.ScoringMode == "" {
+		test.ScoringMode = ScoringAllOrNothing
+	}
+	if test.ScorePolicy == "" {
+		test.ScorePolicy = ScorePolicyBest
+	}
+	if test.ReviewContent == "" {
+		test.ReviewContent = ReviewCorrectAnswers
+	}
+	if test.ReviewAvailability == "" {
+		test.ReviewAvailability = ReviewImmediate
+	}
+
+	query := `INSERT INTO tests (title, description, course_id, teacher_id, is_active, duration_minutes,
+                                 scoring_mode, max_attempts, cooldown_minutes, score_policy,
+                                 shuffle_questions, shuffle_options, opens_at, closes_at,
+                                 wrong_answer_penalty, clamp_at_zero, review_content, review_availability,
+                                 passing_percent) 
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+              RETURNING id, created_at`
+	err := r.db.QueryRow(query, test.Title, test.Description, test.CourseID,
+		test.TeacherID, test.IsActive, test.DurationMinutes, test.ScoringMode,
+		test.MaxAttempts, test.CooldownMinutes, test.ScorePolicy,
+		test.ShuffleQuestions, test.ShuffleOptions, test.OpensAt, test.ClosesAt,
+		test.WrongAnswerPenalty, test.ClampAtZero, test.ReviewContent, test.ReviewAvailability,
+		test.PassingPercent).
+		Scan(&test.ID, &test.CreatedAt)
+	return err
+}
+
+func (r *TestRepository) GetByID(id int) (*models.Test, error) {
+	query := `SELECT ` + testColumns + `
+              FROM tests WHERE id = $1 AND is_deleted = false`
+	row := r.db.QueryRow(query, id)
+
+	var test models.Test
+	err := scanTest(row, &test)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -55,7 +150,7 @@ func (r *TestRepository) GetByID(id int) (*models.Test, error) {
 		return nil, err
 	}
 
-	countQuery := `SELECT COUNT(*) FROM test_questions WHERE test_id = $1`
+	countQuery := questionsCountQuery
 	err = r.db.QueryRow(countQuery, id).Scan(&test.QuestionsCount)
 	if err != nil {
 		return &test, nil
@@ -65,8 +160,7 @@ func (r *TestRepository) GetByID(id int) (*models.Test, error) {
 }
 
 func (r *TestRepository) GetByTeacherID(teacherID int) ([]models.Test, error) {
-	query := `SELECT id, title, description, course_id, teacher_id, is_active, 
-                     is_deleted, created_at 
+	query := `SELECT ` + testColumns + `
               FROM tests 
               WHERE teacher_id = $1 AND is_deleted = false 
               ORDER BY created_at DESC`
@@ -79,21 +173,12 @@ func (r *TestRepository) GetByTeacherID(teacherID int) ([]models.Test, error) {
 	var tests []models.Test
 	for rows.Next() {
 		var test models.Test
-		err := rows.Scan(
-			&test.ID,
-			&test.Title,
-			&test.Description,
-			&test.CourseID,
-			&test.TeacherID,
-			&test.IsActive,
-			&test.IsDeleted,
-			&test.CreatedAt,
-		)
+		err := scanTest(rows, &test)
 		if err != nil {
 			return nil, err
 		}
 
-		countQuery := `SELECT COUNT(*) FROM test_questions WHERE test_id = $1`
+		countQuery := questionsCountQuery
 		r.db.QueryRow(countQuery, test.ID).Scan(&test.QuestionsCount)
 
 		tests = append(tests, test)
@@ -102,8 +187,7 @@ func (r *TestRepository) GetByTeacherID(teacherID int) ([]models.Test, error) {
 }
 
 func (r *TestRepository) GetByCourseID(courseID int) ([]models.Test, error) {
-	query := `SELECT id, title, description, course_id, teacher_id, is_active, 
-                     is_deleted, created_at 
+	query := `SELECT ` + testColumns + `
               FROM tests 
               WHERE course_id = $1 AND is_deleted = false 
               ORDER BY created_at DESC`
@@ -116,21 +200,12 @@ func (r *TestRepository) GetByCourseID(courseID int) ([]models.Test, error) {
 	var tests []models.Test
 	for rows.Next() {
 		var test models.Test
-		err := rows.Scan(
-			&test.ID,
-			&test.Title,
-			&test.Description,
-			&test.CourseID,
-			&test.TeacherID,
-			&test.IsActive,
-			&test.IsDeleted,
-			&test.CreatedAt,
-		)
+		err := scanTest(rows, &test)
 		if err != nil {
 			return nil, err
 		}
 
-		countQuery := `SELECT COUNT(*) FROM test_questions WHERE test_id = $1`
+		countQuery := questionsCountQuery
 		r.db.QueryRow(countQuery, test.ID).Scan(&test.QuestionsCount)
 
 		tests = append(tests, test)
@@ -241,9 +316,21 @@ func (r *TestRepository) GetQuestions(testID int) ([]models.TestQuestion, error)
 }
 
 func (r *TestRepository) Update(test *models.Test) error {
-	query := `UPDATE tests SET title = $1, description = $2, is_active = $3 
-              WHERE id = $4 AND is_deleted = false`
-	result, err := r.db.Exec(query, test.Title, test.Description, test.IsActive, test.ID)
+	query := `UPDATE tests SET title = $1, description = $2, is_active = $3, duration_minutes = $4,
+                              scoring_mode = $5, max_attempts = $6, cooldown_minutes = $7,
+                              score_policy = $8, shuffle_questions = $9, shuffle_options = $10,
+                              opens_at = $11, closes_at = $12,
+                              auto_opened_at = CASE WHEN opens_at IS DISTINCT FROM $11 THEN NULL ELSE auto_opened_at END,
+                              auto_closed_at = CASE WHEN closes_at IS DISTINCT FROM $12 THEN NULL ELSE auto_closed_at END,
+                              wrong_answer_penalty = $13, clamp_at_zero = $14,
+                              review_content = $15, review_availability = $16,
+                              passing_percent = $17
+              WHERE id = $18 AND is_deleted = false`
+	result, err := r.db.Exec(query, test.Title, test.Description, test.IsActive,
+		test.DurationMinutes, test.ScoringMode, test.MaxAttempts, test.CooldownMinutes,
+		test.ScorePolicy, test.ShuffleQuestions, test.ShuffleOptions, test.OpensAt, test.ClosesAt,
+		test.WrongAnswerPenalty, test.ClampAtZero, test.ReviewContent, test.ReviewAvailability,
+		test.PassingPercent, test.ID)
 	if err != nil {
 		return err
 	}
@@ -314,6 +401,64 @@ func (r *TestRepository) SetActive(id int, active bool) error {
 	return nil
 }
 
+// GetTestsDueToOpen возвращает тесты, которые пора открыть по расписанию.
+// Каждый тест открывается автоматически один раз (пока не изменится opens_at),
+// поэтому ручная деактивация после открытия не отменяется планировщиком.
+func (r *TestRepository) GetTestsDueToOpen() ([]models.Test, error) {
+	return r.queryScheduledTests(`SELECT ` + testColumns + `
+                                  FROM tests
+                                  WHERE is_deleted = false AND auto_opened_at IS NULL
+                                    AND opens_at <= CURRENT_TIMESTAMP
+                                    AND (closes_at IS NULL OR closes_at > CURRENT_TIMESTAMP)`)
+}
+
+// GetTestsDueToClose возвращает тесты, которые пора закрыть по расписанию
+func (r *TestRepository) GetTestsDueToClose() ([]models.Test, error) {
+	return r.queryScheduledTests(`SELECT ` + testColumns + `
+                                  FROM tests
+                                  WHERE is_deleted = false AND auto_closed_at IS NULL
+                                    AND closes_at <= CURRENT_TIMESTAMP`)
+}
+
+func (r *TestRepository) queryScheduledTests(query string) ([]models.Test, error) {
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tests []models.Test
+	for rows.Next() {
+		var test models.Test
+		if err := scanTest(rows, &test); err != nil {
+			return nil, err
+		}
+		tests = append(tests, test)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range tests {
+		if err := r.db.QueryRow(questionsCountQuery, tests[i].ID).Scan(&tests[i].QuestionsCount); err != nil {
+			return nil, err
+		}
+	}
+	return tests, nil
+}
+
+// MarkScheduleOpened отмечает, что тест открыт планировщиком
+func (r *TestRepository) MarkScheduleOpened(id int) error {
+	_, err := r.db.Exec(`UPDATE tests SET auto_opened_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	return err
+}
+
+// MarkScheduleClosed отмечает, что тест закрыт планировщиком
+func (r *TestRepository) MarkScheduleClosed(id int) error {
+	_, err := r.db.Exec(`UPDATE tests SET auto_closed_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	return err
+}
+
 func (r *TestRepository) GetQuestionOrder(testID int) ([]int, error) {
 	query := `SELECT question_id FROM test_questions 
               WHERE test_id = $1 
@@ -336,21 +481,44 @@ func (r *TestRepository) GetQuestionOrder(testID int) ([]int, error) {
 	return questionIDs, nil
 }
 
-func (r *TestRepository) GetTestWithQuestions(testID int) (*models.Test, []models.Question, error) {
+// GetTestWithQuestions возвращает тест и его вопросы. Если указана попытка (attemptID > 0),
+// возвращается набор вопросов этой попытки в ее порядке и с ее перестановкой вариантов -
+// при пулах он у каждой попытки свой. Попытка остается доступной и после удаления
+// теста, тогда тест - nil.
+func (r *TestRepository) GetTestWithQuestions(testID, attemptID int) (*models.Test, []models.Question, error) {
 	test, err := r.GetByID(testID)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	if attemptID > 0 {
+		var attemptTestID int
+		err := r.db.QueryRow(`SELECT test_id FROM attempts WHERE id = $1`, attemptID).Scan(&attemptTestID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if attemptTestID != testID {
+			return nil, nil, fmt.Errorf("attempt does not belong to test")
+		}
+
+		questions, err := loadAttemptQuestions(r.db, attemptID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return test, questions, nil
+	}
+
 	if test == nil {
 		return nil, nil, fmt.Errorf("test not found")
 	}
 
 	query := `
-		SELECT q.id, q.title, q.text, q.options, q.correct_option, q.points, 
-               q.author_id, q.version, q.is_deleted, q.created_at
-		FROM questions q
-		INNER JOIN test_questions tq ON q.id = tq.question_id
-		WHERE tq.test_id = $1 AND q.is_deleted = false
+		SELECT ` + questionColumns + `
+		FROM questions
+		INNER JOIN (SELECT question_id, order_index FROM test_questions WHERE test_id = $1) tq
+		        ON questions.id = tq.question_id
+		WHERE is_deleted = false
+		  AND version = (SELECT MAX(version) FROM questions q2 WHERE q2.id = tq.question_id)
 		ORDER BY tq.order_index ASC`
 
 	rows, err := r.db.Query(query, testID)
@@ -362,19 +530,7 @@ func (r *TestRepository) GetTestWithQuestions(testID int) (*models.Test, []model
 	var questions []models.Question
 	for rows.Next() {
 		var q models.Question
-		err := rows.Scan(
-			&q.ID,
-			&q.Title,
-			&q.Text,
-			&q.Options,
-			&q.CorrectOption,
-			&q.Points,
-			&q.AuthorID,
-			&q.Version,
-			&q.IsDeleted,
-			&q.CreatedAt,
-		)
-		if err != nil {
+		if err := scanQuestion(rows, &q); err != nil {
 			return nil, nil, err
 		}
 		questions = append(questions, q)
@@ -419,9 +575,136 @@ func (r *TestRepository) UpdateQuestionOrder(testID int, questionIDs []int) erro
 	return tx.Commit()
 }
 
+// GetPoolRules возвращает правила случайного набора вопросов теста
+func (r *TestRepository) GetPoolRules(testID int) ([]models.TestPoolRule, error) {
+	return loadPoolRules(r.db, testID)
+}
+
+func loadPoolRules(q queryer, testID int) ([]models.TestPoolRule, error) {
+	query := `SELECT id, test_id, tag, question_count, weight_by_points
+              FROM test_pool_rules
+              WHERE test_id = $1
+              ORDER BY id`
+
+	rows, err := q.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.TestPoolRule
+	for rows.Next() {
+		var rule models.TestPoolRule
+		err := rows.Scan(&rule.ID, &rule.TestID, &rule.Tag, &rule.QuestionCount, &rule.WeightByPoints)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// SetPoolRules заменяет правила пула теста. Пустой список возвращает тест
+// к фиксированному набору вопросов из test_questions.
+func (r *TestRepository) SetPoolRules(testID int, rules []models.TestPoolRule) error {
+	var isActive bool
+	checkQuery := `SELECT is_active FROM tests WHERE id = $1 AND is_deleted = false`
+	err := r.db.QueryRow(checkQuery, testID).Scan(&isActive)
+	if err != nil {
+		return err
+	}
+
+	if isActive {
+		return &TestError{Message: "Cannot modify question pools of active test"}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM test_pool_rules WHERE test_id = $1`, testID)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO test_pool_rules (test_id, tag, question_count, weight_by_points)
+                    VALUES ($1, $2, $3, $4)
+                    RETURNING id`
+	for i := range rules {
+		rules[i].TestID = testID
+		err := tx.QueryRow(insertQuery, testID, rules[i].Tag, rules[i].QuestionCount,
+			rules[i].WeightByPoints).Scan(&rules[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetQuestionWeights возвращает переопределенные веса вопросов теста
+func (r *TestRepository) GetQuestionWeights(testID int) ([]models.TestQuestionWeight, error) {
+	query := `SELECT question_id, weight FROM test_question_weights
+              WHERE test_id = $1
+              ORDER BY question_id`
+
+	rows, err := r.db.Query(query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var weights []models.TestQuestionWeight
+	for rows.Next() {
+		var weight models.TestQuestionWeight
+		if err := rows.Scan(&weight.QuestionID, &weight.Weight); err != nil {
+			return nil, err
+		}
+		weights = append(weights, weight)
+	}
+	return weights, rows.Err()
+}
+
+// SetQuestionWeights заменяет веса вопросов теста. questions.points при этом
+// не меняется - вопрос может входить в другие тесты со своим весом.
+func (r *TestRepository) SetQuestionWeights(testID int, weights []models.TestQuestionWeight) error {
+	var isActive bool
+	checkQuery := `SELECT is_active FROM tests WHERE id = $1 AND is_deleted = false`
+	err := r.db.QueryRow(checkQuery, testID).Scan(&isActive)
+	if err != nil {
+		return err
+	}
+
+	if isActive {
+		return &TestError{Message: "Cannot modify question weights of active test"}
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM test_question_weights WHERE test_id = $1`, testID)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `INSERT INTO test_question_weights (test_id, question_id, weight)
+                    VALUES ($1, $2, $3)`
+	for _, weight := range weights {
+		if _, err := tx.Exec(insertQuery, testID, weight.QuestionID, weight.Weight); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (r *TestRepository) GetDeleted() ([]models.Test, error) {
-	query := `SELECT id, title, description, course_id, teacher_id, is_active, 
-                     is_deleted, created_at 
+	query := `SELECT ` + testColumns + `
               FROM tests WHERE is_deleted = true 
               ORDER BY created_at DESC`
 	rows, err := r.db.Query(query)
@@ -433,16 +716,7 @@ func (r *TestRepository) GetDeleted() ([]models.Test, error) {
 	var tests []models.Test
 	for rows.Next() {
 		var test models.Test
-		err := rows.Scan(
-			&test.ID,
-			&test.Title,
-			&test.Description,
-			&test.CourseID,
-			&test.TeacherID,
-			&test.IsActive,
-			&test.IsDeleted,
-			&test.CreatedAt,
-		)
+		err := scanTest(rows, &test)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sql_module/internal/models"
+	"time"
+)
+
+// attemptSweepInterval - как часто проверяем попытки с истекшим временем
+const attemptSweepInterval = 30 * time.Second
+
+// testScheduleInterval - как часто проверяем расписание открытия и закрытия тестов
+const testScheduleInterval = 30 * time.Second
+
+// runAttemptSweeper в фоне завершает попытки, у которых вышло время
+func (s *Server) runAttemptSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.sweepExpiredAttempts()
+	}
+}
+
+func (s *Server) sweepExpiredAttempts() {
+	expired, err := s.attemptRepo.ExpireOverdueAttempts()
+	if err != nil {
+		log.Printf("Error expiring overdue attempts: %v", err)
+	}
+
+	for _, attempt := range expired {
+		test, err := s.testRepo.GetByID(attempt.TestID)
+		if err != nil || test == nil {
+			continue
+		}
+
+		notificationData := map[string]interface{}{
+			"test_id":    test.ID,
+			"test_title": test.Title,
+			"attempt_id": attempt.ID,
+			"score":      attempt.Score,
+		}
+
+		s.createNotification(
+			attempt.UserID,
+			"test_completed",
+			"Время вышло",
+			fmt.Sprintf("Время на прохождение теста '%s' истекло, попытка завершена автоматически", test.Title),
+			notificationData,
+		)
+
+		s.notifyCertificateIssued(attempt.ID)
+	}
+}
+
+// runTestScheduler в фоне открывает и закрывает тесты по opens_at / closes_at
+func (s *Server) runTestScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.openScheduledTests()
+		s.closeScheduledTests()
+	}
+}
+
+func (s *Server) openScheduledTests() {
+	tests, err := s.testRepo.GetTestsDueToOpen()
+	if err != nil {
+		log.Printf("Error loading tests to open: %v", err)
+		return
+	}
+
+	for _, test := range tests {
+		// Отмечаем сразу, чтобы не пытаться открыть тест на каждом тике
+		if err := s.testRepo.MarkScheduleOpened(test.ID); err != nil {
+			log.Printf("Error marking test %d as opened: %v", test.ID, err)
+			continue
+		}
+
+		if test.IsActive {
+			continue
+		}
+
+		if test.QuestionsCount == 0 {
+			log.Printf("Scheduled test %d has no questions, skipping activation", test.ID)
+			s.createNotification(
+				test.TeacherID,
+				"test_activated",
+				"Тест не открыт",
+				fmt.Sprintf("Тест '%s' не открыт по расписанию: в нем нет вопросов", test.Title),
+				map[string]interface{}{"test_id": test.ID, "test_title": test.Title, "course_id": test.CourseID},
+			)
+			continue
+		}
+
+		if err := s.testRepo.SetActive(test.ID, true); err != nil {
+			log.Printf("Error activating scheduled test %d: %v", test.ID, err)
+			continue
+		}
+
+		s.notifyCourseStudents(&test, "test_activated", "Тест открыт",
+			fmt.Sprintf("Тест '%s' открыт для прохождения", test.Title))
+	}
+}
+
+func (s *Server) closeScheduledTests() {
+	tests, err := s.testRepo.GetTestsDueToClose()
+	if err != nil {
+		log.Printf("Error loading tests to close: %v", err)
+		return
+	}
+
+	for _, test := range tests {
+		if err := s.testRepo.MarkScheduleClosed(test.ID); err != nil {
+			log.Printf("Error marking test %d as closed: %v", test.ID, err)
+			continue
+		}
+
+		if test.IsActive {
+			if err := s.testRepo.SetActive(test.ID, false); err != nil {
+				log.Printf("Error deactivating scheduled test %d: %v", test.ID, err)
+				continue
+			}
+		}
+
+		completed, err := s.attemptRepo.CompleteAllAttemptsForTest(test.ID)
+		if err != nil {
+			log.Printf("Error completing attempts for closed test %d: %v", test.ID, err)
+		}
+		for _, attempt := range completed {
+			s.notifyCertificateIssued(attempt.ID)
+		}
+
+		s.notifyCourseStudents(&test, "test_deactivated", "Тест закрыт",
+			fmt.Sprintf("Прием ответов на тест '%s' завершен", test.Title))
+	}
+}
+
+// notifyCourseStudents отправляет уведомление всем студентам курса теста
+func (s *Server) notifyCourseStudents(test *models.Test, notificationType, title, message string) {
+	students, err := s.courseRepo.GetCourseStudents(test.CourseID)
+	if err != nil {
+		log.Printf("Error loading students of course %d: %v", test.CourseID, err)
+		return
+	}
+
+	notificationData := map[string]interface{}{
+		"test_id":    test.ID,
+		"test_title": test.Title,
+		"course_id":  test.CourseID,
+	}
+
+	for _, student := range students {
+		s.createNotification(student.ID, notificationType, title, message, notificationData)
+	}
+}
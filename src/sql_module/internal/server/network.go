@@ -0,0 +1,86 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseNetworks разбирает список сетей, неверные записи пропускаются
+func parseNetworks(cidrs []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		prefix, err := parseNetwork(cidr)
+		if err != nil {
+			log.Printf("Ignoring invalid network %q: %v", cidr, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// parseNetwork разбирает CIDR или отдельный адрес (как /32 или /128)
+func parseNetwork(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP возвращает адрес клиента. За доверенным прокси берем X-Real-IP,
+// который nginx перезаписывает адресом соединения, а без него - последний адрес
+// в X-Forwarded-For (его добавил сам прокси). Заголовкам от остальных не верим.
+func (s *Server) clientIP(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	peer = peer.Unmap()
+
+	if !containsAddr(s.trustedProxies, peer) {
+		return peer
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap()
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		parts := strings.Split(forwarded, ",")
+		if addr, err := netip.ParseAddr(strings.TrimSpace(parts[len(parts)-1])); err == nil {
+			return addr.Unmap()
+		}
+	}
+
+	return peer
+}
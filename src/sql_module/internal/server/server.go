@@ -2,13 +2,17 @@ package server
 
 import (
 	"bytes"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/netip"
 	"sql_module/internal/auth"
+	"sql_module/internal/export"
 	"sql_module/internal/models"
 	"sql_module/internal/repository"
 	"strconv"
@@ -28,9 +32,10 @@ type Server struct {
 	questionRepo     *repository.QuestionRepository
 	notificationRepo *repository.NotificationRepository
 	blockMiddleware  *auth.BlockMiddleware
+	trustedProxies   []netip.Prefix // прокси, чьим заголовкам с адресом клиента доверяем
 }
 
-func NewServer(db *sql.DB) *Server {
+func NewServer(db *sql.DB, trustedProxies []string) *Server {
 	s := &Server{
 		router:           mux.NewRouter(),
 		db:               db,
@@ -40,6 +45,7 @@ func NewServer(db *sql.DB) *Server {
 		attemptRepo:      repository.NewAttemptRepository(db),
 		questionRepo:     repository.NewQuestionRepository(db),
 		notificationRepo: repository.NewNotificationRepository(db),
+		trustedProxies:   parseNetworks(trustedProxies),
 	}
 
 	s.configureRouter()
@@ -75,11 +81,32 @@ func (s *Server) configureRouter() {
 	s.router.HandleFunc("/api/courses/{id}", s.handleDeleteCourse).Methods("DELETE")
 	s.router.HandleFunc("/api/courses", s.handleCreateCourse).Methods("POST")
 	s.router.HandleFunc("/api/courses/{id}/tests", s.handleGetCourseTests).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/grade-scale", s.handleGetGradeScale).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/grade-scale", s.handleUpdateGradeScale).Methods("PUT")
+	s.router.HandleFunc("/api/courses/{id}/grade-scale", s.handleDeleteGradeScale).Methods("DELETE")
+	s.router.HandleFunc("/api/courses/{id}/grade-categories", s.handleGetGradeCategories).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/grade-categories", s.handleUpdateGradeCategories).Methods("PUT")
+	s.router.HandleFunc("/api/courses/{id}/gradebook", s.handleGetGradebook).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/gradebook/export", s.handleExportGradebook).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/outcomes", s.handleGetOutcomes).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/outcomes", s.handleCreateOutcome).Methods("POST")
+	s.router.HandleFunc("/api/courses/{id}/outcomes/{outcome_id}", s.handleUpdateOutcome).Methods("PUT")
+	s.router.HandleFunc("/api/courses/{id}/outcomes/{outcome_id}", s.handleDeleteOutcome).Methods("DELETE")
+	s.router.HandleFunc("/api/courses/{id}/outcomes/{outcome_id}/questions", s.handleSetOutcomeQuestions).Methods("PUT")
+	s.router.HandleFunc("/api/courses/{id}/mastery", s.handleGetCourseMastery).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/mastery/{user_id}", s.handleGetStudentMastery).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/accommodations", s.handleGetAccommodations).Methods("GET")
+	s.router.HandleFunc("/api/courses/{id}/accommodations", s.handleSetAccommodation).Methods("PUT")
+	s.router.HandleFunc("/api/courses/{id}/accommodations/{accommodation_id}", s.handleDeleteAccommodation).Methods("DELETE")
 
 	s.router.HandleFunc("/api/login", s.handleLogin).Methods("POST")
 	s.router.HandleFunc("/api/register", s.handleRegister).Methods("POST")
 	// тесты и попытки
 	api.HandleFunc("/tests/{test_id}/start", s.handleStartAttempt).Methods("POST")
+	api.HandleFunc("/tests/{test_id}/access", s.handleGetTestAccess).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/access", s.handleUpdateTestAccess).Methods("PUT")
+	api.HandleFunc("/tests/{test_id}/access/rotate", s.handleRotateAccessCode).Methods("POST")
+	api.HandleFunc("/tests/{test_id}/access/denials", s.handleGetStartDenials).Methods("GET")
 	api.HandleFunc("/attempts/{attempt_id}", s.handleGetAttempt).Methods("GET")
 	api.HandleFunc("/attempts/{attempt_id}/answer", s.handleSubmitAnswer).Methods("POST")
 	api.HandleFunc("/attempts/{attempt_id}/complete", s.handleCompleteAttempt).Methods("POST")
@@ -88,16 +115,38 @@ func (s *Server) configureRouter() {
 	api.HandleFunc("/tests/{id}/restore", s.handleRestoreTest).Methods("POST")
 	api.HandleFunc("/tests/deleted", s.handleGetDeletedTests).Methods("GET")
 	api.HandleFunc("/attempts/{attempt_id}/answers", s.handleGetAttemptAnswers).Methods("GET")
+	api.HandleFunc("/attempts/{attempt_id}/answers", s.handleSubmitAnswers).Methods("POST")
+	api.HandleFunc("/attempts/{attempt_id}/events", s.handleRecordAttemptEvents).Methods("POST")
+	api.HandleFunc("/attempts/{attempt_id}/events", s.handleGetAttemptEvents).Methods("GET")
+	api.HandleFunc("/attempts/{attempt_id}/timing", s.handleGetAttemptTiming).Methods("GET")
+	api.HandleFunc("/reviews", s.handleGetPendingReviews).Methods("GET")
+	api.HandleFunc("/answers/{answer_id}/grade", s.handleGradeAnswer).Methods("POST")
+	api.HandleFunc("/questions/{id}/regrade", s.handleRegradeQuestion).Methods("POST")
+	api.HandleFunc("/tests/{test_id}/regrade", s.handleRegradeTest).Methods("POST")
+	api.HandleFunc("/tests/{test_id}/regrades", s.handleGetRegrades).Methods("GET")
 	api.HandleFunc("/tests/{test_id}/results", s.handleGetTestResults).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/results/export", s.handleExportTestResults).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/item-analysis", s.handleGetItemAnalysis).Methods("GET")
+	api.HandleFunc("/item-analysis", s.handleGetItemAnalysis).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/collusion", s.handleGetCollusionReport).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/timing", s.handleGetTestTiming).Methods("GET")
+	api.HandleFunc("/my/certificates", s.handleGetMyCertificates).Methods("GET")
+	api.HandleFunc("/certificates/{id}/pdf", s.handleDownloadCertificate).Methods("GET")
+	s.router.HandleFunc("/api/certificates/verify/{code}", s.handleVerifyCertificate).Methods("GET")
 	// управление порядком вопросов в тесте
 	api.HandleFunc("/tests/{test_id}/questions/order", s.handleUpdateQuestionOrder).Methods("PUT")
 	api.HandleFunc("/tests/{test_id}/questions/order", s.handleGetQuestionOrder).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/pool-rules", s.handleGetPoolRules).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/pool-rules", s.handleUpdatePoolRules).Methods("PUT")
+	api.HandleFunc("/tests/{test_id}/weights", s.handleGetQuestionWeights).Methods("GET")
+	api.HandleFunc("/tests/{test_id}/weights", s.handleUpdateQuestionWeights).Methods("PUT")
 
 	// управление тестами
 	api.HandleFunc("/tests", s.handleCreateTest).Methods("POST")
 	api.HandleFunc("/tests/{test_id}/questions", s.handleAddQuestionToTest).Methods("POST")
 	api.HandleFunc("/tests", s.handleGetTests).Methods("GET")
 	api.HandleFunc("/tests/{id}", s.handleGetTest).Methods("GET")
+	api.HandleFunc("/tests/{id}", s.handleUpdateTest).Methods("PUT")
 
 	// активация/деактивация теста
 	s.router.HandleFunc("/api/tests/{id}/activate", s.handleActivateTest).Methods("POST")
@@ -1004,6 +1053,9 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) Start(addr string) error {
+	go s.runAttemptSweeper(attemptSweepInterval)
+	go s.runTestScheduler(testScheduleInterval)
+
 	log.Printf("Starting HTTP server on %s", addr)
 	return http.ListenAndServe(addr, s)
 }
@@ -1093,6 +1145,31 @@ func (s *Server) handleStartAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Тело необязательно: код доступа нужен только тестам, где он включен
+	var request struct {
+		AccessCode string `json:"access_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	clientIP := s.clientIP(r)
+	reason, err := s.checkStartAccess(testID, userClaims.UserID, clientIP, request.AccessCode)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if reason != "" {
+		denial := &models.StartDenial{TestID: testID, UserID: userClaims.UserID, ClientIP: clientIP.String(), Reason: reason}
+		if err := s.testRepo.LogStartDenial(denial); err != nil {
+			log.Printf("Failed to log start denial for test %d: %v", testID, err)
+		}
+		log.Printf("Start of test %d denied for user %d from %s: %s", testID, userClaims.UserID, clientIP, reason)
+		respondWithError(w, http.StatusForbidden, startDenialMessages[reason])
+		return
+	}
+
 	attempt, err := s.attemptRepo.StartAttempt(testID, userClaims.UserID)
 	if err != nil {
 		if attemptErr, ok := err.(*repository.AttemptError); ok {
@@ -1122,6 +1199,182 @@ func (s *Server) handleStartAttempt(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusCreated, attempt)
 }
 
+var startDenialMessages = map[string]string{
+	models.StartDenialNetwork:     "Starting this test is not allowed from your network",
+	models.StartDenialMissingCode: "Access code is required",
+	models.StartDenialInvalidCode: "Invalid access code",
+	models.StartDenialLockedOut:   "Too many invalid access codes, try again later",
+}
+
+// checkStartAccess проверяет сеть клиента и код доступа теста.
+// Возвращает причину отказа или пустую строку, если старт разрешен.
+func (s *Server) checkStartAccess(testID, userID int, clientIP netip.Addr, code string) (string, error) {
+	access, err := s.testRepo.GetAccess(testID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(access.AllowedNetworks) > 0 {
+		networks := parseNetworks(access.AllowedNetworks)
+		if !clientIP.IsValid() || !containsAddr(networks, clientIP) {
+			return models.StartDenialNetwork, nil
+		}
+	}
+
+	if access.AccessCode == nil {
+		return "", nil
+	}
+
+	failures, err := s.testRepo.CountRecentCodeFailures(testID, userID)
+	if err != nil {
+		return "", err
+	}
+	if failures >= repository.MaxAccessCodeFailures {
+		return models.StartDenialLockedOut, nil
+	}
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return models.StartDenialMissingCode, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(code), []byte(*access.AccessCode)) != 1 {
+		return models.StartDenialInvalidCode, nil
+	}
+
+	return "", nil
+}
+
+// handleGetTestAccess возвращает код доступа и разрешенные сети теста (для преподавателя)
+func (s *Server) handleGetTestAccess(w http.ResponseWriter, r *http.Request) {
+	test, ok := s.loadTestForAccess(w, r)
+	if !ok {
+		return
+	}
+
+	access, err := s.testRepo.GetAccess(test.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// handleUpdateTestAccess включает или выключает код доступа и задает разрешенные сети.
+// Пустой список сетей снимает ограничение по IP.
+func (s *Server) handleUpdateTestAccess(w http.ResponseWriter, r *http.Request) {
+	test, ok := s.loadTestForAccess(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		RequireCode     bool     `json:"require_code"`
+		AllowedNetworks []string `json:"allowed_networks"` // CIDR или отдельные адреса
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	networks := make([]string, 0, len(request.AllowedNetworks))
+	seen := make(map[netip.Prefix]bool)
+	for _, value := range request.AllowedNetworks {
+		prefix, err := parseNetwork(strings.TrimSpace(value))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid network %q", value))
+			return
+		}
+		if !seen[prefix] {
+			seen[prefix] = true
+			networks = append(networks, prefix.String())
+		}
+	}
+
+	access, err := s.testRepo.SetAccess(test.ID, request.RequireCode, networks)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// handleRotateAccessCode выдает новый код доступа; можно и во время экзамена
+func (s *Server) handleRotateAccessCode(w http.ResponseWriter, r *http.Request) {
+	test, ok := s.loadTestForAccess(w, r)
+	if !ok {
+		return
+	}
+
+	access, err := s.testRepo.RotateAccessCode(test.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, access)
+}
+
+// handleGetStartDenials возвращает журнал отказов в старте попыток
+func (s *Server) handleGetStartDenials(w http.ResponseWriter, r *http.Request) {
+	test, ok := s.loadTestForAccess(w, r)
+	if !ok {
+		return
+	}
+
+	denials, err := s.testRepo.GetStartDenials(test.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if denials == nil {
+		denials = []models.StartDenial{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"test_id": test.ID,
+		"denials": denials,
+		"count":   len(denials),
+	})
+}
+
+// loadTestForAccess загружает тест из пути и проверяет право менять его настройки.
+// При ошибке ответ уже отправлен.
+func (s *Server) loadTestForAccess(w http.ResponseWriter, r *http.Request) (*models.Test, bool) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return nil, false
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return nil, false
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage access to this test")
+		return nil, false
+	}
+
+	return test, true
+}
+
 func (s *Server) handleSubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["attempt_id"])
@@ -1151,12 +1404,7 @@ func (s *Server) handleSubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var answerRequest struct {
-		QuestionID      int `json:"question_id"`
-		QuestionVersion int `json:"question_version"`
-		SelectedOption  int `json:"selected_option"`
-	}
-
+	var answerRequest answerInput
 	if err := json.NewDecoder(r.Body).Decode(&answerRequest); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
@@ -1167,12 +1415,7 @@ func (s *Server) handleSubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	answer, err := s.attemptRepo.SubmitAnswer(
-		attemptID,
-		answerRequest.QuestionID,
-		answerRequest.QuestionVersion,
-		answerRequest.SelectedOption,
-	)
+	answer, err := s.attemptRepo.SubmitAnswer(answerRequest.toAnswer(attemptID))
 
 	if err != nil {
 		if attemptErr, ok := err.(*repository.AttemptError); ok {
@@ -1186,7 +1429,12 @@ func (s *Server) handleSubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, answer)
 }
 
-func (s *Server) handleCompleteAttempt(w http.ResponseWriter, r *http.Request) {
+// maxEventsPerRequest ограничивает число событий прокторинга в одном запросе
+const maxEventsPerRequest = 100
+
+// handleRecordAttemptEvents принимает от клиента события прокторинга попытки
+// (потеря фокуса, скрытие вкладки, выход из полноэкранного режима и т.п.)
+func (s *Server) handleRecordAttemptEvents(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["attempt_id"])
 	if err != nil {
@@ -1215,7 +1463,50 @@ func (s *Server) handleCompleteAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	completedAttempt, err := s.attemptRepo.CompleteAttempt(attemptID)
+	var request struct {
+		Events []struct {
+			EventType  string  `json:"event_type"`
+			OccurredAt string  `json:"occurred_at"` // RFC3339, необязательно
+			Details    *string `json:"details"`
+		} `json:"events"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(request.Events) == 0 {
+		respondWithError(w, http.StatusBadRequest, "events must not be empty")
+		return
+	}
+	if len(request.Events) > maxEventsPerRequest {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Too many events in one request (max %d)", maxEventsPerRequest))
+		return
+	}
+
+	events := make([]models.AttemptEvent, 0, len(request.Events))
+	for _, item := range request.Events {
+		if !repository.IsValidAttemptEvent(item.EventType) {
+			respondWithError(w, http.StatusBadRequest,
+				"event_type must be focus_lost, tab_hidden, fullscreen_exit, copy, paste or reconnect")
+			return
+		}
+
+		event := models.AttemptEvent{EventType: item.EventType, Details: item.Details}
+		if item.OccurredAt != "" {
+			occurredAt, err := time.Parse(time.RFC3339, item.OccurredAt)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "occurred_at must be in RFC3339 format")
+				return
+			}
+			event.OccurredAt = occurredAt.UTC()
+		}
+
+		events = append(events, event)
+	}
+
+	recorded, err := s.attemptRepo.RecordAttemptEvents(attemptID, events)
 	if err != nil {
 		if attemptErr, ok := err.(*repository.AttemptError); ok {
 			respondWithError(w, http.StatusBadRequest, attemptErr.Message)
@@ -1225,10 +1516,15 @@ func (s *Server) handleCompleteAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, completedAttempt)
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"attempt_id": attemptID,
+		"events":     recorded,
+		"count":      len(recorded),
+	})
 }
 
-func (s *Server) handleGetAttempt(w http.ResponseWriter, r *http.Request) {
+// handleGetAttemptEvents возвращает преподавателю хронологию событий прокторинга попытки
+func (s *Server) handleGetAttemptEvents(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["attempt_id"])
 	if err != nil {
@@ -1252,24 +1548,42 @@ func (s *Server) handleGetAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if attempt.UserID != userClaims.UserID {
-		// проверка на препод
-		test, err := s.testRepo.GetByID(attempt.TestID)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
+	test, err := s.testRepo.GetByID(attempt.TestID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
 
-		if test == nil || test.TeacherID != userClaims.UserID {
-			respondWithError(w, http.StatusForbidden, "Access denied")
-			return
-		}
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view attempt events")
+		return
+	}
+
+	events, err := s.attemptRepo.GetAttemptEvents(attemptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if events == nil {
+		events = []models.AttemptEvent{}
 	}
 
-	respondWithJSON(w, http.StatusOK, attempt)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"attempt_id": attemptID,
+		"user_id":    attempt.UserID,
+		"events":     events,
+		"count":      len(events),
+	})
 }
 
-func (s *Server) handleCancelAttempt(w http.ResponseWriter, r *http.Request) {
+// handleGetAttemptTiming возвращает время по вопросам попытки и историю
+// изменений ответов: первый ответ, изменения и итоговый ответ
+func (s *Server) handleGetAttemptTiming(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["attempt_id"])
 	if err != nil {
@@ -1283,30 +1597,64 @@ func (s *Server) handleCancelAttempt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	attempt, err := s.attemptRepo.GetAttemptByID(attemptID)
+	timing, err := s.attemptRepo.GetAttemptTiming(attemptID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if attempt == nil {
+	if timing == nil {
 		respondWithError(w, http.StatusNotFound, "Attempt not found")
 		return
 	}
 
-	if attempt.UserID != userClaims.UserID {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+	test, err := s.testRepo.GetByID(timing.TestID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
 		return
 	}
 
-	if err := s.attemptRepo.CancelAttempt(attemptID); err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view attempt answers")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+	respondWithJSON(w, http.StatusOK, timing)
 }
 
-func (s *Server) handleGetAttemptAnswers(w http.ResponseWriter, r *http.Request) {
+// answerInput - ответ на вопрос в запросе студента
+type answerInput struct {
+	QuestionID      int      `json:"question_id"`
+	QuestionVersion int      `json:"question_version"`
+	SelectedOption  int      `json:"selected_option"`
+	SelectedOptions []int    `json:"selected_options"`
+	TextAnswer      *string  `json:"text_answer"`
+	NumericAnswer   *float64 `json:"numeric_answer"`
+	ClientSeq       *int64   `json:"client_seq"` // номер автосохранения, более старые не затирают новые
+}
+
+func (in answerInput) toAnswer(attemptID int) *models.Answer {
+	return &models.Answer{
+		AttemptID:       attemptID,
+		QuestionID:      in.QuestionID,
+		QuestionVersion: in.QuestionVersion,
+		SelectedOption:  in.SelectedOption,
+		SelectedOptions: in.SelectedOptions,
+		TextAnswer:      in.TextAnswer,
+		NumericAnswer:   in.NumericAnswer,
+		ClientSeq:       in.ClientSeq,
+	}
+}
+
+// maxAnswersPerBatch ограничивает размер пакета автосохранения
+const maxAnswersPerBatch = 200
+
+// handleSubmitAnswers сохраняет пакет ответов попытки (автосохранение).
+// Все ответы записываются в одной транзакции, по каждому возвращается результат.
+func (s *Server) handleSubmitAnswers(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	attemptID, err := strconv.Atoi(vars["attempt_id"])
 	if err != nil {
@@ -1330,50 +1678,71 @@ func (s *Server) handleGetAttemptAnswers(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	canView := false
-	if attempt.UserID == userClaims.UserID {
-		canView = true
-	} else {
-		test, err := s.testRepo.GetByID(attempt.TestID)
-		if err == nil && test != nil && test.TeacherID == userClaims.UserID {
-			canView = true
-		}
+	if attempt.UserID != userClaims.UserID {
+		respondWithError(w, http.StatusForbidden, "This attempt doesn't belong to you")
+		return
 	}
 
-	if !canView {
-		respondWithError(w, http.StatusForbidden, "Access denied")
+	var request struct {
+		Answers []answerInput `json:"answers"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	answers, err := s.attemptRepo.GetAttemptAnswers(attemptID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	if len(request.Answers) == 0 {
+		respondWithError(w, http.StatusBadRequest, "answers must not be empty")
+		return
+	}
+	if len(request.Answers) > maxAnswersPerBatch {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Too many answers in one request (max %d)", maxAnswersPerBatch))
 		return
 	}
 
-	type AnswerResponse struct {
-		QuestionID     int   `json:"question_id"`
-		SelectedOption int   `json:"selected_option"`
-		IsCorrect      *bool `json:"is_correct,omitempty"`
+	answers := make([]models.Answer, 0, len(request.Answers))
+	for _, item := range request.Answers {
+		if item.SelectedOption < -1 {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid option selected for question %d", item.QuestionID))
+			return
+		}
+		answers = append(answers, *item.toAnswer(attemptID))
 	}
 
-	response := make([]AnswerResponse, len(answers))
-	for i, a := range answers {
-		response[i] = AnswerResponse{
-			QuestionID:     a.QuestionID,
-			SelectedOption: a.SelectedOption,
-			IsCorrect:      a.IsCorrect,
+	results, err := s.attemptRepo.SubmitAnswers(attemptID, answers)
+	if err != nil {
+		if attemptErr, ok := err.(*repository.AttemptError); ok {
+			respondWithError(w, http.StatusBadRequest, attemptErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
 		}
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	counts := map[string]int{
+		models.AnswerResultSaved:    0,
+		models.AnswerResultStale:    0,
+		models.AnswerResultRejected: 0,
+	}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"attempt_id": attemptID,
+		"results":    results,
+		"saved":      counts[models.AnswerResultSaved],
+		"stale":      counts[models.AnswerResultStale],
+		"rejected":   counts[models.AnswerResultRejected],
+	})
 }
 
-func (s *Server) handleActivateTest(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleCompleteAttempt(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	testID, err := strconv.Atoi(vars["id"])
+	attemptID, err := strconv.Atoi(vars["attempt_id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		respondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
 		return
 	}
 
@@ -1383,70 +1752,2744 @@ func (s *Server) handleActivateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	test, err := s.testRepo.GetByID(testID)
+	attempt, err := s.attemptRepo.GetAttemptByID(attemptID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if test == nil {
-		respondWithError(w, http.StatusNotFound, "Test not found")
+	if attempt == nil {
+		respondWithError(w, http.StatusNotFound, "Attempt not found")
 		return
 	}
 
-	canActivate := false
-	if auth.HasPermission(userClaims, "test:activate:manage") {
-		canActivate = true // Админ может активировать любой тест
-	} else if auth.HasPermission(userClaims, "test:activate:manage:own") {
-		if test.TeacherID == userClaims.UserID {
-			canActivate = true
-		}
+	if attempt.UserID != userClaims.UserID {
+		respondWithError(w, http.StatusForbidden, "This attempt doesn't belong to you")
+		return
 	}
 
-	if !canActivate {
+	completedAttempt, err := s.attemptRepo.CompleteAttempt(attemptID)
+	if err != nil {
+		if attemptErr, ok := err.(*repository.AttemptError); ok {
+			respondWithError(w, http.StatusBadRequest, attemptErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if err := s.hideScoreDetails(completedAttempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.applyGrade(completedAttempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.notifyCertificateIssued(completedAttempt.ID)
+
+	respondWithJSON(w, http.StatusOK, completedAttempt)
+}
+
+// handleGetPendingReviews - очередь развернутых ответов, ожидающих проверки.
+// Преподаватель видит только ответы на свои тесты.
+func (s *Server) handleGetPendingReviews(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if !auth.HasAnyPermission(userClaims, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to review answers")
+		return
+	}
+
+	testID := 0
+	if testIDStr := r.URL.Query().Get("test_id"); testIDStr != "" {
+		id, err := strconv.Atoi(testIDStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+			return
+		}
+		testID = id
+	}
+
+	teacherID := 0
+	if !auth.HasPermission(userClaims, "course:test:write") {
+		teacherID = userClaims.UserID
+	}
+
+	items, err := s.attemptRepo.GetPendingReviews(testID, teacherID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if items == nil {
+		items = []models.ReviewItem{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"reviews": items,
+		"count":   len(items),
+	})
+}
+
+// handleGradeAnswer - ручная оценка развернутого ответа
+func (s *Server) handleGradeAnswer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	answerID, err := strconv.Atoi(vars["answer_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid answer ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var request struct {
+		Points  *float64 `json:"points"`
+		Comment string   `json:"comment"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if request.Points == nil {
+		respondWithError(w, http.StatusBadRequest, "points is required")
+		return
+	}
+
+	answer, err := s.attemptRepo.GetAnswerByID(answerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if answer == nil {
+		respondWithError(w, http.StatusNotFound, "Answer not found")
+		return
+	}
+
+	attempt, err := s.attemptRepo.GetAttemptByID(answer.AttemptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if attempt == nil {
+		respondWithError(w, http.StatusNotFound, "Attempt not found")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(attempt.TestID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to grade answers for this test")
+		return
+	}
+
+	completedAttempt, err := s.attemptRepo.GradeAnswer(answerID, userClaims.UserID, *request.Points, request.Comment)
+	if err != nil {
+		if attemptErr, ok := err.(*repository.AttemptError); ok {
+			respondWithError(w, http.StatusBadRequest, attemptErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// Все ответы проверены - сообщаем студенту итоговый результат
+	if completedAttempt != nil {
+		if err := s.applyGrade(completedAttempt); err != nil {
+			log.Printf("Failed to grade attempt %d: %v", completedAttempt.ID, err)
+		}
+
+		notificationData := map[string]interface{}{
+			"test_id":    test.ID,
+			"test_title": test.Title,
+			"attempt_id": completedAttempt.ID,
+			"score":      completedAttempt.Score,
+			"grade":      completedAttempt.Grade,
+		}
+
+		s.createNotification(
+			completedAttempt.UserID,
+			"test_completed",
+			"Работа проверена",
+			fmt.Sprintf("Преподаватель проверил ваши ответы на тест '%s'", test.Title),
+			notificationData,
+		)
+
+		s.notifyCertificateIssued(completedAttempt.ID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"answer_id":      answerID,
+		"points":         *request.Points,
+		"attempt_id":     attempt.ID,
+		"attempt_graded": completedAttempt != nil,
+		"attempt":        completedAttempt,
+	})
+}
+
+// handleRegradeQuestion пересчитывает попытки с вопросом после исправления его ключа:
+// ответы переводятся на последнюю версию вопроса и проверяются заново
+func (s *Server) handleRegradeQuestion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	questionID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid question ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	question, err := s.questionRepo.GetByID(questionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if question == nil {
+		respondWithError(w, http.StatusNotFound, "Question not found")
+		return
+	}
+
+	if !s.canModifyQuestion(userClaims, question) {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to regrade this question")
+		return
+	}
+
+	var request struct {
+		Version int    `json:"version"` // только попытки с этой версией вопроса, 0 - все
+		TestID  int    `json:"test_id"` // только попытки этого теста, 0 - все тесты
+		Reason  string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if request.Version < 0 || request.Version > question.Version {
+		respondWithError(w, http.StatusBadRequest, "Invalid question version")
+		return
+	}
+
+	if request.TestID > 0 {
+		test, err := s.testRepo.GetByID(request.TestID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if test == nil {
+			respondWithError(w, http.StatusNotFound, "Test not found")
+			return
+		}
+		if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+			respondWithError(w, http.StatusForbidden, "You don't have permission to regrade this test")
+			return
+		}
+	}
+
+	regrade, err := s.attemptRepo.RegradeQuestion(questionID, request.Version, request.TestID,
+		userClaims.UserID, strings.TrimSpace(request.Reason))
+	if err != nil {
+		if attemptErr, ok := err.(*repository.AttemptError); ok {
+			respondWithError(w, http.StatusBadRequest, attemptErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.notifyRegradedStudents(regrade)
+
+	respondWithJSON(w, http.StatusOK, regrade)
+}
+
+// handleRegradeTest пересчитывает все попытки теста по последним версиям вопросов
+// и текущим настройкам подсчета баллов
+func (s *Server) handleRegradeTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to regrade this test")
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+
+	// Тело необязательно: причина пересчета только попадает в журнал
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	regrade, err := s.attemptRepo.RegradeTest(testID, userClaims.UserID, strings.TrimSpace(request.Reason))
+	if err != nil {
+		if attemptErr, ok := err.(*repository.AttemptError); ok {
+			respondWithError(w, http.StatusBadRequest, attemptErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	s.notifyRegradedStudents(regrade)
+
+	respondWithJSON(w, http.StatusOK, regrade)
+}
+
+// handleGetRegrades возвращает журнал пересчетов теста с баллами до и после
+func (s *Server) handleGetRegrades(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+		return
+	}
+
+	regrades, err := s.attemptRepo.GetRegrades(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if regrades == nil {
+		regrades = []models.Regrade{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"test_id":  testID,
+		"regrades": regrades,
+		"count":    len(regrades),
+	})
+}
+
+// notifyRegradedStudents сообщает студентам, у которых пересчет изменил балл попытки
+func (s *Server) notifyRegradedStudents(regrade *models.Regrade) {
+	titles := make(map[int]string)
+	for _, change := range regrade.Changes {
+		if change.OldScore != nil && change.NewScore != nil &&
+			math.Abs(*change.OldScore-*change.NewScore) < 1e-9 && change.OldMaxScore == change.NewMaxScore {
+			continue
+		}
+
+		title, ok := titles[change.TestID]
+		if !ok {
+			test, err := s.testRepo.GetByID(change.TestID)
+			if err != nil || test == nil {
+				log.Printf("Failed to load test %d for regrade notification: %v", change.TestID, err)
+				continue
+			}
+			title = test.Title
+			titles[change.TestID] = title
+		}
+
+		notificationData := map[string]interface{}{
+			"test_id":       change.TestID,
+			"test_title":    title,
+			"attempt_id":    change.AttemptID,
+			"regrade_id":    regrade.ID,
+			"old_score":     change.OldScore,
+			"new_score":     change.NewScore,
+			"old_max_score": change.OldMaxScore,
+			"new_max_score": change.NewMaxScore,
+		}
+
+		s.createNotification(
+			change.UserID,
+			"test_regraded",
+			"Результат пересчитан",
+			fmt.Sprintf("Преподаватель исправил ключ ответа в тесте '%s', ваш результат пересчитан", title),
+			notificationData,
+		)
+
+		// Сертификат мог быть выдан раньше, при завершении попытки - сообщаем только о выданном при пересчете
+		certificate, err := s.attemptRepo.GetCertificateByAttempt(change.AttemptID)
+		if err != nil {
+			log.Printf("Failed to load certificate for attempt %d: %v", change.AttemptID, err)
+		} else if certificate != nil && certificate.RevokedAt == nil && !certificate.IssuedAt.Before(regrade.CreatedAt) {
+			s.notifyCertificate(certificate)
+		}
+	}
+}
+
+// notifyCertificateIssued сообщает студенту о сертификате, если он выдан после этой попытки
+func (s *Server) notifyCertificateIssued(attemptID int) {
+	certificate, err := s.attemptRepo.GetCertificateByAttempt(attemptID)
+	if err != nil {
+		log.Printf("Failed to load certificate for attempt %d: %v", attemptID, err)
+		return
+	}
+	if certificate != nil {
+		s.notifyCertificate(certificate)
+	}
+}
+
+func (s *Server) notifyCertificate(certificate *models.Certificate) {
+	notificationData := map[string]interface{}{
+		"test_id":           certificate.TestID,
+		"test_title":        certificate.TestTitle,
+		"attempt_id":        certificate.AttemptID,
+		"certificate_id":    certificate.ID,
+		"verification_code": certificate.VerificationCode,
+		"percentage":        certificate.Percentage,
+	}
+
+	s.createNotification(
+		certificate.UserID,
+		"test_completed",
+		"Тест пройден",
+		fmt.Sprintf("Вы прошли тест '%s' и получили сертификат", certificate.TestTitle),
+		notificationData,
+	)
+}
+
+func (s *Server) handleGetAttempt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["attempt_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	attempt, err := s.attemptRepo.GetAttemptByID(attemptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if attempt == nil {
+		respondWithError(w, http.StatusNotFound, "Attempt not found")
+		return
+	}
+
+	// Вопросы попытки в ее порядке: при пулах набор у каждой попытки свой
+	test, questions, err := s.testRepo.GetTestWithQuestions(attempt.TestID, attemptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// проверка на препод
+	if attempt.UserID != userClaims.UserID && (test == nil || test.TeacherID != userClaims.UserID) {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	// Студенту - без ключей ответа
+
+	questionViews := make([]interface{}, len(questions))
+	for i := range questions {
+		if attempt.UserID == userClaims.UserID {
+			questionViews[i] = studentQuestionView(&questions[i])
+		} else {
+			questionViews[i] = questions[i]
+		}
+	}
+
+	if attempt.UserID == userClaims.UserID {
+		if err := s.hideScoreDetails(attempt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := s.applyGrade(attempt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		*models.Attempt
+		Questions []interface{} `json:"questions"`
+	}{attempt, questionViews})
+}
+
+func (s *Server) handleCancelAttempt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["attempt_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	attempt, err := s.attemptRepo.GetAttemptByID(attemptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if attempt == nil {
+		respondWithError(w, http.StatusNotFound, "Attempt not found")
+		return
+	}
+
+	if attempt.UserID != userClaims.UserID {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	if err := s.attemptRepo.CancelAttempt(attemptID); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
+
+func (s *Server) handleGetAttemptAnswers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	attemptID, err := strconv.Atoi(vars["attempt_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid attempt ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	attempt, err := s.attemptRepo.GetAttemptByID(attemptID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if attempt == nil {
+		respondWithError(w, http.StatusNotFound, "Attempt not found")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(attempt.TestID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Преподаватель видит разбор полностью, студент - в рамках политики теста
+	var content string
+	if test.TeacherID == userClaims.UserID {
+		content = repository.ReviewFull
+	} else if attempt.UserID == userClaims.UserID {
+		content = studentReviewContent(test, attempt)
+	} else {
+		respondWithError(w, http.StatusForbidden, "Access denied")
+		return
+	}
+
+	answers, err := s.attemptRepo.GetAttemptAnswers(attemptID, content)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if answers == nil {
+		answers = []models.AnswerReview{}
+	}
+
+	respondWithJSON(w, http.StatusOK, answers)
+}
+
+// studentReviewContent определяет, что владелец попытки может видеть в разборе сейчас.
+// Пока попытка идет или тест с разбором после закрытия еще открыт - только свои ответы и балл.
+func studentReviewContent(test *models.Test, attempt *models.Attempt) string {
+	if attempt.Status == "in_progress" {
+		return repository.ReviewScoreOnly
+	}
+	if test.ReviewAvailability == repository.ReviewAfterClose && !isTestClosed(test) {
+		return repository.ReviewScoreOnly
+	}
+	return test.ReviewContent
+}
+
+// isTestClosed - тест больше не принимает попытки: деактивирован или прошло closes_at
+func isTestClosed(test *models.Test) bool {
+	return !test.IsActive || (test.ClosesAt != nil && !test.ClosesAt.After(time.Now()))
+}
+
+// applyGrade заполняет процент и оценку завершенной попытки по шкале курса теста
+func (s *Server) applyGrade(attempt *models.Attempt) error {
+	if attempt.Status != "completed" {
+		return nil
+	}
+
+	test, err := s.testRepo.GetByID(attempt.TestID)
+	if err != nil || test == nil {
+		return err
+	}
+
+	scale, err := s.courseRepo.GetGradeScale(test.CourseID)
+	if err != nil {
+		return err
+	}
+
+	attempt.Percentage, attempt.Grade = repository.GradeScore(scale, attempt.Score, attempt.MaxScore)
+	return nil
+}
+
+// hideScoreDetails убирает из попытки расшифровку балла по вопросам,
+// если политика просмотра показывает студенту только итог
+func (s *Server) hideScoreDetails(attempt *models.Attempt) error {
+	if attempt.ScoreBreakdown == nil {
+		return nil
+	}
+
+	test, err := s.testRepo.GetByID(attempt.TestID)
+	if err != nil {
+		return err
+	}
+
+	if test == nil || studentReviewContent(test, attempt) == repository.ReviewScoreOnly {
+		breakdown := *attempt.ScoreBreakdown
+		breakdown.Questions = nil
+		attempt.ScoreBreakdown = &breakdown
+	}
+
+	return nil
+}
+
+func (s *Server) handleActivateTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	canActivate := false
+	if auth.HasPermission(userClaims, "test:activate:manage") {
+		canActivate = true // Админ может активировать любой тест
+	} else if auth.HasPermission(userClaims, "test:activate:manage:own") {
+		if test.TeacherID == userClaims.UserID {
+			canActivate = true
+		}
+	}
+
+	if !canActivate {
 		respondWithError(w, http.StatusForbidden, "You don't have permission to activate this test")
 		return
 	}
 
-	if test.IsActive {
-		respondWithError(w, http.StatusBadRequest, "Test is already active")
+	if test.IsActive {
+		respondWithError(w, http.StatusBadRequest, "Test is already active")
+		return
+	}
+
+	if test.QuestionsCount == 0 {
+		respondWithError(w, http.StatusBadRequest, "Cannot activate test without questions")
+		return
+	}
+
+	if err := s.testRepo.SetActive(testID, true); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	notificationData := map[string]interface{}{
+		"test_id":    testID,
+		"test_title": test.Title,
+		"course_id":  test.CourseID,
+	}
+
+	s.createNotification(
+		test.TeacherID,
+		"test_activated",
+		"Тест активирован",
+		fmt.Sprintf("Тест '%s' был активирован", test.Title),
+		notificationData,
+	)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Test activated successfully",
+		"test_id": strconv.Itoa(testID),
+	})
+}
+
+// handleGetGradeScale возвращает шкалу оценок курса
+func (s *Server) handleGetGradeScale(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	// Шкалу видят те же, кто видит тесты курса
+	canView := false
+	if auth.HasPermission(userClaims, "course:testList:read") {
+		canView = true
+	} else if auth.HasPermission(userClaims, "course:testList:own") {
+		canView = course.TeacherID == userClaims.UserID
+	} else if auth.HasPermission(userClaims, "course:testList:enrolled") {
+		enrolled, err := s.courseRepo.IsStudentEnrolled(courseID, userClaims.UserID)
+		canView = err == nil && enrolled
+	}
+
+	if !canView {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view this course")
+		return
+	}
+
+	scale, err := s.courseRepo.GetGradeScale(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if scale == nil {
+		respondWithError(w, http.StatusNotFound, "Grade scale is not set for this course")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, scale)
+}
+
+// handleUpdateGradeScale задает шкалу оценок курса: готовую (preset) или свои пороги (levels)
+func (s *Server) handleUpdateGradeScale(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:info:write", "course:info:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this course")
+		return
+	}
+
+	var request struct {
+		Preset string              `json:"preset"` // russian_5, pass_fail, letter
+		Name   string              `json:"name"`
+		Levels []models.GradeLevel `json:"levels"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var scale *models.GradeScale
+	if request.Preset != "" {
+		preset, ok := repository.GradeScalePreset(request.Preset)
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, "preset must be russian_5, pass_fail or letter")
+			return
+		}
+		scale = preset
+		if request.Name != "" {
+			scale.Name = request.Name
+		}
+	} else {
+		scale = &models.GradeScale{Name: strings.TrimSpace(request.Name), Levels: request.Levels}
+		if scale.Name == "" {
+			respondWithError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		if msg := validateGradeLevels(scale.Levels); msg != "" {
+			respondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	scale.CourseID = courseID
+
+	if err := s.courseRepo.SetGradeScale(scale); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, scale)
+}
+
+func (s *Server) handleDeleteGradeScale(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:info:write", "course:info:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this course")
+		return
+	}
+
+	if err := s.courseRepo.DeleteGradeScale(courseID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Grade scale is not set for this course")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Grade scale deleted successfully"})
+}
+
+// handleGetGradebook возвращает журнал оценок курса: засчитанные результаты
+// всех студентов курса по всем его тестам, итоги по категориям и итоговую оценку
+func (s *Server) handleGetGradebook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view results in this course")
+		return
+	}
+
+	gradebook, err := s.loadGradebook(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, gradebook)
+}
+
+// loadGradebookLayout загружает тесты, категории и шкалу оценок журнала курса
+func (s *Server) loadGradebookLayout(courseID int) (*repository.GradebookLayout, error) {
+	tests, err := s.testRepo.GetByCourseID(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.courseRepo.GetGradeCategories(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	scale, err := s.courseRepo.GetGradeScale(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.NewGradebookLayout(tests, categories, scale), nil
+}
+
+// loadGradebook собирает журнал оценок курса
+func (s *Server) loadGradebook(courseID int) (*models.Gradebook, error) {
+	layout, err := s.loadGradebookLayout(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	students, err := s.courseRepo.GetCourseStudents(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	cells, err := s.attemptRepo.GetGradebookCells(layout.TestIDs())
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.BuildGradebook(courseID, layout, students, cells), nil
+}
+
+// handleExportGradebook выгружает журнал оценок курса в CSV или XLSX.
+// Студенты читаются из базы и пишутся в ответ по одному.
+func (s *Server) handleExportGradebook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	format, delimiter, msg := parseExportParams(r)
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view results in this course")
+		return
+	}
+
+	layout, err := s.loadGradebookLayout(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	columns := []string{"Student", "Email"}
+	for _, test := range layout.Tests {
+		columns = append(columns, test.Title)
+	}
+	columns = append(columns, "Total score", "Max score", "Percentage")
+	for _, category := range layout.Categories {
+		columns = append(columns, fmt.Sprintf("%s, %%", category.Name))
+	}
+	columns = append(columns, "Final percentage", "Final grade")
+
+	writer, err := startExport(w, format, delimiter, fmt.Sprintf("course-%d-gradebook", courseID), course.Name)
+	if err != nil {
+		log.Printf("Failed to export gradebook of course %d: %v", courseID, err)
+		return
+	}
+
+	// После начала выгрузки ответить ошибкой уже нельзя - файл просто обрывается
+	err = writer.WriteHeader(columns)
+	if err == nil {
+		err = s.attemptRepo.ExportGradebook(courseID, layout.TestIDs(), func(student models.User, cells map[int]models.GradebookCell) error {
+			row := layout.Row(student, cells)
+			values := []interface{}{row.FullName, row.Email}
+			for _, cell := range row.Cells {
+				// Ячейка без засчитанного результата показывает состояние: in_progress, awaiting_review
+				switch {
+				case cell.Score != nil:
+					values = append(values, *cell.Score)
+				case cell.Status != models.GradebookNotStarted:
+					values = append(values, cell.Status)
+				default:
+					values = append(values, nil)
+				}
+			}
+			values = append(values, row.TotalScore, row.TotalMaxScore, row.Percentage)
+			for _, category := range row.Categories {
+				values = append(values, category.Percentage)
+			}
+			values = append(values, row.FinalPercentage, row.FinalGrade)
+			return writer.WriteRow(values)
+		})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		log.Printf("Failed to export gradebook of course %d: %v", courseID, err)
+	}
+}
+
+// handleGetGradeCategories возвращает категории оценок курса
+func (s *Server) handleGetGradeCategories(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view results in this course")
+		return
+	}
+
+	categories, err := s.courseRepo.GetGradeCategories(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if categories == nil {
+		categories = []models.GradeCategory{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"course_id":  courseID,
+		"categories": categories,
+	})
+}
+
+// handleUpdateGradeCategories заменяет категории оценок курса. Пустой список
+// убирает категории - итог снова считается по сумме баллов
+func (s *Server) handleUpdateGradeCategories(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:info:write", "course:info:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this course")
+		return
+	}
+
+	var request struct {
+		Categories []models.GradeCategory `json:"categories"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	tests, err := s.testRepo.GetByCourseID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if msg := validateGradeCategories(request.Categories, tests); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := s.courseRepo.SetGradeCategories(courseID, request.Categories); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if request.Categories == nil {
+		request.Categories = []models.GradeCategory{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"course_id":  courseID,
+		"categories": request.Categories,
+	})
+}
+
+// handleGetOutcomes возвращает результаты обучения курса с привязанными вопросами
+func (s *Server) handleGetOutcomes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	// Результаты обучения видят те же, кто видит тесты курса
+	canView := false
+	if auth.HasPermission(userClaims, "course:testList:read") {
+		canView = true
+	} else if auth.HasPermission(userClaims, "course:testList:own") {
+		canView = course.TeacherID == userClaims.UserID
+	} else if auth.HasPermission(userClaims, "course:testList:enrolled") {
+		enrolled, err := s.courseRepo.IsStudentEnrolled(courseID, userClaims.UserID)
+		canView = err == nil && enrolled
+	}
+
+	if !canView {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view this course")
+		return
+	}
+
+	outcomes, err := s.courseRepo.GetOutcomes(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if outcomes == nil {
+		outcomes = []models.LearningOutcome{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"course_id": courseID,
+		"outcomes":  outcomes,
+		"count":     len(outcomes),
+	})
+}
+
+// handleCreateOutcome добавляет результат обучения в курс
+func (s *Server) handleCreateOutcome(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:info:write", "course:info:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this course")
+		return
+	}
+
+	var request struct {
+		Code             string   `json:"code"`
+		Title            string   `json:"title"`
+		Description      string   `json:"description"`
+		MasteryThreshold *float64 `json:"mastery_threshold"` // по умолчанию 70
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	outcome := &models.LearningOutcome{
+		CourseID:         courseID,
+		Code:             request.Code,
+		Title:            request.Title,
+		Description:      request.Description,
+		MasteryThreshold: repository.DefaultMasteryThreshold,
+	}
+	if request.MasteryThreshold != nil {
+		outcome.MasteryThreshold = *request.MasteryThreshold
+	}
+
+	if msg := s.validateOutcome(outcome); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := s.courseRepo.CreateOutcome(outcome); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, outcome)
+}
+
+// handleUpdateOutcome меняет переданные поля результата обучения
+func (s *Server) handleUpdateOutcome(w http.ResponseWriter, r *http.Request) {
+	outcome, ok := s.loadOutcomeForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Code             *string  `json:"code"`
+		Title            *string  `json:"title"`
+		Description      *string  `json:"description"`
+		MasteryThreshold *float64 `json:"mastery_threshold"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if request.Code != nil {
+		outcome.Code = *request.Code
+	}
+	if request.Title != nil {
+		outcome.Title = *request.Title
+	}
+	if request.Description != nil {
+		outcome.Description = *request.Description
+	}
+	if request.MasteryThreshold != nil {
+		outcome.MasteryThreshold = *request.MasteryThreshold
+	}
+
+	if msg := s.validateOutcome(outcome); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := s.courseRepo.UpdateOutcome(outcome); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, outcome)
+}
+
+func (s *Server) handleDeleteOutcome(w http.ResponseWriter, r *http.Request) {
+	outcome, ok := s.loadOutcomeForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.courseRepo.DeleteOutcome(outcome.ID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Learning outcome not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Learning outcome deleted successfully"})
+}
+
+// handleSetOutcomeQuestions заменяет вопросы, которые проверяют результат обучения
+func (s *Server) handleSetOutcomeQuestions(w http.ResponseWriter, r *http.Request) {
+	outcome, ok := s.loadOutcomeForEdit(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		QuestionIDs []int `json:"question_ids"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := s.courseRepo.SetOutcomeQuestions(outcome.ID, request.QuestionIDs); err != nil {
+		if qErr, ok := err.(*repository.QuestionError); ok {
+			respondWithError(w, http.StatusBadRequest, qErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	outcome, err := s.courseRepo.GetOutcome(outcome.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, outcome)
+}
+
+// loadOutcomeForEdit загружает результат обучения из пути запроса и проверяет,
+// что он относится к курсу и пользователь может редактировать курс.
+// При false ответ с ошибкой уже отправлен.
+func (s *Server) loadOutcomeForEdit(w http.ResponseWriter, r *http.Request) (*models.LearningOutcome, bool) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return nil, false
+	}
+
+	outcomeID, err := strconv.Atoi(vars["outcome_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid outcome ID")
+		return nil, false
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return nil, false
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:info:write", "course:info:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this course")
+		return nil, false
+	}
+
+	outcome, err := s.courseRepo.GetOutcome(outcomeID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if outcome == nil || outcome.CourseID != courseID {
+		respondWithError(w, http.StatusNotFound, "Learning outcome not found")
+		return nil, false
+	}
+
+	return outcome, true
+}
+
+// validateOutcome проверяет поля результата обучения и уникальность кода в курсе
+func (s *Server) validateOutcome(outcome *models.LearningOutcome) string {
+	outcome.Code = strings.TrimSpace(outcome.Code)
+	outcome.Title = strings.TrimSpace(outcome.Title)
+
+	if outcome.Code == "" || len([]rune(outcome.Code)) > 50 {
+		return "code is required and must be at most 50 characters"
+	}
+	if outcome.Title == "" || len([]rune(outcome.Title)) > 255 {
+		return "title is required and must be at most 255 characters"
+	}
+	if outcome.MasteryThreshold <= 0 || outcome.MasteryThreshold > 100 {
+		return "mastery_threshold must be greater than 0 and at most 100"
+	}
+
+	outcomes, err := s.courseRepo.GetOutcomes(outcome.CourseID)
+	if err != nil {
+		return err.Error()
+	}
+	for _, other := range outcomes {
+		if other.ID != outcome.ID && other.Code == outcome.Code {
+			return fmt.Sprintf("Duplicate code: %s", outcome.Code)
+		}
+	}
+
+	return ""
+}
+
+// handleGetCourseMastery возвращает освоение результатов обучения всеми студентами курса
+func (s *Server) handleGetCourseMastery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view results in this course")
+		return
+	}
+
+	outcomes, err := s.courseRepo.GetOutcomes(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	students, err := s.courseRepo.GetCourseStudents(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	userIDs := make([]int, len(students))
+	for i, student := range students {
+		userIDs[i] = student.ID
+	}
+
+	mastery, err := s.attemptRepo.GetOutcomeMastery(courseID, outcomes, userIDs)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	report := models.CourseMasteryReport{
+		CourseID: courseID,
+		Students: make([]models.StudentMastery, len(students)),
+	}
+	for i, student := range students {
+		report.Students[i] = models.StudentMastery{
+			CourseID: courseID,
+			UserID:   student.ID,
+			FullName: student.FullName,
+			Email:    student.Email,
+			Outcomes: mastery[student.ID],
+		}
+	}
+	report.Outcomes = repository.SummarizeMastery(outcomes, report.Students)
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// handleGetStudentMastery возвращает освоение результатов обучения одним
+// студентом курса. Студент может смотреть только свое освоение
+func (s *Server) handleGetStudentMastery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userID, err := strconv.Atoi(vars["user_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if userID != userClaims.UserID && !s.canModifyCourse(userClaims, course, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view results of this student")
+		return
+	}
+
+	enrolled, err := s.courseRepo.IsStudentEnrolled(courseID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !enrolled {
+		respondWithError(w, http.StatusNotFound, "Student is not enrolled in this course")
+		return
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	outcomes, err := s.courseRepo.GetOutcomes(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	mastery, err := s.attemptRepo.GetOutcomeMastery(courseID, outcomes, []int{userID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.StudentMastery{
+		CourseID: courseID,
+		UserID:   userID,
+		FullName: user.FullName,
+		Email:    user.Email,
+		Outcomes: mastery[userID],
+	})
+}
+
+// handleGetAccommodations возвращает особые условия студентов на курс и его тесты
+func (s *Server) handleGetAccommodations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage accommodations in this course")
+		return
+	}
+
+	accommodations, err := s.courseRepo.GetAccommodations(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if accommodations == nil {
+		accommodations = []models.Accommodation{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"course_id":      courseID,
+		"accommodations": accommodations,
+		"count":          len(accommodations),
+	})
+}
+
+// handleSetAccommodation задает особые условия студента на весь курс или,
+// если передан test_id, на один тест курса. Повторный вызов заменяет условия.
+func (s *Server) handleSetAccommodation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage accommodations in this course")
+		return
+	}
+
+	var request struct {
+		UserID         int      `json:"user_id"`
+		TestID         *int     `json:"test_id"`
+		TimeMultiplier *float64 `json:"time_multiplier"` // по умолчанию 1
+		ExtraAttempts  int      `json:"extra_attempts"`
+		Note           string   `json:"note"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	multiplier := repository.MinTimeMultiplier
+	if request.TimeMultiplier != nil {
+		multiplier = *request.TimeMultiplier
+	}
+	if multiplier < repository.MinTimeMultiplier || multiplier > repository.MaxTimeMultiplier {
+		respondWithError(w, http.StatusBadRequest, "time_multiplier must be between 1 and 5")
+		return
+	}
+	if request.ExtraAttempts < 0 {
+		respondWithError(w, http.StatusBadRequest, "extra_attempts must not be negative")
+		return
+	}
+	if multiplier == repository.MinTimeMultiplier && request.ExtraAttempts == 0 {
+		respondWithError(w, http.StatusBadRequest, "Accommodation must add time or attempts")
+		return
+	}
+
+	enrolled, err := s.courseRepo.IsStudentEnrolled(courseID, request.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !enrolled {
+		respondWithError(w, http.StatusBadRequest, "Student is not enrolled in this course")
+		return
+	}
+
+	accommodation := &models.Accommodation{
+		UserID:         request.UserID,
+		TimeMultiplier: multiplier,
+		ExtraAttempts:  request.ExtraAttempts,
+		Note:           strings.TrimSpace(request.Note),
+		CreatedBy:      userClaims.UserID,
+	}
+
+	if request.TestID != nil {
+		test, err := s.testRepo.GetByID(*request.TestID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if test == nil || test.CourseID != courseID {
+			respondWithError(w, http.StatusBadRequest, "Test not found in this course")
+			return
+		}
+		accommodation.TestID = request.TestID
+	} else {
+		accommodation.CourseID = &courseID
+	}
+
+	if err := s.courseRepo.SetAccommodation(accommodation); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, accommodation)
+}
+
+func (s *Server) handleDeleteAccommodation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	accommodationID, err := strconv.Atoi(vars["accommodation_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid accommodation ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, course, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage accommodations in this course")
+		return
+	}
+
+	accommodation, err := s.courseRepo.GetAccommodation(accommodationID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Условия на тест относятся к курсу этого теста
+	inCourse := false
+	if accommodation != nil && accommodation.CourseID != nil {
+		inCourse = *accommodation.CourseID == courseID
+	} else if accommodation != nil {
+		test, err := s.testRepo.GetByID(*accommodation.TestID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		inCourse = test != nil && test.CourseID == courseID
+	}
+
+	if !inCourse {
+		respondWithError(w, http.StatusNotFound, "Accommodation not found")
+		return
+	}
+
+	if err := s.courseRepo.DeleteAccommodation(accommodationID); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Accommodation not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Accommodation deleted successfully"})
+}
+
+// validateGradeLevels проверяет пороги шкалы: оценки и пороги не повторяются,
+// пороги в пределах 0..100 и есть уровень с порогом 0, чтобы оценка была у любого результата
+func validateGradeLevels(levels []models.GradeLevel) string {
+	if len(levels) < 2 {
+		return "levels must contain at least 2 grades"
+	}
+
+	grades := make(map[string]bool)
+	thresholds := make(map[float64]bool)
+	hasZero := false
+	for i := range levels {
+		levels[i].Grade = strings.TrimSpace(levels[i].Grade)
+		level := levels[i]
+
+		if level.Grade == "" {
+			return "grade must not be empty"
+		}
+		if grades[level.Grade] {
+			return fmt.Sprintf("Duplicate grade: %s", level.Grade)
+		}
+		grades[level.Grade] = true
+
+		if level.MinPercent < 0 || level.MinPercent > 100 {
+			return "min_percent must be between 0 and 100"
+		}
+		if thresholds[level.MinPercent] {
+			return fmt.Sprintf("Duplicate min_percent: %g", level.MinPercent)
+		}
+		thresholds[level.MinPercent] = true
+
+		if level.MinPercent == 0 {
+			hasZero = true
+		}
+	}
+
+	if !hasZero {
+		return "levels must include a grade with min_percent 0"
+	}
+
+	return ""
+}
+
+// validateGradeCategories проверяет категории: имена не повторяются, вес
+// положительный, тесты принадлежат курсу и входят не больше чем в одну категорию
+func validateGradeCategories(categories []models.GradeCategory, tests []models.Test) string {
+	courseTests := make(map[int]bool, len(tests))
+	for _, test := range tests {
+		courseTests[test.ID] = true
+	}
+
+	names := make(map[string]bool)
+	assigned := make(map[int]bool)
+	for i := range categories {
+		categories[i].Name = strings.TrimSpace(categories[i].Name)
+		category := categories[i]
+
+		if category.Name == "" {
+			return "category name must not be empty"
+		}
+		if names[category.Name] {
+			return fmt.Sprintf("Duplicate category: %s", category.Name)
+		}
+		names[category.Name] = true
+
+		if category.Weight <= 0 {
+			return "weight must be greater than 0"
+		}
+
+		for _, testID := range category.TestIDs {
+			if !courseTests[testID] {
+				return fmt.Sprintf("Test %d does not belong to this course", testID)
+			}
+			if assigned[testID] {
+				return fmt.Sprintf("Test %d is in more than one category", testID)
+			}
+			assigned[testID] = true
+		}
+	}
+
+	return ""
+}
+
+func (s *Server) handleGetCourseTests(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	courseID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	course, err := s.courseRepo.GetByID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if course == nil {
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	canView := false
+
+	// Админ может видеть все
+	if auth.HasPermission(userClaims, "course:testList:read") {
+		canView = true
+	} else if auth.HasPermission(userClaims, "course:testList:own") {
+		if course.TeacherID == userClaims.UserID {
+			canView = true
+		}
+	} else if auth.HasPermission(userClaims, "course:testList:enrolled") {
+		enrolled, err := s.courseRepo.IsStudentEnrolled(courseID, userClaims.UserID)
+		if err == nil && enrolled {
+			canView = true
+		}
+	}
+
+	if !canView {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view tests for this course")
+		return
+	}
+
+	tests, err := s.testRepo.GetByCourseID(courseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if auth.HasPermission(userClaims, "course:testList:enrolled") {
+		var activeTests []models.Test
+		for _, test := range tests {
+			if test.IsActive && !test.IsDeleted {
+				activeTests = append(activeTests, test)
+			}
+		}
+		tests = activeTests
+	} else {
+		var filteredTests []models.Test
+		for _, test := range tests {
+			if !test.IsDeleted {
+				filteredTests = append(filteredTests, test)
+			}
+		}
+		tests = filteredTests
+	}
+
+	respondWithJSON(w, http.StatusOK, tests)
+}
+
+func (s *Server) handleDeactivateTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	canDeactivate := false
+	if auth.HasPermission(userClaims, "test:activate:manage") {
+		canDeactivate = true // Админ может деактивировать любой тест
+	} else if auth.HasPermission(userClaims, "test:activate:manage:own") {
+		if test.TeacherID == userClaims.UserID {
+			canDeactivate = true
+		}
+	}
+
+	if !canDeactivate {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to deactivate this test")
+		return
+	}
+
+	if !test.IsActive {
+		respondWithError(w, http.StatusBadRequest, "Test is already deactivated")
+		return
+	}
+
+	if err := s.testRepo.SetActive(testID, false); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	completed, err := s.attemptRepo.CompleteAllAttemptsForTest(testID)
+	if err != nil {
+		log.Printf("Warning: Failed to complete attempts for deactivated test %d: %v", testID, err)
+	}
+	for _, attempt := range completed {
+		s.notifyCertificateIssued(attempt.ID)
+	}
+
+	notificationData := map[string]interface{}{
+		"test_id":    testID,
+		"test_title": test.Title,
+		"course_id":  test.CourseID,
+	}
+
+	s.createNotification(
+		test.TeacherID,
+		"test_deactivated",
+		"Тест деактивирован",
+		fmt.Sprintf("Тест '%s' был деактивирован", test.Title),
+		notificationData,
+	)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Test deactivated successfully",
+		"test_id": strconv.Itoa(testID),
+	})
+}
+
+func (s *Server) handleGetTestResults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "test:answer:read", "test:answer:read") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+		return
+	}
+
+	bins := repository.DefaultHistogramBins
+	if binsStr := r.URL.Query().Get("bins"); binsStr != "" {
+		bins, err = strconv.Atoi(binsStr)
+		if err != nil || bins < 1 || bins > repository.MaxHistogramBins {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("bins must be between 1 and %d", repository.MaxHistogramBins))
+			return
+		}
+	}
+
+	attempts, err := s.attemptRepo.GetTestResults(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	summary, err := s.attemptRepo.GetResultsSummary(testID, bins)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	proctoring, err := s.attemptRepo.GetProctoringSummary(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	suspicious := make(map[int]int, len(proctoring))
+	for _, summary := range proctoring {
+		suspicious[summary.AttemptID] = summary.Suspicious
+	}
+
+	if proctoring == nil {
+		proctoring = []models.ProctoringSummary{}
+	}
+
+	finalResults, err := s.attemptRepo.GetFinalResults(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	scale, err := s.courseRepo.GetGradeScale(test.CourseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for i := range finalResults {
+		finalResults[i].Percentage, finalResults[i].Grade =
+			repository.GradeScore(scale, &finalResults[i].Score, finalResults[i].MaxScore)
+		if test.PassingPercent != nil && finalResults[i].Percentage != nil {
+			passed := *finalResults[i].Percentage >= *test.PassingPercent
+			finalResults[i].Passed = &passed
+		}
+	}
+
+	if finalResults == nil {
+		finalResults = []models.TestResult{}
+	}
+
+	accommodationUses, err := s.attemptRepo.GetAccommodationUses(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if accommodationUses == nil {
+		accommodationUses = []models.AttemptAccommodation{}
+	}
+
+	type ResultResponse struct {
+		AttemptID        int      `json:"attempt_id"`
+		UserID           int      `json:"user_id"`
+		Score            *float64 `json:"score,omitempty"`
+		MaxScore         float64  `json:"max_score"`
+		Percentage       *float64 `json:"percentage,omitempty"`
+		Grade            *string  `json:"grade,omitempty"`
+		StartedAt        string   `json:"started_at"`
+		Completed        string   `json:"completed,omitempty"`
+		SuspiciousEvents int      `json:"suspicious_events"`
+
+		Accommodation *models.AttemptAccommodation `json:"accommodation,omitempty"` // примененные особые условия
+	}
+
+	type TestResultsResponse struct {
+		TestID       int                        `json:"test_id"`
+		Results      []ResultResponse           `json:"results"`
+		Count        int                        `json:"count"`
+		Summary      *models.ResultsSummary     `json:"summary"`
+		FinalResults []models.TestResult        `json:"final_results"` // итог студента по политике повторных попыток
+		GradeScale   *models.GradeScale         `json:"grade_scale"`
+		Proctoring   []models.ProctoringSummary `json:"proctoring"` // события по всем попыткам, включая незавершенные
+
+		AccommodationUses []models.AttemptAccommodation `json:"accommodation_uses"` // все попытки с особыми условиями, включая незавершенные
+	}
+
+	results := make([]ResultResponse, len(attempts))
+	for i, a := range attempts {
+		completed := ""
+		if a.CompletedAt != nil {
+			completed = a.CompletedAt.Format(time.RFC3339)
+		}
+
+		percentage, grade := repository.GradeScore(scale, a.Score, a.MaxScore)
+
+		results[i] = ResultResponse{
+			AttemptID:        a.ID,
+			UserID:           a.UserID,
+			Score:            a.Score,
+			MaxScore:         a.MaxScore,
+			Percentage:       percentage,
+			Grade:            grade,
+			StartedAt:        a.StartedAt.Format(time.RFC3339),
+			Completed:        completed,
+			SuspiciousEvents: suspicious[a.ID],
+			Accommodation:    a.Accommodation,
+		}
+	}
+
+	response := TestResultsResponse{
+		TestID:       testID,
+		Results:      results,
+		Count:        len(results),
+		Summary:      summary,
+		FinalResults: finalResults,
+		GradeScale:   scale,
+		Proctoring:   proctoring,
+
+		AccommodationUses: accommodationUses,
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handleExportTestResults выгружает завершенные попытки теста в CSV или XLSX.
+// ?questions=true добавляет столбцы с баллами по каждому вопросу.
+// Попытки читаются из базы и пишутся в ответ по одной.
+func (s *Server) handleExportTestResults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	format, delimiter, msg := parseExportParams(r)
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	withQuestions := false
+	if questionsStr := r.URL.Query().Get("questions"); questionsStr != "" {
+		withQuestions, err = strconv.ParseBool(questionsStr)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "questions must be true or false")
+			return
+		}
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+		return
+	}
+
+	scale, err := s.courseRepo.GetGradeScale(test.CourseID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var questions []models.ExportQuestion
+	if withQuestions {
+		questions, err = s.attemptRepo.GetExportQuestions(testID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	columns := []string{"Attempt ID", "Student", "Email", "Started at", "Completed at",
+		"Score", "Max score", "Percentage", "Grade"}
+	if test.PassingPercent != nil {
+		columns = append(columns, "Passed")
+	}
+	questionIDs := make([]int, len(questions))
+	for i, question := range questions {
+		questionIDs[i] = question.QuestionID
+		columns = append(columns, fmt.Sprintf("Q%d: %s", question.QuestionID, question.Title))
+	}
+
+	writer, err := startExport(w, format, delimiter, fmt.Sprintf("test-%d-results", testID), test.Title)
+	if err != nil {
+		log.Printf("Failed to export results of test %d: %v", testID, err)
+		return
+	}
+
+	// После начала выгрузки ответить ошибкой уже нельзя - файл просто обрывается
+	err = writer.WriteHeader(columns)
+	if err == nil {
+		err = s.attemptRepo.ExportTestResults(testID, questionIDs, func(row *models.ResultExportRow) error {
+			percentage, grade := repository.GradeScore(scale, row.Score, row.MaxScore)
+			values := []interface{}{row.AttemptID, row.FullName, row.Email, row.StartedAt, row.CompletedAt,
+				row.Score, row.MaxScore, percentage, grade}
+			if test.PassingPercent != nil {
+				var passed *bool
+				if percentage != nil {
+					p := *percentage >= *test.PassingPercent
+					passed = &p
+				}
+				values = append(values, passed)
+			}
+			for _, points := range row.Points {
+				values = append(values, points)
+			}
+			return writer.WriteRow(values)
+		})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		log.Printf("Failed to export results of test %d: %v", testID, err)
+	}
+}
+
+// parseExportParams разбирает ?format=csv|xlsx (по умолчанию csv) и
+// ?delimiter=comma|semicolon для CSV: Excel с русской локалью ждет точку с запятой
+func parseExportParams(r *http.Request) (string, rune, string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if !export.IsValidFormat(format) {
+		return "", 0, "format must be csv or xlsx"
+	}
+
+	delimiter := ','
+	switch r.URL.Query().Get("delimiter") {
+	case "", "comma":
+	case "semicolon":
+		delimiter = ';'
+	default:
+		return "", 0, "delimiter must be comma or semicolon"
+	}
+
+	return format, delimiter, ""
+}
+
+// startExport отправляет заголовки файла выгрузки и создает Writer поверх ответа
+func startExport(w http.ResponseWriter, format string, delimiter rune, filename, sheet string) (export.Writer, error) {
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	w.WriteHeader(http.StatusOK)
+	return export.NewWriter(format, w, sheet, delimiter)
+}
+
+// maxItemAnalysisTests - сколько тестов можно анализировать одним запросом
+const maxItemAnalysisTests = 20
+
+// handleGetItemAnalysis - анализ вопросов по завершенным попыткам теста
+// или нескольких тестов (?test_ids=1,2,3), например разных вариантов одного экзамена
+func (s *Server) handleGetItemAnalysis(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	rawIDs := mux.Vars(r)["test_id"]
+	if rawIDs == "" {
+		rawIDs = r.URL.Query().Get("test_ids")
+	}
+	if rawIDs == "" {
+		respondWithError(w, http.StatusBadRequest, "test_ids is required")
 		return
 	}
 
-	if test.QuestionsCount == 0 {
-		respondWithError(w, http.StatusBadRequest, "Cannot activate test without questions")
+	var testIDs []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(rawIDs, ",") {
+		testID, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+			return
+		}
+		if !seen[testID] {
+			seen[testID] = true
+			testIDs = append(testIDs, testID)
+		}
+	}
+
+	if len(testIDs) > maxItemAnalysisTests {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d tests can be analyzed at once", maxItemAnalysisTests))
 		return
 	}
 
-	if err := s.testRepo.SetActive(testID, true); err != nil {
+	for _, testID := range testIDs {
+		test, err := s.testRepo.GetByID(testID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if test == nil {
+			respondWithError(w, http.StatusNotFound, fmt.Sprintf("Test %d not found", testID))
+			return
+		}
+
+		if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+			respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+			return
+		}
+	}
+
+	report, err := s.attemptRepo.GetItemAnalysis(testIDs)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	notificationData := map[string]interface{}{
-		"test_id":    testID,
-		"test_title": test.Title,
-		"course_id":  test.CourseID,
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// handleGetCollusionReport ищет пары студентов с неслучайно совпадающими
+// неверными ответами в завершенных попытках теста.
+// ?min_shared_errors= - минимум одинаковых ошибок в паре,
+// ?max_probability= - порог вероятности случайного совпадения
+func (s *Server) handleGetCollusionReport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
 	}
 
-	s.createNotification(
-		test.TeacherID,
-		"test_activated",
-		"Тест активирован",
-		fmt.Sprintf("Тест '%s' был активирован", test.Title),
-		notificationData,
-	)
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Test activated successfully",
-		"test_id": strconv.Itoa(testID),
+	minSharedErrors := repository.DefaultMinSharedErrors
+	if value := r.URL.Query().Get("min_shared_errors"); value != "" {
+		minSharedErrors, err = strconv.Atoi(value)
+		if err != nil || minSharedErrors < 1 {
+			respondWithError(w, http.StatusBadRequest, "min_shared_errors must be a positive integer")
+			return
+		}
+	}
+
+	maxProbability := repository.DefaultCollusionProbability
+	if value := r.URL.Query().Get("max_probability"); value != "" {
+		maxProbability, err = strconv.ParseFloat(value, 64)
+		if err != nil || maxProbability <= 0 || maxProbability > 1 {
+			respondWithError(w, http.StatusBadRequest, "max_probability must be greater than 0 and at most 1")
+			return
+		}
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+		return
+	}
+
+	report, err := s.attemptRepo.GetCollusionReport(testID, minSharedErrors, maxProbability)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// handleGetTestTiming сводит по вопросам теста время ответа и изменения ответов,
+// в том числе с верного на неверный
+func (s *Server) handleGetTestTiming(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+		return
+	}
+
+	report, err := s.attemptRepo.GetTestTiming(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// handleGetMyCertificates возвращает сертификаты текущего пользователя
+func (s *Server) handleGetMyCertificates(w http.ResponseWriter, r *http.Request) {
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	certificates, err := s.attemptRepo.GetUserCertificates(userClaims.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if certificates == nil {
+		certificates = []models.Certificate{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"certificates": certificates,
+		"count":        len(certificates),
 	})
 }
 
-func (s *Server) handleGetCourseTests(w http.ResponseWriter, r *http.Request) {
+// handleDownloadCertificate отдает PDF сертификата владельцу или преподавателю теста
+func (s *Server) handleDownloadCertificate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	certificateID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid certificate ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	certificate, err := s.attemptRepo.GetCertificate(certificateID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if certificate == nil {
+		respondWithError(w, http.StatusNotFound, "Certificate not found")
+		return
+	}
+
+	if certificate.UserID != userClaims.UserID {
+		test, err := s.testRepo.GetByID(certificate.TestID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if test == nil || !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:student:read", "course:student:read:own") {
+			respondWithError(w, http.StatusForbidden, "You don't have permission to download this certificate")
+			return
+		}
+	}
+
+	pdf, err := s.attemptRepo.GetCertificatePDF(certificateID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="certificate-%s.pdf"`, certificate.VerificationCode))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// handleVerifyCertificate - публичная проверка сертификата по коду
+func (s *Server) handleVerifyCertificate(w http.ResponseWriter, r *http.Request) {
+	code := strings.ToUpper(strings.TrimSpace(mux.Vars(r)["code"]))
+
+	certificate, err := s.attemptRepo.GetCertificateByCode(code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if certificate == nil {
+		respondWithJSON(w, http.StatusNotFound, map[string]interface{}{
+			"valid": false,
+			"error": "Certificate not found",
+		})
+		return
+	}
+
+	// Внутренние ID наружу не отдаем
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":             certificate.RevokedAt == nil,
+		"revoked_at":        certificate.RevokedAt,
+		"verification_code": certificate.VerificationCode,
+		"student_name":      certificate.StudentName,
+		"test_title":        certificate.TestTitle,
+		"course_name":       certificate.CourseName,
+		"percentage":        certificate.Percentage,
+		"passing_percent":   certificate.PassingPercent,
+		"issued_at":         certificate.IssuedAt,
+	})
+}
+
+func (s *Server) handleGetQuestionOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["test_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// Получаем информацию о тесте
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	// Проверяем права на просмотр теста
+	canView := false
+
+	// Админ может видеть все
+	if auth.HasPermission(userClaims, "course:test:write") {
+		canView = true
+	} else if auth.HasPermission(userClaims, "course:test:write:own") {
+		// Преподаватель может видеть только свои тесты
+		if test.TeacherID == userClaims.UserID {
+			canView = true
+		}
+	}
+
+	if !canView {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view this test")
+		return
+	}
+
+	// Получаем порядок вопросов
+	questionOrder, err := s.testRepo.GetQuestionOrder(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"test_id":      testID,
+		"question_ids": questionOrder, // Изменили поле на question_ids
+		"count":        len(questionOrder),
+	})
+}
+
+// handleUpdateQuestionOrder обновляет порядок вопросов в тесте
+func (s *Server) handleUpdateQuestionOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	courseID, err := strconv.Atoi(vars["id"])
+	testID, err := strconv.Atoi(vars["test_id"])
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid course ID")
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
 		return
 	}
 
@@ -1456,67 +4499,100 @@ func (s *Server) handleGetCourseTests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	course, err := s.courseRepo.GetByID(courseID)
+	// Получаем информацию о тесте
+	test, err := s.testRepo.GetByID(testID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if course == nil {
-		respondWithError(w, http.StatusNotFound, "Course not found")
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
 		return
 	}
 
-	canView := false
+	// Проверяем права на изменение теста
+	if !s.canModifyCourse(userClaims, &models.Course{
+		ID:        test.CourseID,
+		TeacherID: test.TeacherID,
+	}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this test")
+		return
+	}
 
-	// Админ может видеть все
-	if auth.HasPermission(userClaims, "course:testList:read") {
-		canView = true
-	} else if auth.HasPermission(userClaims, "course:testList:own") {
-		if course.TeacherID == userClaims.UserID {
-			canView = true
-		}
-	} else if auth.HasPermission(userClaims, "course:testList:enrolled") {
-		enrolled, err := s.courseRepo.IsStudentEnrolled(courseID, userClaims.UserID)
-		if err == nil && enrolled {
-			canView = true
-		}
+	// Проверяем, что тест не активен
+	if test.IsActive {
+		respondWithError(w, http.StatusBadRequest, "Cannot modify order of questions in active test")
+		return
 	}
 
-	if !canView {
-		respondWithError(w, http.StatusForbidden, "You don't have permission to view tests for this course")
+	var request struct {
+		QuestionIDs []int `json:"question_ids"` // Изменили поле на question_ids
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 
-	tests, err := s.testRepo.GetByCourseID(courseID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	// Проверяем, что массив не пустой
+	if len(request.QuestionIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Question IDs array cannot be empty")
 		return
 	}
 
-	if auth.HasPermission(userClaims, "course:testList:enrolled") {
-		var activeTests []models.Test
-		for _, test := range tests {
-			if test.IsActive && !test.IsDeleted {
-				activeTests = append(activeTests, test)
-			}
+	// Проверяем уникальность ID вопросов
+	questionSet := make(map[int]bool)
+	for _, id := range request.QuestionIDs {
+		if questionSet[id] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate question ID: %d", id))
+			return
 		}
-		tests = activeTests
-	} else {
-		var filteredTests []models.Test
-		for _, test := range tests {
-			if !test.IsDeleted {
-				filteredTests = append(filteredTests, test)
-			}
+		questionSet[id] = true
+	}
+
+	// Проверяем, что все вопросы существуют и принадлежат преподавателю
+	for _, questionID := range request.QuestionIDs {
+		question, err := s.questionRepo.GetByID(questionID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if question == nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Question with ID %d not found", questionID))
+			return
+		}
+
+		// Проверяем права на использование вопроса
+		if !s.canModifyQuestion(userClaims, question) {
+			respondWithError(w, http.StatusForbidden,
+				fmt.Sprintf("You don't have permission to use question with ID %d", questionID))
+			return
 		}
-		tests = filteredTests
 	}
 
-	respondWithJSON(w, http.StatusOK, tests)
+	// Обновляем порядок
+	if err := s.testRepo.UpdateQuestionOrder(testID, request.QuestionIDs); err != nil {
+		if strings.Contains(err.Error(), "cannot modify order") {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		} else if strings.Contains(err.Error(), "question with id") {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Question order updated successfully",
+		"test_id": strconv.Itoa(testID),
+	})
 }
 
-func (s *Server) handleDeactivateTest(w http.ResponseWriter, r *http.Request) {
+// handleGetQuestionWeights возвращает настройки начисления баллов теста:
+// штраф за неверный ответ, ограничение нулем и переопределенные веса.
+func (s *Server) handleGetQuestionWeights(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	testID, err := strconv.Atoi(vars["id"])
+	testID, err := strconv.Atoi(vars["test_id"])
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
 		return
@@ -1538,55 +4614,32 @@ func (s *Server) handleDeactivateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	canDeactivate := false
-	if auth.HasPermission(userClaims, "test:activate:manage") {
-		canDeactivate = true // Админ может деактивировать любой тест
-	} else if auth.HasPermission(userClaims, "test:activate:manage:own") {
-		if test.TeacherID == userClaims.UserID {
-			canDeactivate = true
-		}
-	}
-
-	if !canDeactivate {
-		respondWithError(w, http.StatusForbidden, "You don't have permission to deactivate this test")
-		return
-	}
-
-	if !test.IsActive {
-		respondWithError(w, http.StatusBadRequest, "Test is already deactivated")
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to view this test")
 		return
 	}
 
-	if err := s.testRepo.SetActive(testID, false); err != nil {
+	weights, err := s.testRepo.GetQuestionWeights(testID)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if err := s.attemptRepo.CompleteAllAttemptsForTest(testID); err != nil {
-		log.Printf("Warning: Failed to complete attempts for deactivated test %d: %v", testID, err)
-	}
-
-	notificationData := map[string]interface{}{
-		"test_id":    testID,
-		"test_title": test.Title,
-		"course_id":  test.CourseID,
+	if weights == nil {
+		weights = []models.TestQuestionWeight{}
 	}
 
-	s.createNotification(
-		test.TeacherID,
-		"test_deactivated",
-		"Тест деактивирован",
-		fmt.Sprintf("Тест '%s' был деактивирован", test.Title),
-		notificationData,
-	)
-
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Test deactivated successfully",
-		"test_id": strconv.Itoa(testID),
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"test_id":              testID,
+		"wrong_answer_penalty": test.WrongAnswerPenalty,
+		"clamp_at_zero":        test.ClampAtZero,
+		"weights":              weights,
 	})
 }
 
-func (s *Server) handleGetTestResults(w http.ResponseWriter, r *http.Request) {
+// handleUpdateQuestionWeights задает веса вопросов в тесте. Вопросы без
+// переопределения оцениваются по своим questions.points.
+func (s *Server) handleUpdateQuestionWeights(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["test_id"])
 	if err != nil {
@@ -1610,55 +4663,84 @@ func (s *Server) handleGetTestResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "test:answer:read", "test:answer:read") {
-		respondWithError(w, http.StatusForbidden, "You don't have permission to view test results")
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this test")
 		return
 	}
 
-	attempts, err := s.attemptRepo.GetTestResults(testID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	if test.IsActive {
+		respondWithError(w, http.StatusBadRequest, "Cannot modify question weights of active test")
 		return
 	}
 
-	type ResultResponse struct {
-		UserID    int      `json:"user_id"`
-		Score     *float64 `json:"score,omitempty"`
-		StartedAt string   `json:"started_at"`
-		Completed string   `json:"completed,omitempty"`
+	var request struct {
+		Weights []models.TestQuestionWeight `json:"weights"`
 	}
 
-	type TestResultsResponse struct {
-		TestID  int              `json:"test_id"`
-		Results []ResultResponse `json:"results"`
-		Count   int              `json:"count"`
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
 	}
 
-	results := make([]ResultResponse, len(attempts))
-	for i, a := range attempts {
-		completed := ""
-		if a.CompletedAt != nil {
-			completed = a.CompletedAt.Format(time.RFC3339)
+	seen := make(map[int]bool)
+	for _, weight := range request.Weights {
+		if seen[weight.QuestionID] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate question ID: %d", weight.QuestionID))
+			return
 		}
+		seen[weight.QuestionID] = true
 
-		results[i] = ResultResponse{
-			UserID:    a.UserID,
-			Score:     a.Score,
-			StartedAt: a.StartedAt.Format(time.RFC3339),
-			Completed: completed,
+		if weight.Weight <= 0 {
+			respondWithError(w, http.StatusBadRequest, "weight must be positive")
+			return
+		}
+
+		question, err := s.questionRepo.GetByID(weight.QuestionID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if question == nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Question with ID %d not found", weight.QuestionID))
+			return
 		}
 	}
 
-	response := TestResultsResponse{
-		TestID:  testID,
-		Results: results,
-		Count:   len(results),
+	if err := s.testRepo.SetQuestionWeights(testID, request.Weights); err != nil {
+		if testErr, ok := err.(*repository.TestError); ok {
+			respondWithError(w, http.StatusBadRequest, testErr.Message)
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
 	}
 
-	respondWithJSON(w, http.StatusOK, response)
+	if request.Weights == nil {
+		request.Weights = []models.TestQuestionWeight{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"test_id": testID,
+		"weights": request.Weights,
+	})
 }
 
-func (s *Server) handleGetQuestionOrder(w http.ResponseWriter, r *http.Request) {
+// normalizeTags приводит теги к нижнему регистру, убирает пустые и повторы
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+func (s *Server) handleGetPoolRules(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["test_id"])
 	if err != nil {
@@ -1672,7 +4754,6 @@ func (s *Server) handleGetQuestionOrder(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Получаем информацию о тесте
 	test, err := s.testRepo.GetByID(testID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -1683,40 +4764,30 @@ func (s *Server) handleGetQuestionOrder(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Проверяем права на просмотр теста
-	canView := false
-
-	// Админ может видеть все
-	if auth.HasPermission(userClaims, "course:test:write") {
-		canView = true
-	} else if auth.HasPermission(userClaims, "course:test:write:own") {
-		// Преподаватель может видеть только свои тесты
-		if test.TeacherID == userClaims.UserID {
-			canView = true
-		}
-	}
-
-	if !canView {
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
 		respondWithError(w, http.StatusForbidden, "You don't have permission to view this test")
 		return
 	}
 
-	// Получаем порядок вопросов
-	questionOrder, err := s.testRepo.GetQuestionOrder(testID)
+	rules, err := s.testRepo.GetPoolRules(testID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if rules == nil {
+		rules = []models.TestPoolRule{}
+	}
+
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"test_id":      testID,
-		"question_ids": questionOrder, // Изменили поле на question_ids
-		"count":        len(questionOrder),
+		"test_id": testID,
+		"rules":   rules,
 	})
 }
 
-// handleUpdateQuestionOrder обновляет порядок вопросов в тесте
-func (s *Server) handleUpdateQuestionOrder(w http.ResponseWriter, r *http.Request) {
+// handleUpdatePoolRules задает правила случайного набора вопросов вида
+// "N вопросов с тегом X". Пустой список возвращает тест к фиксированному набору.
+func (s *Server) handleUpdatePoolRules(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	testID, err := strconv.Atoi(vars["test_id"])
 	if err != nil {
@@ -1730,7 +4801,6 @@ func (s *Server) handleUpdateQuestionOrder(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Получаем информацию о тесте
 	test, err := s.testRepo.GetByID(testID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -1741,81 +4811,60 @@ func (s *Server) handleUpdateQuestionOrder(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Проверяем права на изменение теста
-	if !s.canModifyCourse(userClaims, &models.Course{
-		ID:        test.CourseID,
-		TeacherID: test.TeacherID,
-	}, "course:test:write", "course:test:write:own") {
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
 		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this test")
 		return
 	}
 
-	// Проверяем, что тест не активен
 	if test.IsActive {
-		respondWithError(w, http.StatusBadRequest, "Cannot modify order of questions in active test")
-		return
-	}
-
-	var request struct {
-		QuestionIDs []int `json:"question_ids"` // Изменили поле на question_ids
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-
-	// Проверяем, что массив не пустой
-	if len(request.QuestionIDs) == 0 {
-		respondWithError(w, http.StatusBadRequest, "Question IDs array cannot be empty")
+		respondWithError(w, http.StatusBadRequest, "Cannot modify question pools of active test")
 		return
 	}
 
-	// Проверяем уникальность ID вопросов
-	questionSet := make(map[int]bool)
-	for _, id := range request.QuestionIDs {
-		if questionSet[id] {
-			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate question ID: %d", id))
-			return
-		}
-		questionSet[id] = true
+	var request struct {
+		Rules []models.TestPoolRule `json:"rules"`
 	}
 
-	// Проверяем, что все вопросы существуют и принадлежат преподавателю
-	for _, questionID := range request.QuestionIDs {
-		question, err := s.questionRepo.GetByID(questionID)
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, err.Error())
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i := range request.Rules {
+		rule := &request.Rules[i]
+		rule.Tag = strings.ToLower(strings.TrimSpace(rule.Tag))
+		if rule.Tag == "" {
+			respondWithError(w, http.StatusBadRequest, "tag is required")
 			return
 		}
-		if question == nil {
-			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Question with ID %d not found", questionID))
+		if seen[rule.Tag] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate rule for tag: %s", rule.Tag))
 			return
 		}
-
-		// Проверяем права на использование вопроса
-		if !s.canModifyQuestion(userClaims, question) {
-			respondWithError(w, http.StatusForbidden,
-				fmt.Sprintf("You don't have permission to use question with ID %d", questionID))
+		seen[rule.Tag] = true
+		if rule.QuestionCount <= 0 {
+			respondWithError(w, http.StatusBadRequest, "question_count must be positive")
 			return
 		}
 	}
 
-	// Обновляем порядок
-	if err := s.testRepo.UpdateQuestionOrder(testID, request.QuestionIDs); err != nil {
-		if strings.Contains(err.Error(), "cannot modify order") {
-			respondWithError(w, http.StatusBadRequest, err.Error())
-		} else if strings.Contains(err.Error(), "question with id") {
-			respondWithError(w, http.StatusBadRequest, err.Error())
+	if err := s.testRepo.SetPoolRules(testID, request.Rules); err != nil {
+		if testErr, ok := err.(*repository.TestError); ok {
+			respondWithError(w, http.StatusBadRequest, testErr.Message)
 		} else {
 			respondWithError(w, http.StatusInternalServerError, err.Error())
 		}
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{
-		"message": "Question order updated successfully",
-		"test_id": strconv.Itoa(testID),
+	if request.Rules == nil {
+		request.Rules = []models.TestPoolRule{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"test_id": testID,
+		"rules":   request.Rules,
 	})
 }
 
@@ -1835,10 +4884,23 @@ func (s *Server) handleCreateQuestion(w http.ResponseWriter, r *http.Request) {
 	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	var request struct {
-		Text          string   `json:"text"`
-		Options       []string `json:"options"`
-		CorrectOption int      `json:"correct_option"`
-		Points        int      `json:"points"`
+		Text            string   `json:"text"`
+		QuestionType    string   `json:"question_type"`
+		Options         []string `json:"options"`
+		CorrectOption   int      `json:"correct_option"`
+		CorrectOptions  []int    `json:"correct_options"`
+		Points          int      `json:"points"`
+		AcceptedAnswers []string `json:"accepted_answers"`
+		CaseSensitive   bool     `json:"case_sensitive"`
+		NormalizeSpaces *bool    `json:"normalize_spaces"`
+		UseRegex        bool     `json:"use_regex"`
+		NumericAnswer   *float64 `json:"numeric_answer"`
+		Tolerance       float64  `json:"tolerance"`
+		ToleranceType   string   `json:"tolerance_type"`
+		Tags            []string `json:"tags"`
+
+		Explanation        string   `json:"explanation"`
+		OptionExplanations []string `json:"option_explanations"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -1851,18 +4913,42 @@ func (s *Server) handleCreateQuestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(request.Options) != 2 {
-		respondWithError(w, http.StatusBadRequest, "Exactly 2 options are required")
-		return
+	if request.QuestionType == "" {
+		request.QuestionType = models.QuestionTypeSingle
 	}
 
-	if request.Options[0] == "" || request.Options[1] == "" {
-		respondWithError(w, http.StatusBadRequest, "These 2 options must be non-empty")
-		return
-	}
+	switch request.QuestionType {
+	case models.QuestionTypeSingle:
+		if len(request.Options) != 2 {
+			respondWithError(w, http.StatusBadRequest, "Exactly 2 options are required")
+			return
+		}
+
+		if request.Options[0] == "" || request.Options[1] == "" {
+			respondWithError(w, http.StatusBadRequest, "These 2 options must be non-empty")
+			return
+		}
 
-	if request.CorrectOption != 0 && request.CorrectOption != 1 {
-		respondWithError(w, http.StatusBadRequest, "correct_option must be 0 or 1")
+		if request.CorrectOption != 0 && request.CorrectOption != 1 {
+			respondWithError(w, http.StatusBadRequest, "correct_option must be 0 or 1")
+			return
+		}
+		request.CorrectOptions = nil
+	case models.QuestionTypeMultiple:
+		if msg := validateMultipleChoice(request.Options, request.CorrectOptions); msg != "" {
+			respondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+		// correct_option для multiple не используется, но колонка NOT NULL
+		request.CorrectOption = 0
+	case models.QuestionTypeText, models.QuestionTypeNumeric, models.QuestionTypeEssay:
+		// варианты ответа не нужны: ответ проверяется по правилам ниже
+		// или вручную преподавателем (essay)
+		request.Options = []string{}
+		request.CorrectOption = 0
+		request.CorrectOptions = nil
+	default:
+		respondWithError(w, http.StatusBadRequest, "question_type must be single, multiple, text, numeric or essay")
 		return
 	}
 
@@ -1876,12 +4962,43 @@ func (s *Server) handleCreateQuestion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	question := &models.Question{
-		Title:         title,
-		Text:          request.Text,
-		Options:       request.Options,
-		CorrectOption: request.CorrectOption,
-		Points:        request.Points,
-		AuthorID:      userClaims.UserID,
+		Title:          title,
+		Text:           request.Text,
+		QuestionType:   request.QuestionType,
+		Options:        request.Options,
+		CorrectOption:  request.CorrectOption,
+		CorrectOptions: request.CorrectOptions,
+		Points:         request.Points,
+		AuthorID:       userClaims.UserID,
+		Tags:           normalizeTags(request.Tags),
+
+		Explanation:        strings.TrimSpace(request.Explanation),
+		OptionExplanations: request.OptionExplanations,
+	}
+
+	if msg := validateOptionExplanations(question); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	switch question.QuestionType {
+	case models.QuestionTypeText:
+		question.AcceptedAnswers = request.AcceptedAnswers
+		question.CaseSensitive = request.CaseSensitive
+		question.NormalizeSpaces = request.NormalizeSpaces == nil || *request.NormalizeSpaces
+		question.UseRegex = request.UseRegex
+	case models.QuestionTypeNumeric:
+		question.NumericAnswer = request.NumericAnswer
+		question.Tolerance = request.Tolerance
+		question.ToleranceType = request.ToleranceType
+		if question.ToleranceType == "" {
+			question.ToleranceType = models.ToleranceAbsolute
+		}
+	}
+
+	if msg := validateAnswerRules(question); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
 	}
 
 	if err := s.questionRepo.Create(question); err != nil {
@@ -1893,6 +5010,82 @@ func (s *Server) handleCreateQuestion(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusCreated, question)
 }
 
+// validateMultipleChoice проверяет варианты и ключ вопроса с несколькими правильными ответами.
+// Возвращает текст ошибки или пустую строку.
+func validateMultipleChoice(options []string, correctOptions []int) string {
+	if len(options) < 2 {
+		return "At least 2 options are required"
+	}
+
+	for _, option := range options {
+		if option == "" {
+			return "All options must be non-empty"
+		}
+	}
+
+	if len(correctOptions) == 0 {
+		return "correct_options must contain at least one option"
+	}
+
+	seen := make(map[int]bool)
+	for _, option := range correctOptions {
+		if option < 0 || option >= len(options) {
+			return fmt.Sprintf("correct_options contains invalid option index: %d", option)
+		}
+		if seen[option] {
+			return fmt.Sprintf("Duplicate option in correct_options: %d", option)
+		}
+		seen[option] = true
+	}
+
+	return ""
+}
+
+// validateAnswerRules проверяет правила автопроверки текстовых и числовых вопросов.
+// Возвращает текст ошибки или пустую строку.
+// validateOptionExplanations проверяет, что пояснения заданы по одному на каждый вариант ответа.
+// Пустой список допустим - пояснений к вариантам нет.
+func validateOptionExplanations(question *models.Question) string {
+	if len(question.OptionExplanations) == 0 {
+		question.OptionExplanations = nil
+		return ""
+	}
+	if len(question.OptionExplanations) != len(question.Options) {
+		return "option_explanations must contain one entry per option"
+	}
+	return ""
+}
+
+func validateAnswerRules(question *models.Question) string {
+	switch question.QuestionType {
+	case models.QuestionTypeText:
+		if len(question.AcceptedAnswers) == 0 {
+			return "accepted_answers must contain at least one answer"
+		}
+		for _, accepted := range question.AcceptedAnswers {
+			if strings.TrimSpace(accepted) == "" {
+				return "accepted_answers must be non-empty"
+			}
+		}
+		if question.UseRegex {
+			if err := repository.ValidateTextPatterns(question); err != nil {
+				return err.Error()
+			}
+		}
+	case models.QuestionTypeNumeric:
+		if question.NumericAnswer == nil {
+			return "numeric_answer is required"
+		}
+		if question.Tolerance < 0 {
+			return "tolerance must not be negative"
+		}
+		if question.ToleranceType != models.ToleranceAbsolute && question.ToleranceType != models.ToleranceRelative {
+			return "tolerance_type must be absolute or relative"
+		}
+	}
+	return ""
+}
+
 func (s *Server) handleGetQuestion(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	questionID, err := strconv.Atoi(vars["id"])
@@ -1919,20 +5112,26 @@ func (s *Server) handleGetQuestion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !s.canViewQuestion(userClaims, question) {
-		response := map[string]interface{}{
-			"id":      question.ID,
-			"title":   question.Title,
-			"text":    question.Text,
-			"options": question.Options,
-			"points":  question.Points,
-		}
-		respondWithJSON(w, http.StatusOK, response)
+		respondWithJSON(w, http.StatusOK, studentQuestionView(question))
 		return
 	}
 
 	respondWithJSON(w, http.StatusOK, question)
 }
 
+// studentQuestionView - вопрос без ключа ответа, в том виде, в каком его видит студент
+func studentQuestionView(question *models.Question) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            question.ID,
+		"version":       question.Version,
+		"title":         question.Title,
+		"text":          question.Text,
+		"question_type": question.QuestionType,
+		"options":       question.Options,
+		"points":        question.Points,
+	}
+}
+
 func (s *Server) handleCreateTest(w http.ResponseWriter, r *http.Request) {
 	userClaims, ok := r.Context().Value("user").(*auth.Claims)
 	if !ok {
@@ -1957,6 +5156,56 @@ func (s *Server) handleCreateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if test.DurationMinutes != nil && *test.DurationMinutes <= 0 {
+		respondWithError(w, http.StatusBadRequest, "duration_minutes must be positive")
+		return
+	}
+
+	if test.ScoringMode != "" && !repository.IsValidScoringMode(test.ScoringMode) {
+		respondWithError(w, http.StatusBadRequest, "scoring_mode must be all_or_nothing, proportional or proportional_penalty")
+		return
+	}
+
+	if test.MaxAttempts != nil && *test.MaxAttempts <= 0 {
+		respondWithError(w, http.StatusBadRequest, "max_attempts must be positive")
+		return
+	}
+
+	if test.CooldownMinutes != nil && *test.CooldownMinutes <= 0 {
+		respondWithError(w, http.StatusBadRequest, "cooldown_minutes must be positive")
+		return
+	}
+
+	if test.ScorePolicy != "" && !repository.IsValidScorePolicy(test.ScorePolicy) {
+		respondWithError(w, http.StatusBadRequest, "score_policy must be best, last, first or average")
+		return
+	}
+
+	if test.ReviewContent != "" && !repository.IsValidReviewContent(test.ReviewContent) {
+		respondWithError(w, http.StatusBadRequest, "review_content must be score_only, correct_answers or full")
+		return
+	}
+
+	if test.ReviewAvailability != "" && !repository.IsValidReviewAvailability(test.ReviewAvailability) {
+		respondWithError(w, http.StatusBadRequest, "review_availability must be immediate or after_close")
+		return
+	}
+
+	if msg := normalizeSchedule(&test); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if test.WrongAnswerPenalty < 0 || test.WrongAnswerPenalty > 1 {
+		respondWithError(w, http.StatusBadRequest, "wrong_answer_penalty must be between 0 and 1")
+		return
+	}
+
+	if test.PassingPercent != nil && (*test.PassingPercent <= 0 || *test.PassingPercent > 100) {
+		respondWithError(w, http.StatusBadRequest, "passing_percent must be greater than 0 and at most 100")
+		return
+	}
+
 	course, err := s.courseRepo.GetByID(test.CourseID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -2021,6 +5270,233 @@ func (s *Server) handleGetTest(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusOK, test)
 }
 
+// handleUpdateTest обновляет название, описание и настройки теста.
+// Новый лимит времени применяется только к попыткам, начатым после изменения.
+func (s *Server) handleUpdateTest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	testID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid test ID")
+		return
+	}
+
+	userClaims, ok := r.Context().Value("user").(*auth.Claims)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	test, err := s.testRepo.GetByID(testID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if test == nil {
+		respondWithError(w, http.StatusNotFound, "Test not found")
+		return
+	}
+
+	if !s.canModifyCourse(userClaims, &models.Course{ID: test.CourseID, TeacherID: test.TeacherID}, "course:test:write", "course:test:write:own") {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to edit this test")
+		return
+	}
+
+	var updates struct {
+		Title              string   `json:"title"`
+		Description        string   `json:"description"`
+		DurationMinutes    *int     `json:"duration_minutes"`
+		ScoringMode        string   `json:"scoring_mode"`
+		MaxAttempts        *int     `json:"max_attempts"`
+		CooldownMinutes    *int     `json:"cooldown_minutes"`
+		ScorePolicy        string   `json:"score_policy"`
+		ShuffleQuestions   *bool    `json:"shuffle_questions"`
+		ShuffleOptions     *bool    `json:"shuffle_options"`
+		OpensAt            *string  `json:"opens_at"`  // RFC3339, "" снимает расписание
+		ClosesAt           *string  `json:"closes_at"` // RFC3339, "" снимает расписание
+		WrongAnswerPenalty *float64 `json:"wrong_answer_penalty"`
+		ClampAtZero        *bool    `json:"clamp_at_zero"`
+		ReviewContent      string   `json:"review_content"`
+		ReviewAvailability string   `json:"review_availability"`
+		PassingPercent     *float64 `json:"passing_percent"` // 0 снимает порог
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if updates.Title != "" {
+		test.Title = updates.Title
+	}
+	if updates.Description != "" {
+		test.Description = updates.Description
+	}
+
+	// 0 снимает ограничение по времени
+	if updates.DurationMinutes != nil {
+		if *updates.DurationMinutes < 0 {
+			respondWithError(w, http.StatusBadRequest, "duration_minutes must not be negative")
+			return
+		}
+		if *updates.DurationMinutes == 0 {
+			test.DurationMinutes = nil
+		} else {
+			test.DurationMinutes = updates.DurationMinutes
+		}
+	}
+
+	if updates.ScoringMode != "" {
+		if !repository.IsValidScoringMode(updates.ScoringMode) {
+			respondWithError(w, http.StatusBadRequest, "scoring_mode must be all_or_nothing, proportional or proportional_penalty")
+			return
+		}
+		test.ScoringMode = updates.ScoringMode
+	}
+
+	// 0 снимает ограничение числа попыток
+	if updates.MaxAttempts != nil {
+		if *updates.MaxAttempts < 0 {
+			respondWithError(w, http.StatusBadRequest, "max_attempts must not be negative")
+			return
+		}
+		if *updates.MaxAttempts == 0 {
+			test.MaxAttempts = nil
+		} else {
+			test.MaxAttempts = updates.MaxAttempts
+		}
+	}
+
+	// 0 убирает паузу между попытками
+	if updates.CooldownMinutes != nil {
+		if *updates.CooldownMinutes < 0 {
+			respondWithError(w, http.StatusBadRequest, "cooldown_minutes must not be negative")
+			return
+		}
+		if *updates.CooldownMinutes == 0 {
+			test.CooldownMinutes = nil
+		} else {
+			test.CooldownMinutes = updates.CooldownMinutes
+		}
+	}
+
+	if updates.ScorePolicy != "" {
+		if !repository.IsValidScorePolicy(updates.ScorePolicy) {
+			respondWithError(w, http.StatusBadRequest, "score_policy must be best, last, first or average")
+			return
+		}
+		test.ScorePolicy = updates.ScorePolicy
+	}
+
+	if updates.ReviewContent != "" {
+		if !repository.IsValidReviewContent(updates.ReviewContent) {
+			respondWithError(w, http.StatusBadRequest, "review_content must be score_only, correct_answers or full")
+			return
+		}
+		test.ReviewContent = updates.ReviewContent
+	}
+
+	if updates.ReviewAvailability != "" {
+		if !repository.IsValidReviewAvailability(updates.ReviewAvailability) {
+			respondWithError(w, http.StatusBadRequest, "review_availability must be immediate or after_close")
+			return
+		}
+		test.ReviewAvailability = updates.ReviewAvailability
+	}
+
+	// Перемешивание применяется к попыткам, начатым после изменения
+	if updates.ShuffleQuestions != nil {
+		test.ShuffleQuestions = *updates.ShuffleQuestions
+	}
+	if updates.ShuffleOptions != nil {
+		test.ShuffleOptions = *updates.ShuffleOptions
+	}
+
+	if updates.OpensAt != nil {
+		opensAt, err := parseScheduleTime(*updates.OpensAt)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "opens_at must be in RFC3339 format")
+			return
+		}
+		test.OpensAt = opensAt
+	}
+	if updates.ClosesAt != nil {
+		closesAt, err := parseScheduleTime(*updates.ClosesAt)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "closes_at must be in RFC3339 format")
+			return
+		}
+		test.ClosesAt = closesAt
+	}
+	if msg := normalizeSchedule(test); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if updates.WrongAnswerPenalty != nil {
+		if *updates.WrongAnswerPenalty < 0 || *updates.WrongAnswerPenalty > 1 {
+			respondWithError(w, http.StatusBadRequest, "wrong_answer_penalty must be between 0 and 1")
+			return
+		}
+		test.WrongAnswerPenalty = *updates.WrongAnswerPenalty
+	}
+	if updates.ClampAtZero != nil {
+		test.ClampAtZero = *updates.ClampAtZero
+	}
+
+	// Новый порог действует для следующих завершений, выданные сертификаты остаются
+	if updates.PassingPercent != nil {
+		if *updates.PassingPercent < 0 || *updates.PassingPercent > 100 {
+			respondWithError(w, http.StatusBadRequest, "passing_percent must be between 0 and 100")
+			return
+		}
+		if *updates.PassingPercent == 0 {
+			test.PassingPercent = nil
+		} else {
+			test.PassingPercent = updates.PassingPercent
+		}
+	}
+
+	if err := s.testRepo.Update(test); err != nil {
+		if err == sql.ErrNoRows {
+			respondWithError(w, http.StatusNotFound, "Test not found")
+		} else {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, test)
+}
+
+// parseScheduleTime разбирает время расписания, пустая строка - без расписания
+func parseScheduleTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// normalizeSchedule приводит время расписания к UTC (в БД TIMESTAMP без зоны,
+// сравнивается с CURRENT_TIMESTAMP) и проверяет, что тест закрывается после открытия
+func normalizeSchedule(test *models.Test) string {
+	if test.OpensAt != nil {
+		opensAt := test.OpensAt.UTC()
+		test.OpensAt = &opensAt
+	}
+	if test.ClosesAt != nil {
+		closesAt := test.ClosesAt.UTC()
+		test.ClosesAt = &closesAt
+	}
+	if test.OpensAt != nil && test.ClosesAt != nil && !test.ClosesAt.After(*test.OpensAt) {
+		return "closes_at must be after opens_at"
+	}
+	return ""
+}
+
 func (s *Server) handleGetTests(w http.ResponseWriter, r *http.Request) {
 	userClaims, ok := r.Context().Value("user").(*auth.Claims)
 	if !ok {
@@ -2154,11 +5630,23 @@ func (s *Server) handleUpdateQuestion(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var updates struct {
-		Title         string   `json:"title"`
-		Text          string   `json:"text"`
-		Options       []string `json:"options"`
-		CorrectOption int      `json:"correct_option"`
-		Points        int      `json:"points"`
+		Title           string   `json:"title"`
+		Text            string   `json:"text"`
+		Options         []string `json:"options"`
+		CorrectOption   int      `json:"correct_option"`
+		CorrectOptions  []int    `json:"correct_options"`
+		Points          int      `json:"points"`
+		AcceptedAnswers []string `json:"accepted_answers"`
+		CaseSensitive   *bool    `json:"case_sensitive"`
+		NormalizeSpaces *bool    `json:"normalize_spaces"`
+		UseRegex        *bool    `json:"use_regex"`
+		NumericAnswer   *float64 `json:"numeric_answer"`
+		Tolerance       *float64 `json:"tolerance"`
+		ToleranceType   string   `json:"tolerance_type"`
+		Tags            []string `json:"tags"`
+
+		Explanation        *string  `json:"explanation"`         // "" убирает пояснение
+		OptionExplanations []string `json:"option_explanations"` // [] убирает пояснения к вариантам
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
@@ -2169,33 +5657,91 @@ func (s *Server) handleUpdateQuestion(w http.ResponseWriter, r *http.Request) {
 	if updates.Title != "" {
 		existingQuestion.Title = updates.Title
 	}
+	// tags: [] очищает теги, отсутствие поля оставляет их без изменений
+	if updates.Tags != nil {
+		existingQuestion.Tags = normalizeTags(updates.Tags)
+	}
 	if updates.Text != "" {
 		existingQuestion.Text = updates.Text
 	}
 
-	if len(updates.Options) > 0 {
-		if len(updates.Options) != 2 {
-			respondWithError(w, http.StatusBadRequest, "Exactly 2 options are required")
+	// Тип вопроса не меняется, обновляются только варианты и правила проверки
+	switch existingQuestion.QuestionType {
+	case models.QuestionTypeMultiple:
+		if len(updates.Options) > 0 {
+			existingQuestion.Options = updates.Options
+		}
+		if len(updates.CorrectOptions) > 0 {
+			existingQuestion.CorrectOptions = updates.CorrectOptions
+		}
+		if msg := validateMultipleChoice(existingQuestion.Options, existingQuestion.CorrectOptions); msg != "" {
+			respondWithError(w, http.StatusBadRequest, msg)
 			return
 		}
-		if updates.Options[0] == "" || updates.Options[1] == "" {
-			respondWithError(w, http.StatusBadRequest, "Both options must be non-empty")
+	case models.QuestionTypeEssay:
+		// у развернутого вопроса нет ключа, меняются только текст и баллы
+	case models.QuestionTypeText, models.QuestionTypeNumeric:
+		if len(updates.AcceptedAnswers) > 0 {
+			existingQuestion.AcceptedAnswers = updates.AcceptedAnswers
+		}
+		if updates.CaseSensitive != nil {
+			existingQuestion.CaseSensitive = *updates.CaseSensitive
+		}
+		if updates.NormalizeSpaces != nil {
+			existingQuestion.NormalizeSpaces = *updates.NormalizeSpaces
+		}
+		if updates.UseRegex != nil {
+			existingQuestion.UseRegex = *updates.UseRegex
+		}
+		if updates.NumericAnswer != nil {
+			existingQuestion.NumericAnswer = updates.NumericAnswer
+		}
+		if updates.Tolerance != nil {
+			existingQuestion.Tolerance = *updates.Tolerance
+		}
+		if updates.ToleranceType != "" {
+			existingQuestion.ToleranceType = updates.ToleranceType
+		}
+		if msg := validateAnswerRules(existingQuestion); msg != "" {
+			respondWithError(w, http.StatusBadRequest, msg)
 			return
 		}
-		existingQuestion.Options = updates.Options
-	}
+	default:
+		if len(updates.Options) > 0 {
+			if len(updates.Options) != 2 {
+				respondWithError(w, http.StatusBadRequest, "Exactly 2 options are required")
+				return
+			}
+			if updates.Options[0] == "" || updates.Options[1] == "" {
+				respondWithError(w, http.StatusBadRequest, "Both options must be non-empty")
+				return
+			}
+			existingQuestion.Options = updates.Options
+		}
 
-	if updates.CorrectOption == 0 || updates.CorrectOption == 1 {
-		existingQuestion.CorrectOption = updates.CorrectOption
-	} else if updates.CorrectOption != 0 && updates.CorrectOption != 1 && updates.CorrectOption != -1 {
-		respondWithError(w, http.StatusBadRequest, "correct_option must be 0 or 1")
-		return
+		if updates.CorrectOption == 0 || updates.CorrectOption == 1 {
+			existingQuestion.CorrectOption = updates.CorrectOption
+		} else if updates.CorrectOption != 0 && updates.CorrectOption != 1 && updates.CorrectOption != -1 {
+			respondWithError(w, http.StatusBadRequest, "correct_option must be 0 or 1")
+			return
+		}
 	}
 
 	if updates.Points > 0 {
 		existingQuestion.Points = updates.Points
 	}
 
+	if updates.Explanation != nil {
+		existingQuestion.Explanation = strings.TrimSpace(*updates.Explanation)
+	}
+	if updates.OptionExplanations != nil {
+		existingQuestion.OptionExplanations = updates.OptionExplanations
+	}
+	if msg := validateOptionExplanations(existingQuestion); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
 	if err := s.questionRepo.Update(existingQuestion); err != nil {
 		if err == sql.ErrNoRows {
 			respondWithError(w, http.StatusNotFound, "Question not found")
@@ -40,7 +40,7 @@ func main() {
 
 	log.Println("Подключено к базе данных")
 
-	srv := server.NewServer(db.DB)
+	srv := server.NewServer(db.DB, cfg.TrustedProxies)
 
 	log.Printf("Запускаем сервер на http://localhost%s", cfg.PortServer)
 	if err := srv.Start(cfg.PortServer); err != nil {
@@ -2,12 +2,30 @@
 SET session_replication_role = 'replica';
 
 -- Удаляем таблицы в правильном порядке (сначала зависимые)
+DROP TABLE IF EXISTS regrade_changes CASCADE;
+DROP TABLE IF EXISTS regrades CASCADE;
+DROP TABLE IF EXISTS certificates CASCADE;
+DROP TABLE IF EXISTS test_results CASCADE;
+DROP TABLE IF EXISTS attempt_events CASCADE;
+DROP TABLE IF EXISTS attempt_answer_history CASCADE;
 DROP TABLE IF EXISTS attempt_answers CASCADE;
+DROP TABLE IF EXISTS attempt_questions CASCADE;
 DROP TABLE IF EXISTS attempts CASCADE;
+DROP TABLE IF EXISTS student_accommodations CASCADE;
+DROP TABLE IF EXISTS attempt_start_denials CASCADE;
+DROP TABLE IF EXISTS test_access CASCADE;
+DROP TABLE IF EXISTS grade_category_tests CASCADE;
+DROP TABLE IF EXISTS test_pool_rules CASCADE;
+DROP TABLE IF EXISTS test_question_weights CASCADE;
 DROP TABLE IF EXISTS test_questions CASCADE;
+DROP TABLE IF EXISTS question_outcomes CASCADE;
 DROP TABLE IF EXISTS questions CASCADE;
 DROP SEQUENCE IF EXISTS questions_id_seq CASCADE;
 DROP TABLE IF EXISTS tests CASCADE;
+DROP TABLE IF EXISTS learning_outcomes CASCADE;
+DROP TABLE IF EXISTS grade_categories CASCADE;
+DROP TABLE IF EXISTS grade_scale_levels CASCADE;
+DROP TABLE IF EXISTS grade_scales CASCADE;
 DROP TABLE IF EXISTS course_enrollments CASCADE;
 DROP TABLE IF EXISTS courses CASCADE;
 DROP TABLE IF EXISTS user_roles CASCADE;
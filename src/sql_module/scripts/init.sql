@@ -34,6 +34,43 @@ CREATE TABLE IF NOT EXISTS course_enrollments (
     PRIMARY KEY (course_id, user_id)
 );
 
+-- Шкала оценок курса: оценка по процентным порогам
+CREATE TABLE IF NOT EXISTS grade_scales (
+    course_id INTEGER PRIMARY KEY REFERENCES courses(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS grade_scale_levels (
+    course_id INTEGER NOT NULL REFERENCES grade_scales(course_id) ON DELETE CASCADE,
+    grade VARCHAR(50) NOT NULL,
+    min_percent FLOAT NOT NULL CHECK (min_percent >= 0 AND min_percent <= 100), -- нижняя граница оценки
+    PRIMARY KEY (course_id, grade),
+    UNIQUE (course_id, min_percent)
+);
+
+-- Категории оценок курса (контрольные, домашние...) и их веса в итоговой оценке
+CREATE TABLE IF NOT EXISTS grade_categories (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    weight FLOAT NOT NULL CHECK (weight > 0),
+    UNIQUE (course_id, name)
+);
+
+-- Результаты обучения (навыки, темы) курса, по которым считается освоение
+CREATE TABLE IF NOT EXISTS learning_outcomes (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    code VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    mastery_threshold FLOAT NOT NULL DEFAULT 70
+        CHECK (mastery_threshold > 0 AND mastery_threshold <= 100), -- процент, с которого результат освоен
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (course_id, code)
+);
+
 -- Тесты
 CREATE TABLE IF NOT EXISTS tests (
     id SERIAL PRIMARY KEY,
@@ -43,6 +80,29 @@ CREATE TABLE IF NOT EXISTS tests (
     teacher_id INTEGER NOT NULL REFERENCES users(id),
     is_active BOOLEAN DEFAULT FALSE,
     is_deleted BOOLEAN DEFAULT FALSE,
+    duration_minutes INTEGER CHECK (duration_minutes > 0), -- NULL - без ограничения по времени
+    scoring_mode VARCHAR(30) NOT NULL DEFAULT 'all_or_nothing'
+        CHECK (scoring_mode IN ('all_or_nothing', 'proportional', 'proportional_penalty')),
+    max_attempts INTEGER CHECK (max_attempts > 0), -- NULL - без ограничения числа попыток
+    cooldown_minutes INTEGER CHECK (cooldown_minutes > 0), -- пауза между попытками
+    score_policy VARCHAR(10) NOT NULL DEFAULT 'best'
+        CHECK (score_policy IN ('best', 'last', 'first', 'average')),
+    shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE, -- перемешивать вопросы в каждой попытке
+    shuffle_options BOOLEAN NOT NULL DEFAULT FALSE, -- перемешивать варианты ответа в каждой попытке
+    -- расписание доступности (время в UTC)
+    opens_at TIMESTAMP,
+    closes_at TIMESTAMP,
+    auto_opened_at TIMESTAMP, -- когда планировщик открыл тест, NULL - еще не открывал
+    auto_closed_at TIMESTAMP, -- когда планировщик закрыл тест, NULL - еще не закрывал
+    CHECK (closes_at IS NULL OR opens_at IS NULL OR closes_at > opens_at),
+    wrong_answer_penalty FLOAT NOT NULL DEFAULT 0
+        CHECK (wrong_answer_penalty >= 0 AND wrong_answer_penalty <= 1), -- доля веса вопроса, снимаемая за неверный ответ
+    clamp_at_zero BOOLEAN NOT NULL DEFAULT FALSE, -- не опускать итог попытки ниже нуля
+    review_content VARCHAR(20) NOT NULL DEFAULT 'correct_answers'
+        CHECK (review_content IN ('score_only', 'correct_answers', 'full')), -- что студент видит в разборе
+    review_availability VARCHAR(20) NOT NULL DEFAULT 'immediate'
+        CHECK (review_availability IN ('immediate', 'after_close')), -- когда разбор становится доступен
+    passing_percent FLOAT CHECK (passing_percent > 0 AND passing_percent <= 100), -- NULL - без порога и сертификатов
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -51,13 +111,28 @@ CREATE TABLE IF NOT EXISTS questions (
     id INTEGER NOT NULL,
     title VARCHAR(255) NOT NULL,
     text TEXT NOT NULL,
+    question_type VARCHAR(20) NOT NULL DEFAULT 'single'
+        CHECK (question_type IN ('single', 'multiple', 'text', 'numeric', 'essay')),
     options TEXT[] NOT NULL,
     correct_option INTEGER NOT NULL CHECK (correct_option >= 0),
+    correct_options INTEGER[], -- правильные варианты для вопросов типа multiple
     points INTEGER DEFAULT 1 CHECK (points > 0),
     author_id INTEGER REFERENCES users(id),
     version INTEGER DEFAULT 1,
     is_deleted BOOLEAN DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- правила проверки текстовых ответов
+    accepted_answers TEXT[],
+    case_sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    normalize_spaces BOOLEAN NOT NULL DEFAULT TRUE,
+    use_regex BOOLEAN NOT NULL DEFAULT FALSE,
+    -- правила проверки числовых ответов
+    numeric_answer DOUBLE PRECISION,
+    tolerance DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (tolerance >= 0),
+    tolerance_type VARCHAR(10) CHECK (tolerance_type IN ('absolute', 'relative')),
+    tags TEXT[] NOT NULL DEFAULT '{}', -- теги для случайных наборов вопросов
+    explanation TEXT, -- пояснение к вопросу для разбора попытки
+    option_explanations TEXT[], -- пояснения к вариантам, по индексам options
     PRIMARY KEY (id, version)
 );
 
@@ -72,6 +147,13 @@ END $$;
 ALTER TABLE questions ALTER COLUMN id SET DEFAULT nextval('questions_id_seq');
 SELECT setval('questions_id_seq', COALESCE((SELECT MAX(id) FROM questions), 0) + 1);
 
+-- Вопросы, проверяющие результат обучения (относится ко всем версиям вопроса)
+CREATE TABLE IF NOT EXISTS question_outcomes (
+    outcome_id INTEGER NOT NULL REFERENCES learning_outcomes(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    PRIMARY KEY (outcome_id, question_id)
+);
+
 -- Связь тестов и вопросов
 CREATE TABLE IF NOT EXISTS test_questions (
     id SERIAL PRIMARY KEY,
@@ -83,21 +165,104 @@ CREATE TABLE IF NOT EXISTS test_questions (
     FOREIGN KEY (question_id, question_version) REFERENCES questions(id, version)
 );
 
+-- Категория теста в журнале оценок (тест входит не больше чем в одну категорию)
+CREATE TABLE IF NOT EXISTS grade_category_tests (
+    test_id INTEGER PRIMARY KEY REFERENCES tests(id) ON DELETE CASCADE,
+    category_id INTEGER NOT NULL REFERENCES grade_categories(id) ON DELETE CASCADE
+);
+
+-- Ограничения на старт попыток: код доступа от проктора и разрешенные сети
+CREATE TABLE IF NOT EXISTS test_access (
+    test_id INTEGER PRIMARY KEY REFERENCES tests(id) ON DELETE CASCADE,
+    access_code VARCHAR(20), -- NULL - код не нужен
+    code_rotated_at TIMESTAMP,
+    allowed_networks TEXT[] NOT NULL DEFAULT '{}' -- CIDR, пусто - из любой сети
+);
+
+-- Журнал отказов в старте попытки
+CREATE TABLE IF NOT EXISTS attempt_start_denials (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_ip VARCHAR(45) NOT NULL,
+    reason VARCHAR(30) NOT NULL
+        CHECK (reason IN ('network_not_allowed', 'missing_code', 'invalid_code', 'too_many_failures')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Особые условия студента на курс или на один тест (условия теста важнее)
+CREATE TABLE IF NOT EXISTS student_accommodations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    course_id INTEGER REFERENCES courses(id) ON DELETE CASCADE,
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    time_multiplier FLOAT NOT NULL DEFAULT 1 CHECK (time_multiplier >= 1 AND time_multiplier <= 5),
+    extra_attempts INTEGER NOT NULL DEFAULT 0 CHECK (extra_attempts >= 0),
+    note TEXT,
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((course_id IS NULL) <> (test_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accommodations_user_course
+ON student_accommodations(user_id, course_id) WHERE course_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accommodations_user_test
+ON student_accommodations(user_id, test_id) WHERE test_id IS NOT NULL;
+
+-- Веса вопросов в тесте, переопределяют questions.points
+CREATE TABLE IF NOT EXISTS test_question_weights (
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    weight FLOAT NOT NULL CHECK (weight > 0),
+    PRIMARY KEY (test_id, question_id)
+);
+
 -- Попытки прохождения тестов
 CREATE TABLE IF NOT EXISTS attempts (
     id SERIAL PRIMARY KEY,
     test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
     user_id INTEGER NOT NULL REFERENCES users(id),
-    status VARCHAR(20) DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'completed', 'cancelled')),
+    status VARCHAR(20) DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'awaiting_review', 'completed', 'cancelled')),
     score FLOAT,
     started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    completed_at TIMESTAMP
+    completed_at TIMESTAMP,
+    deadline TIMESTAMP, -- NULL - без ограничения по времени
+    max_score FLOAT NOT NULL DEFAULT 0, -- сумма баллов набора вопросов, фиксируется при старте
+    score_breakdown TEXT, -- JSON с разбором баллов по вопросам, заполняется при подсчете
+    -- Примененные при старте особые условия студента (student_accommodations)
+    accommodation_id INTEGER REFERENCES student_accommodations(id) ON DELETE SET NULL,
+    time_multiplier FLOAT NOT NULL DEFAULT 1,
+    extra_minutes INTEGER NOT NULL DEFAULT 0, -- добавлено к длительности теста
+    extra_attempt BOOLEAN NOT NULL DEFAULT FALSE -- попытка сверх max_attempts
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS idx_unique_active_attempt 
 ON attempts(test_id, user_id) 
 WHERE status = 'in_progress';
 
+-- Правила случайного набора вопросов: question_count вопросов с тегом tag
+CREATE TABLE IF NOT EXISTS test_pool_rules (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    tag VARCHAR(100) NOT NULL,
+    question_count INTEGER NOT NULL CHECK (question_count > 0),
+    weight_by_points BOOLEAN NOT NULL DEFAULT FALSE, -- вероятность выбора пропорциональна баллам
+    UNIQUE (test_id, tag)
+);
+
+-- Набор вопросов попытки, фиксируется при старте
+CREATE TABLE IF NOT EXISTS attempt_questions (
+    attempt_id INTEGER NOT NULL REFERENCES attempts(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    question_version INTEGER NOT NULL,
+    position INTEGER NOT NULL, -- порядок показа в попытке
+    option_order INTEGER[], -- option_order[i] - исходный индекс i-го показанного варианта, NULL - без перестановки
+    PRIMARY KEY (attempt_id, question_id),
+    FOREIGN KEY (question_id, question_version) REFERENCES questions(id, version)
+);
+
 -- Удаляем старую таблицу ответов, если существует
 DROP TABLE IF EXISTS attempt_answers CASCADE;
 
@@ -108,8 +273,16 @@ CREATE TABLE IF NOT EXISTS attempt_answers (
     question_id INTEGER NOT NULL,
     question_version INTEGER NOT NULL DEFAULT 1,
     selected_option INTEGER DEFAULT -1 CHECK (selected_option >= -1),
+    selected_options INTEGER[], -- выбранные варианты для вопросов типа multiple
+    text_answer TEXT, -- ответ на текстовый вопрос
+    numeric_answer DOUBLE PRECISION, -- ответ на числовой вопрос
     correct_answer BOOLEAN,
     is_correct BOOLEAN,  -- Дополнительная колонка для совместимости
+    points_awarded FLOAT, -- начисленные баллы, заполняется при завершении попытки
+    review_comment TEXT, -- комментарий преподавателя к развернутому ответу
+    reviewed_by INTEGER REFERENCES users(id),
+    reviewed_at TIMESTAMP,
+    client_seq BIGINT, -- номер последнего сохранения с клиента, более старые автосохранения отбрасываются
     answered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (question_id, question_version) REFERENCES questions(id, version)
 );
@@ -135,6 +308,87 @@ CREATE TRIGGER sync_attempt_answers_correct
     FOR EACH ROW
     EXECUTE FUNCTION sync_correct_columns();
 
+-- История ответов: первый ответ на вопрос и каждое его изменение
+CREATE TABLE IF NOT EXISTS attempt_answer_history (
+    id SERIAL PRIMARY KEY,
+    attempt_id INTEGER NOT NULL REFERENCES attempts(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    question_version INTEGER NOT NULL,
+    selected_option INTEGER,
+    selected_options INTEGER[],
+    text_answer TEXT,
+    numeric_answer DOUBLE PRECISION,
+    answered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Итоговые результаты студентов по тестам (с учетом score_policy теста)
+CREATE TABLE IF NOT EXISTS test_results (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    score FLOAT NOT NULL DEFAULT 0,
+    max_score FLOAT NOT NULL DEFAULT 0,
+    attempts_count INTEGER NOT NULL DEFAULT 0, -- число завершенных попыток
+    completed_at TIMESTAMP,
+    UNIQUE (test_id, user_id)
+);
+
+-- Сертификаты о прохождении теста (один на студента и тест)
+CREATE TABLE IF NOT EXISTS certificates (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    attempt_id INTEGER NOT NULL REFERENCES attempts(id) ON DELETE CASCADE,
+    verification_code VARCHAR(20) NOT NULL UNIQUE,
+    -- данные на момент выдачи
+    student_name VARCHAR(255) NOT NULL,
+    test_title VARCHAR(255) NOT NULL,
+    course_name VARCHAR(255) NOT NULL,
+    score FLOAT NOT NULL,
+    max_score FLOAT NOT NULL,
+    percentage FLOAT NOT NULL,
+    passing_percent FLOAT NOT NULL,
+    issued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP, -- пересчет опустил итог ниже порога
+    pdf BYTEA,
+    UNIQUE (test_id, user_id)
+);
+
+-- Журнал пересчетов попыток после исправления ключа ответа
+CREATE TABLE IF NOT EXISTS regrades (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE, -- NULL - вопрос пересчитан во всех тестах
+    question_id INTEGER, -- NULL - пересчитан весь тест
+    question_version INTEGER, -- NULL - все версии вопроса
+    reason TEXT,
+    regraded_by INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Баллы попыток до и после пересчета
+CREATE TABLE IF NOT EXISTS regrade_changes (
+    regrade_id INTEGER NOT NULL REFERENCES regrades(id) ON DELETE CASCADE,
+    attempt_id INTEGER NOT NULL REFERENCES attempts(id) ON DELETE CASCADE,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    old_score FLOAT,
+    new_score FLOAT,
+    old_max_score FLOAT NOT NULL,
+    new_max_score FLOAT NOT NULL,
+    PRIMARY KEY (regrade_id, attempt_id)
+);
+
+-- События прокторинга, которые клиент сообщает во время попытки
+CREATE TABLE IF NOT EXISTS attempt_events (
+    id SERIAL PRIMARY KEY,
+    attempt_id INTEGER NOT NULL REFERENCES attempts(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL
+        CHECK (event_type IN ('focus_lost', 'tab_hidden', 'fullscreen_exit', 'copy', 'paste', 'reconnect')),
+    occurred_at TIMESTAMP NOT NULL, -- время на клиенте (UTC), если передано
+    recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- время получения сервером
+    details TEXT
+);
+
 -- Уведомления
 CREATE TABLE IF NOT EXISTS notifications (
     id SERIAL PRIMARY KEY,
@@ -152,11 +406,22 @@ CREATE TABLE IF NOT EXISTS notifications (
 -- Индексы для ускорения запросов
 CREATE INDEX IF NOT EXISTS idx_tests_course_id ON tests(course_id);
 CREATE INDEX IF NOT EXISTS idx_tests_teacher_id ON tests(teacher_id);
+CREATE INDEX IF NOT EXISTS idx_tests_opens_at ON tests(opens_at) WHERE auto_opened_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_tests_closes_at ON tests(closes_at) WHERE auto_closed_at IS NULL;
 CREATE INDEX IF NOT EXISTS idx_test_questions_test_id ON test_questions(test_id);
 CREATE INDEX IF NOT EXISTS idx_test_questions_question ON test_questions(question_id, question_version);
 CREATE INDEX IF NOT EXISTS idx_attempts_test_user ON attempts(test_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_attempts_deadline ON attempts(deadline) WHERE status = 'in_progress';
 CREATE INDEX IF NOT EXISTS idx_attempt_answers_attempt ON attempt_answers(attempt_id);
 CREATE INDEX IF NOT EXISTS idx_attempt_answers_question ON attempt_answers(question_id, question_version);
+CREATE INDEX IF NOT EXISTS idx_answer_history_attempt ON attempt_answer_history(attempt_id, question_id);
+CREATE INDEX IF NOT EXISTS idx_attempt_events_attempt ON attempt_events(attempt_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_start_denials_test_user ON attempt_start_denials(test_id, user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_regrade_changes_test ON regrade_changes(test_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_user ON certificates(user_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_attempt ON certificates(attempt_id);
+CREATE INDEX IF NOT EXISTS idx_grade_category_tests_category ON grade_category_tests(category_id);
+CREATE INDEX IF NOT EXISTS idx_question_outcomes_question ON question_outcomes(question_id);
 CREATE INDEX IF NOT EXISTS idx_questions_author ON questions(author_id);
 CREATE INDEX IF NOT EXISTS idx_courses_teacher ON courses(teacher_id);
 CREATE INDEX IF NOT EXISTS idx_user_roles_user ON user_roles(user_id);
@@ -164,6 +429,7 @@ CREATE INDEX IF NOT EXISTS idx_questions_id_version ON questions(id, version);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id);
 CREATE INDEX IF NOT EXISTS idx_notifications_user_read ON notifications(user_id, is_read);
 CREATE INDEX IF NOT EXISTS idx_questions_latest_version ON questions(id, version DESC);
+CREATE INDEX IF NOT EXISTS idx_questions_tags ON questions USING GIN (tags);
 
 -- Комментарий к колонке (исправленный)
 COMMENT ON COLUMN attempt_answers.correct_answer IS 'Правильность ответа (используется вместо is_correct)';
\ No newline at end of file
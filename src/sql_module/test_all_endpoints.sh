@@ -248,8 +248,18 @@ test_courses() {
     print_subheader "9. Восстановление курса"
     curl_request "POST" "/courses/$COURSE_ID/restore" "" "$ADMIN_TOKEN" 200 "Восстановить курс"
     
-    print_subheader "10. Отчисление студента с курса"
+    print_subheader "10. Особые условия студента (полуторное время, дополнительная попытка)"
+    ACCOMMODATION_JSON='{"user_id":'$STUDENT_ID',"time_multiplier":1.5,"extra_attempts":1,"note":"Справка"}'
+    curl_request "PUT" "/courses/$COURSE_ID/accommodations" "$ACCOMMODATION_JSON" "$TEACHER_TOKEN" 200 "Задать особые условия"
+    curl_request "GET" "/courses/$COURSE_ID/accommodations" "" "$TEACHER_TOKEN" 200 "Получить особые условия курса"
+    
+    print_subheader "11. Отчисление студента с курса"
     curl_request "DELETE" "/courses/$COURSE_ID/students/$STUDENT_ID" "" "$TEACHER_TOKEN" 200 "Отчислить студента"
+    
+    print_subheader "12. Шкала оценок курса"
+    SCALE_JSON='{"preset":"russian_5"}'
+    curl_request "PUT" "/courses/$COURSE_ID/grade-scale" "$SCALE_JSON" "$TEACHER_TOKEN" 200 "Задать пятибалльную шкалу"
+    curl_request "GET" "/courses/$COURSE_ID/grade-scale" "" "$TEACHER_TOKEN" 200 "Получить шкалу оценок"
 }
 
 # ============================================
@@ -292,6 +302,24 @@ test_questions() {
     
     print_subheader "9. Восстановление вопроса"
     curl_request "POST" "/questions/$QUESTION2_ID/restore" "" "$TEACHER_TOKEN" 200 "Восстановить вопрос"
+    
+    print_subheader "10. Создание вопроса с несколькими правильными вариантами"
+    MULTIPLE_JSON='{"text":"Какие языки компилируемые?","question_type":"multiple","options":["Go","Python","C","JavaScript"],"correct_options":[0,2],"points":4}'
+    curl_request "POST" "/questions" "$MULTIPLE_JSON" "$TEACHER_TOKEN" 201 "Создать вопрос multiple"
+    
+    print_subheader "11. Создание текстового и числового вопросов"
+    TEXT_JSON='{"text":"Столица Франции?","question_type":"text","accepted_answers":["Париж","Paris"],"points":2}'
+    curl_request "POST" "/questions" "$TEXT_JSON" "$TEACHER_TOKEN" 201 "Создать текстовый вопрос"
+    NUMERIC_JSON='{"text":"Чему равно число пи (до сотых)?","question_type":"numeric","numeric_answer":3.14,"tolerance":0.01,"points":2}'
+    curl_request "POST" "/questions" "$NUMERIC_JSON" "$TEACHER_TOKEN" 201 "Создать числовой вопрос"
+    
+    print_subheader "12. Создание вопроса с развернутым ответом"
+    ESSAY_JSON='{"text":"Опишите принцип работы сборщика мусора","question_type":"essay","points":5,"tags":["gc"]}'
+    curl_request "POST" "/questions" "$ESSAY_JSON" "$TEACHER_TOKEN" 201 "Создать вопрос essay"
+    
+    print_subheader "13. Создание вопроса с пояснениями"
+    EXPLAINED_JSON='{"text":"Go - компилируемый язык?","options":["Да","Нет"],"correct_option":0,"explanation":"Go компилируется в машинный код","option_explanations":["Верно","Интерпретатора у Go нет"]}'
+    curl_request "POST" "/questions" "$EXPLAINED_JSON" "$TEACHER_TOKEN" 201 "Создать вопрос с пояснениями"
 }
 
 # ============================================
@@ -341,6 +369,48 @@ test_tests() {
     
     print_subheader "12. Активация теста снова"
     curl_request "POST" "/tests/$TEST_ID/activate" "" "$TEACHER_TOKEN" 200 "Активировать тест снова"
+    
+    print_subheader "13. Установка лимита времени на тест"
+    UPDATE_TEST='{"duration_minutes":30}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_TEST" "$TEACHER_TOKEN" 200 "Установить лимит времени"
+    
+    print_subheader "14. Ограничение числа попыток и политика подсчета"
+    UPDATE_ATTEMPTS='{"max_attempts":3,"score_policy":"best"}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_ATTEMPTS" "$TEACHER_TOKEN" 200 "Установить лимит попыток"
+    
+    print_subheader "15. Включение перемешивания вопросов и вариантов"
+    UPDATE_SHUFFLE='{"shuffle_questions":true,"shuffle_options":true}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_SHUFFLE" "$TEACHER_TOKEN" 200 "Включить перемешивание"
+    
+    print_subheader "16. Получение правил пула вопросов"
+    curl_request "GET" "/tests/$TEST_ID/pool-rules" "" "$TEACHER_TOKEN" 200 "Получить правила пула"
+    
+    print_subheader "17. Расписание закрытия теста"
+    UPDATE_SCHEDULE='{"closes_at":"2099-01-01T00:00:00Z"}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_SCHEDULE" "$TEACHER_TOKEN" 200 "Установить время закрытия"
+    
+    print_subheader "18. Штраф за неверный ответ"
+    UPDATE_PENALTY='{"wrong_answer_penalty":0.25,"clamp_at_zero":true}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_PENALTY" "$TEACHER_TOKEN" 200 "Установить штраф"
+    
+    print_subheader "19. Получение весов вопросов"
+    curl_request "GET" "/tests/$TEST_ID/weights" "" "$TEACHER_TOKEN" 200 "Получить веса вопросов"
+    
+    print_subheader "20. Политика просмотра результатов"
+    UPDATE_REVIEW='{"review_content":"full","review_availability":"after_close"}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_REVIEW" "$TEACHER_TOKEN" 200 "Установить политику просмотра"
+    
+    print_subheader "21. Порог прохождения теста"
+    UPDATE_PASSING='{"passing_percent":50}'
+    curl_request "PUT" "/tests/$TEST_ID" "$UPDATE_PASSING" "$TEACHER_TOKEN" 200 "Установить порог прохождения"
+    
+    print_subheader "22. Код доступа и разрешенные сети"
+    ACCESS_JSON='{"require_code":true,"allowed_networks":["10.0.0.0/8","192.168.1.15"]}'
+    curl_request "PUT" "/tests/$TEST_ID/access" "$ACCESS_JSON" "$TEACHER_TOKEN" 200 "Включить код доступа"
+    curl_request "POST" "/tests/$TEST_ID/access/rotate" "" "$TEACHER_TOKEN" 200 "Сменить код доступа"
+    curl_request "GET" "/tests/$TEST_ID/access" "" "$TEACHER_TOKEN" 200 "Получить настройки доступа"
+    ACCESS_OFF_JSON='{"require_code":false,"allowed_networks":[]}'
+    curl_request "PUT" "/tests/$TEST_ID/access" "$ACCESS_OFF_JSON" "$TEACHER_TOKEN" 200 "Снять ограничения доступа"
 }
 
 # ============================================
@@ -362,16 +432,25 @@ test_attempts() {
     ANSWER_JSON='{"question_id":'$QUESTION_ID',"question_version":1,"selected_option":1}'
     curl_request "POST" "/attempts/$ATTEMPT_ID/answer" "$ANSWER_JSON" "$STUDENT_TOKEN" 200 "Отправить ответ"
     
-    print_subheader "4. Получение ответов попытки"
+    print_subheader "4. Пакетное автосохранение ответов"
+    BATCH_JSON='{"answers":[{"question_id":'$QUESTION_ID',"selected_option":0,"client_seq":2},{"question_id":'$QUESTION_ID',"selected_option":1,"client_seq":1}]}'
+    curl_request "POST" "/attempts/$ATTEMPT_ID/answers" "$BATCH_JSON" "$STUDENT_TOKEN" 200 "Автосохранение ответов"
+    
+    print_subheader "5. Отправка событий прокторинга"
+    EVENTS_JSON='{"events":[{"event_type":"tab_hidden"},{"event_type":"focus_lost","details":"alt-tab"}]}'
+    curl_request "POST" "/attempts/$ATTEMPT_ID/events" "$EVENTS_JSON" "$STUDENT_TOKEN" 201 "Отправить события"
+    
+    print_subheader "6. Получение ответов попытки"
     curl_request "GET" "/attempts/$ATTEMPT_ID/answers" "" "$STUDENT_TOKEN" 200 "Получить ответы попытки"
     
-    print_subheader "5. Завершение попытки"
-    curl_request "POST" "/attempts/$ATTEMPT_ID/complete" "" "$STUDENT_TOKEN" 500 "Завершить попытку"
+    print_subheader "7. Завершение попытки"
+    curl_request "POST" "/attempts/$ATTEMPT_ID/complete" "" "$STUDENT_TOKEN" 200 "Завершить попытку"
     
-    print_subheader "6. Получение результатов теста (преподаватель)"
+    print_subheader "8. Получение результатов теста (преподаватель)"
     curl_request "GET" "/tests/$TEST_ID/results" "" "$TEACHER_TOKEN" 200 "Получить результаты теста"
+    curl_request "GET" "/tests/$TEST_ID/results?bins=5" "" "$TEACHER_TOKEN" 200 "Результаты с гистограммой из 5 интервалов"
     
-    print_subheader "7. Отмена попытки (создадим новую)"
+    print_subheader "9. Отмена попытки (создадим новую)"
     response=$(curl_request "POST" "/tests/$TEST_ID/start" "" "$STUDENT_TOKEN" 201 "Начать вторую попытку")
     ATTEMPT2_ID=$(extract_id "$response")
 
@@ -381,6 +460,61 @@ test_attempts() {
     fi
 
     curl_request "POST" "/attempts/$ATTEMPT2_ID/cancel" "" "$STUDENT_TOKEN" 200 "Отменить попытку"
+    
+    print_subheader "10. Очередь ответов на ручную проверку (преподаватель)"
+    curl_request "GET" "/reviews?test_id=$TEST_ID" "" "$TEACHER_TOKEN" 200 "Получить очередь проверки"
+    
+    print_subheader "11. Хронология событий попытки (преподаватель)"
+    curl_request "GET" "/attempts/$ATTEMPT_ID/events" "" "$TEACHER_TOKEN" 200 "Получить события попытки"
+    
+    print_subheader "12. Пересчет попыток теста (преподаватель)"
+    REGRADE_JSON='{"reason":"Исправлен ключ ответа"}'
+    curl_request "POST" "/tests/$TEST_ID/regrade" "$REGRADE_JSON" "$TEACHER_TOKEN" 200 "Пересчитать попытки"
+    
+    print_subheader "13. Журнал пересчетов теста"
+    curl_request "GET" "/tests/$TEST_ID/regrades" "" "$TEACHER_TOKEN" 200 "Получить журнал пересчетов"
+    
+    print_subheader "14. Сертификаты студента"
+    curl_request "GET" "/my/certificates" "" "$STUDENT_TOKEN" 200 "Получить свои сертификаты"
+    
+    print_subheader "15. Проверка сертификата по коду (без авторизации)"
+    curl_request "GET" "/certificates/verify/AAAA-BBBB-CCCC" "" "" 404 "Проверить несуществующий код"
+    
+    print_subheader "16. Журнал отказов в старте попытки"
+    curl_request "GET" "/tests/$TEST_ID/access/denials" "" "$TEACHER_TOKEN" 200 "Получить журнал отказов"
+    
+    print_subheader "17. Анализ вопросов теста"
+    curl_request "GET" "/tests/$TEST_ID/item-analysis" "" "$TEACHER_TOKEN" 200 "Получить анализ вопросов"
+    curl_request "GET" "/item-analysis?test_ids=$TEST_ID" "" "$TEACHER_TOKEN" 200 "Анализ вопросов по списку тестов"
+    
+    print_subheader "18. Журнал оценок курса"
+    CATEGORIES_JSON='{"categories":[{"name":"Контрольные","weight":60,"test_ids":['$TEST_ID']},{"name":"Домашние","weight":40,"test_ids":[]}]}'
+    curl_request "PUT" "/courses/$COURSE_ID/grade-categories" "$CATEGORIES_JSON" "$TEACHER_TOKEN" 200 "Задать категории оценок"
+    curl_request "GET" "/courses/$COURSE_ID/gradebook" "" "$TEACHER_TOKEN" 200 "Получить журнал оценок"
+    
+    print_subheader "19. Выгрузка результатов и журнала оценок"
+    curl_request "GET" "/tests/$TEST_ID/results/export?format=csv&questions=true" "" "$TEACHER_TOKEN" 200 "Выгрузить результаты теста в CSV"
+    curl_request "GET" "/courses/$COURSE_ID/gradebook/export?format=csv&delimiter=semicolon" "" "$TEACHER_TOKEN" 200 "Выгрузить журнал оценок в CSV"
+    curl_request "GET" "/tests/$TEST_ID/results/export?format=pdf" "" "$TEACHER_TOKEN" 400 "Неизвестный формат выгрузки"
+    
+    print_subheader "20. Поиск списывания по совпадающим ошибкам"
+    curl_request "GET" "/tests/$TEST_ID/collusion" "" "$TEACHER_TOKEN" 200 "Получить подозрительные пары"
+    curl_request "GET" "/tests/$TEST_ID/collusion?min_shared_errors=2&max_probability=0.05" "" "$TEACHER_TOKEN" 200 "Подозрительные пары с мягкими порогами"
+    curl_request "GET" "/tests/$TEST_ID/collusion" "" "$STUDENT_TOKEN" 403 "Студент не видит анализ списывания"
+    
+    print_subheader "21. Время ответов и история изменений"
+    curl_request "GET" "/attempts/$ATTEMPT_ID/timing" "" "$TEACHER_TOKEN" 200 "Время по вопросам попытки"
+    curl_request "GET" "/tests/$TEST_ID/timing" "" "$TEACHER_TOKEN" 200 "Время по вопросам теста"
+    
+    print_subheader "22. Результаты обучения и их освоение"
+    OUTCOME_JSON='{"code":"LO1","title":"Основы математики","mastery_threshold":60}'
+    response=$(curl_request "POST" "/courses/$COURSE_ID/outcomes" "$OUTCOME_JSON" "$TEACHER_TOKEN" 201 "Создать результат обучения")
+    OUTCOME_ID=$(extract_id "$response")
+    curl_request "PUT" "/courses/$COURSE_ID/outcomes/$OUTCOME_ID/questions" '{"question_ids":['$QUESTION_ID']}' "$TEACHER_TOKEN" 200 "Привязать вопросы к результату"
+    curl_request "GET" "/courses/$COURSE_ID/outcomes" "" "$TEACHER_TOKEN" 200 "Получить результаты обучения курса"
+    curl_request "GET" "/courses/$COURSE_ID/mastery" "" "$TEACHER_TOKEN" 200 "Освоение по всем студентам курса"
+    curl_request "POST" "/courses/$COURSE_ID/students/$STUDENT_ID" "" "$TEACHER_TOKEN" 200 "Снова записать студента на курс"
+    curl_request "GET" "/courses/$COURSE_ID/mastery/$STUDENT_ID" "" "$STUDENT_TOKEN" 200 "Студент смотрит свое освоение"
 }
 
 # ============================================